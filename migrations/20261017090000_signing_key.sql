@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+create table signing_key(
+    kid varchar(64) primary key,
+    algorithm varchar(16) not null,
+    key_material text not null,
+    created_at timestamptz not null default current_timestamp,
+    retired_at timestamptz
+);
+
+comment on column signing_key.key_material is
+'HMAC secret or PEM encoded private key used to sign access tokens';
+comment on column signing_key.retired_at is
+'The time, when the key stopped signing new tokens. It still verifies tokens until the max access TTL has passed';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table signing_key;
+-- +goose StatementEnd
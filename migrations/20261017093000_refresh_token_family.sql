@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table refresh_token add column family_id uuid;
+update refresh_token set family_id = refresh_token_id;
+alter table refresh_token alter column family_id set not null;
+
+alter table refresh_token add column used_at timestamptz;
+
+create index idx_refresh_token_family_id on refresh_token(family_id);
+
+comment on column refresh_token.family_id is
+'Id of the first token of the rotation chain, shared by every token issued by refreshing it';
+comment on column refresh_token.used_at is
+'The time, when the token was rotated. Used tokens are kept until they expire to detect their reuse';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index idx_refresh_token_family_id;
+alter table refresh_token drop column used_at;
+alter table refresh_token drop column family_id;
+-- +goose StatementEnd
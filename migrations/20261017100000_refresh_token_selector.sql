@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table refresh_token add column has_selector boolean not null default false;
+
+comment on column refresh_token.has_selector is
+'Whether the token carries its refresh_token_id as lookup selector. Tokens issued before are found by checking every hash of the user';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table refresh_token drop column has_selector;
+-- +goose StatementEnd
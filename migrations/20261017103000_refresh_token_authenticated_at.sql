@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table refresh_token add column authenticated_at timestamptz;
+update refresh_token set authenticated_at = created_at;
+alter table refresh_token alter column authenticated_at set not null;
+
+create index idx_refresh_token_active on refresh_token(user_id, expires_at) where used_at is null;
+
+comment on column refresh_token.authenticated_at is
+'The time, when the user logged in. It is carried over to every token of the family and marks the start of the session';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index idx_refresh_token_active;
+alter table refresh_token drop column authenticated_at;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table "user" add column username varchar(64);
+alter table "user" add column email varchar(255);
+alter table "user" add column password_hash text;
+alter table "user" add column created_at timestamptz not null default current_timestamp;
+
+create unique index idx_user_username on "user"(lower(username));
+create unique index idx_user_email on "user"(lower(email));
+
+comment on column "user".password_hash is
+'Argon2id hash in the PHC string format, parameters are stored with the hash';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop index idx_user_email;
+drop index idx_user_username;
+alter table "user" drop column created_at;
+alter table "user" drop column password_hash;
+alter table "user" drop column email;
+alter table "user" drop column username;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+create table user_identity (
+    provider varchar(32) not null,
+    subject varchar(255) not null,
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    created_at timestamptz not null default current_timestamp,
+    primary key (provider, subject)
+);
+
+create index idx_user_identity_user_id on user_identity(user_id);
+
+comment on table user_identity is
+'Links users of external credential stores (LDAP, ...) to local users';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table user_identity;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+create table user_totp (
+    user_id uuid primary key references "user"(user_id) on delete cascade,
+    secret_encrypted text not null,
+    confirmed_at timestamptz,
+    last_used_step bigint not null default 0,
+    created_at timestamptz not null default current_timestamp
+);
+
+comment on column user_totp.secret_encrypted is
+'AES-GCM encrypted TOTP secret, the key is MFA_ENCRYPTION_KEY';
+comment on column user_totp.last_used_step is
+'Time step of the last accepted code, older and equal steps are rejected as replays';
+
+create table mfa_recovery_code (
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    code_hash varchar(64) not null,
+    used_at timestamptz,
+    created_at timestamptz not null default current_timestamp,
+    primary key (user_id, code_hash)
+);
+
+create table mfa_challenge (
+    challenge_hash varchar(64) primary key,
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    attempts int not null default 0,
+    expires_at timestamptz not null,
+    created_at timestamptz not null default current_timestamp
+);
+
+create index idx_mfa_challenge_expires_at on mfa_challenge(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table mfa_challenge;
+drop table mfa_recovery_code;
+drop table user_totp;
+-- +goose StatementEnd
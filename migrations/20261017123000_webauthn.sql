@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+create table webauthn_credential (
+    credential_id bytea primary key,
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    public_key bytea not null,
+    attestation_type varchar(32) not null,
+    aaguid bytea,
+    sign_count bigint not null default 0,
+    transports text[] not null default '{}',
+    backup_eligible boolean not null default false,
+    backup_state boolean not null default false,
+    created_at timestamptz not null default current_timestamp,
+    last_used_at timestamptz
+);
+
+create index idx_webauthn_credential_user_id on webauthn_credential(user_id);
+
+comment on column webauthn_credential.sign_count is
+'Signature counter of the authenticator, a counter that does not grow means a cloned authenticator';
+
+create table webauthn_session (
+    challenge varchar(128) primary key,
+    ceremony varchar(16) not null,
+    user_id uuid references "user"(user_id) on delete cascade,
+    session_data jsonb not null,
+    expires_at timestamptz not null
+);
+
+create index idx_webauthn_session_expires_at on webauthn_session(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table webauthn_session;
+drop table webauthn_credential;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table "user" add column email_verified_at timestamptz;
+
+create table user_action_token (
+    token_hash varchar(64) primary key,
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    purpose varchar(32) not null,
+    email varchar(255),
+    created_at timestamptz not null default current_timestamp,
+    expires_at timestamptz not null,
+    used_at timestamptz
+);
+
+create index idx_user_action_token_user_id on user_action_token(user_id, purpose);
+
+comment on table user_action_token is
+'Single-use tokens sent by mail: password reset, email verification';
+comment on column user_action_token.email is
+'Address the token was sent to, email verification only succeeds if it is still the user email';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table user_action_token;
+alter table "user" drop column email_verified_at;
+-- +goose StatementEnd
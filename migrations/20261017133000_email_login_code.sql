@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+create table email_login_code (
+    challenge_id uuid primary key,
+    email varchar(255) not null,
+    user_id uuid references "user"(user_id) on delete cascade,
+    link_token_hash varchar(64) not null unique,
+    code_hash varchar(64) not null,
+    user_agent text not null,
+    attempts int not null default 0,
+    created_at timestamptz not null default current_timestamp,
+    expires_at timestamptz not null,
+    used_at timestamptz
+);
+
+create index idx_email_login_code_email on email_login_code(email, created_at);
+
+comment on table email_login_code is
+'Passwordless login codes sent by mail, rows outlive the codes to rate limit requests per address';
+comment on column email_login_code.email is
+'Lowercased address the code was requested for';
+comment on column email_login_code.user_id is
+'Null for unknown addresses, the request is still recorded so the rate limit does not reveal registered addresses';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table email_login_code;
+-- +goose StatementEnd
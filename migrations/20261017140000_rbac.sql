@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+create table role (
+    name varchar(64) primary key,
+    description text not null default '',
+    created_at timestamptz not null default current_timestamp
+);
+
+create table permission (
+    name varchar(128) primary key,
+    created_at timestamptz not null default current_timestamp
+);
+
+create table role_permission (
+    role_name varchar(64) not null references role(name) on delete cascade,
+    permission_name varchar(128) not null references permission(name) on delete cascade,
+    primary key (role_name, permission_name)
+);
+
+create table user_role (
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    role_name varchar(64) not null references role(name) on delete cascade,
+    granted_at timestamptz not null default current_timestamp,
+    primary key (user_id, role_name)
+);
+
+create index idx_user_role_role_name on user_role(role_name);
+
+comment on table permission is
+'Permissions are put into the scope claim of access tokens, names have no spaces';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table user_role;
+drop table role_permission;
+drop table permission;
+drop table role;
+-- +goose StatementEnd
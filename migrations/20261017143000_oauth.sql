@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+create table oauth_client (
+    client_id varchar(64) primary key,
+    client_secret_hash varchar(64),
+    name varchar(255) not null,
+    redirect_uris text[] not null,
+    scopes text[] not null default '{}',
+    created_at timestamptz not null default current_timestamp
+);
+
+create table oauth_authorization_code (
+    code_hash varchar(64) primary key,
+    client_id varchar(64) not null references oauth_client(client_id) on delete cascade,
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    redirect_uri text not null,
+    scope text not null default '',
+    code_challenge varchar(128) not null,
+    created_at timestamptz not null default current_timestamp,
+    expires_at timestamptz not null,
+    used_at timestamptz
+);
+
+create index idx_oauth_authorization_code_expires_at on oauth_authorization_code(expires_at);
+
+alter table refresh_token add column client_id varchar(64) references oauth_client(client_id) on delete cascade;
+alter table refresh_token add column scope text;
+
+comment on column oauth_client.client_secret_hash is
+'SHA-256 of the secret of confidential clients, null for public clients (SPAs, mobile apps)';
+comment on column refresh_token.client_id is
+'OAuth client the session was issued to, null for first-party logins';
+comment on column refresh_token.scope is
+'Scope granted to the OAuth client, kept across rotations';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table refresh_token drop column scope;
+alter table refresh_token drop column client_id;
+drop table oauth_authorization_code;
+drop table oauth_client;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table refresh_token add column auth_methods text[] not null default '{}';
+alter table mfa_challenge add column auth_method varchar(16) not null default 'pwd';
+
+alter table oauth_authorization_code add column nonce text;
+alter table oauth_authorization_code add column auth_time timestamptz not null default current_timestamp;
+alter table oauth_authorization_code add column auth_methods text[] not null default '{}';
+
+comment on column refresh_token.auth_methods is
+'Authentication methods of the login (amr values of RFC 8176), carried over to every token of the family';
+comment on column mfa_challenge.auth_method is
+'Method of the first login step, completed by the second factor';
+comment on column oauth_authorization_code.auth_time is
+'Login time of the session that approved the authorization request';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table oauth_authorization_code drop column auth_methods;
+alter table oauth_authorization_code drop column auth_time;
+alter table oauth_authorization_code drop column nonce;
+alter table mfa_challenge drop column auth_method;
+alter table refresh_token drop column auth_methods;
+-- +goose StatementEnd
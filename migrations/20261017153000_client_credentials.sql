@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table oauth_client add column grant_types text[] not null default '{authorization_code,refresh_token}';
+alter table oauth_client add column access_token_ttl_seconds int;
+
+comment on column oauth_client.grant_types is
+'OAuth grants the client may use, client_credentials makes it a service account';
+comment on column oauth_client.access_token_ttl_seconds is
+'Lifetime of client_credentials access tokens, null for the default access token TTL';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table oauth_client drop column access_token_ttl_seconds;
+alter table oauth_client drop column grant_types;
+-- +goose StatementEnd
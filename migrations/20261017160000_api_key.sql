@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+create table api_key (
+    id uuid primary key,
+    prefix varchar(16) not null unique,
+    key_hash varchar(64) not null,
+    name varchar(255) not null,
+    user_id uuid references "user"(user_id) on delete cascade,
+    client_id varchar(64) references oauth_client(client_id) on delete cascade,
+    scopes text[] not null default '{}',
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    last_used_ip varchar(45),
+    created_at timestamptz not null default current_timestamp,
+    check ((user_id is null) <> (client_id is null))
+);
+
+create index idx_api_key_user_id on api_key(user_id);
+create index idx_api_key_client_id on api_key(client_id);
+
+comment on column api_key.prefix is
+'Public part of the key, finds the key without scanning the hashes';
+comment on column api_key.key_hash is
+'SHA-256 of the whole key, the key itself is shown only once';
+comment on column api_key.user_id is
+'Owner of the key, either a user or a service account (client_id)';
+comment on column api_key.expires_at is
+'Null for keys that never expire';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table api_key;
+-- +goose StatementEnd
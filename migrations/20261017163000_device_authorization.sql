@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+create table oauth_device_code (
+    device_code_hash varchar(64) primary key,
+    user_code varchar(16) not null unique,
+    client_id varchar(64) not null references oauth_client(client_id) on delete cascade,
+    scope text not null default '',
+    status varchar(16) not null default 'pending',
+    user_id uuid references "user"(user_id) on delete cascade,
+    auth_time timestamptz,
+    auth_methods text[],
+    interval_seconds int not null,
+    last_polled_at timestamptz,
+    created_at timestamptz not null default current_timestamp,
+    expires_at timestamptz not null
+);
+
+create index idx_oauth_device_code_expires_at on oauth_device_code(expires_at);
+
+comment on column oauth_device_code.user_code is
+'Short code the user enters on the verification page, stored without the dash';
+comment on column oauth_device_code.status is
+'pending, approved, denied or used';
+comment on column oauth_device_code.scope is
+'Requested scope, narrowed to the permissions of the user on approval';
+comment on column oauth_device_code.interval_seconds is
+'Minimal polling interval of the device, raised on every slow_down';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table oauth_device_code;
+-- +goose StatementEnd
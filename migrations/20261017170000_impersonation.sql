@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+create table impersonation (
+    jti uuid primary key,
+    actor varchar(255) not null,
+    user_id uuid not null references "user"(user_id) on delete cascade,
+    reason text not null,
+    scope text not null default '',
+    ip_address varchar(45),
+    user_agent text,
+    created_at timestamptz not null default current_timestamp,
+    expires_at timestamptz not null
+);
+
+create index idx_impersonation_user_id on impersonation(user_id);
+
+comment on table impersonation is
+'Audit trail of admin impersonation, one row per issued access token';
+comment on column impersonation.actor is
+'Admin who impersonates the user, put into the act claim of the token';
+comment on column impersonation.ip_address is
+'Address of the admin request that issued the token';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table impersonation;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table refresh_token add column dpop_jkt varchar(43);
+
+comment on column refresh_token.dpop_jkt is
+'JWK SHA-256 thumbprint of the DPoP key the session is bound to, null for bearer sessions';
+
+create table dpop_proof (
+    jkt varchar(43) not null,
+    jti varchar(255) not null,
+    expires_at timestamptz not null,
+    primary key (jkt, jti)
+);
+
+create index idx_dpop_proof_expires_at on dpop_proof(expires_at);
+
+comment on table dpop_proof is
+'jti of accepted DPoP proofs, kept while the proofs are fresh to reject their replay';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+drop table dpop_proof;
+alter table refresh_token drop column dpop_jkt;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table oauth_client add column tls_client_auth_attribute varchar(32);
+alter table oauth_client add column tls_client_auth_value text;
+alter table oauth_client add constraint oauth_client_tls_client_auth_check
+    check ((tls_client_auth_attribute is null) = (tls_client_auth_value is null));
+
+alter table refresh_token add column cert_thumbprint varchar(43);
+
+comment on column oauth_client.tls_client_auth_attribute is
+'Certificate attribute of tls_client_auth clients (RFC 8705): tls_client_auth_subject_dn or a tls_client_auth_san_* name';
+comment on column oauth_client.tls_client_auth_value is
+'Value the attribute of the client certificate must have';
+comment on column refresh_token.cert_thumbprint is
+'SHA-256 thumbprint of the TLS client certificate the session of a public client is bound to';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table refresh_token drop column cert_thumbprint;
+alter table oauth_client drop constraint oauth_client_tls_client_auth_check;
+alter table oauth_client drop column tls_client_auth_value;
+alter table oauth_client drop column tls_client_auth_attribute;
+-- +goose StatementEnd
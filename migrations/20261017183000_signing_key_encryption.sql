@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table signing_key add column encrypted boolean not null default false;
+
+comment on column signing_key.key_material is
+'HMAC secret or PEM encoded private key used to sign access tokens, sealed with MFA_ENCRYPTION_KEY when encrypted is set';
+comment on column signing_key.encrypted is
+'Whether key_material is encrypted. Keys stored before encryption are sealed on the next start of the service';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table signing_key drop column encrypted;
+comment on column signing_key.key_material is
+'HMAC secret or PEM encoded private key used to sign access tokens';
+-- +goose StatementEnd
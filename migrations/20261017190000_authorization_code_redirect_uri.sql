@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table oauth_authorization_code add column redirect_uri_requested boolean not null default true;
+
+comment on column oauth_authorization_code.redirect_uri_requested is
+'Whether the authorization request carried redirect_uri, the token request must then repeat it (RFC 6749, section 4.1.3)';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table oauth_authorization_code drop column redirect_uri_requested;
+-- +goose StatementEnd
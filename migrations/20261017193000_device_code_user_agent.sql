@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table oauth_device_code add column user_agent text not null default '';
+
+comment on column oauth_device_code.user_agent is
+'User-Agent of the device that requested the code, polls from other user agents are rejected';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table oauth_device_code drop column user_agent;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+alter table user_totp add column failed_attempts int not null default 0;
+alter table user_totp add column locked_until timestamptz;
+
+comment on column user_totp.failed_attempts is
+'Codes checked since the last accepted one, counted across MFA challenges';
+comment on column user_totp.locked_until is
+'Set once failed_attempts reaches the limit, no codes are checked until then';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+alter table user_totp drop column locked_until;
+alter table user_totp drop column failed_attempts;
+-- +goose StatementEnd
@@ -1,8 +1,10 @@
 package core
 
 import (
+	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -21,7 +23,12 @@ type DatabaseConfig struct {
 
 type ServerConfig struct {
 	Title string
-	Port string
+	Port  string
+	// TLSCertPEM and TLSKeyPEM serve HTTPS, plain HTTP when empty
+	TLSCertPEM []byte
+	TLSKeyPEM  []byte
+	// TLSClientCAPEM verifies optional client certificates (mutual TLS)
+	TLSClientCAPEM []byte
 }
 
 type LoginAttemptWebhookConfig struct {
@@ -29,11 +36,112 @@ type LoginAttemptWebhookConfig struct {
 }
 
 type JWTConfig struct {
-	Secret string
-	ExpiresAccessMinutes int
+	KeyID     string
+	Algorithm string
+	// Audience is the "aud" of tokens for this service, the issuer when empty
+	Audience      string
+	Secret        string
+	PrivateKeyPEM []byte
+	// EncryptionKey seals the key material stored in the key ring
+	EncryptionKey         []byte
+	ExpiresAccessMinutes  int
 	ExpiresRefreshMinutes int
 }
 
+type IntrospectionConfig struct {
+	// Clients maps client_id to client_secret of resource servers allowed to introspect tokens
+	Clients map[string]string
+}
+
+type SessionConfig struct {
+	MaxSessions    int
+	EvictionPolicy string
+}
+
+type PasswordConfig struct {
+	MinLength         int
+	Argon2MemoryKiB   uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+type AuthenticatorConfig struct {
+	// Chain of credential stores asked in order: local, ldap
+	Chain []string
+	LDAP  LDAPConfig
+}
+
+type LDAPConfig struct {
+	URL              string
+	StartTLS         bool
+	BindDN           string
+	BindPassword     string
+	BaseDN           string
+	UserFilter       string
+	SubjectAttribute string
+	TimeoutSeconds   int
+}
+
+type MFAConfig struct {
+	// EncryptionKey encrypts TOTP secrets and keys recovery code hashes
+	EncryptionKey []byte
+	TOTPIssuer    string
+}
+
+type WebAuthnConfig struct {
+	RPID          string
+	RPDisplayName string
+	RPOrigins     []string
+	Attestation   string
+}
+
+type MailConfig struct {
+	// Transport is smtp or file
+	Transport    string
+	From         string
+	FileDir      string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	// AppURL is the base of the links in password reset and verification mails
+	AppURL string
+}
+
+type EmailLoginConfig struct {
+	CodeTTLMinutes    int
+	RateLimit         int
+	RateWindowMinutes int
+}
+
+type OAuthConfig struct {
+	// LoginURL is the page that logs the user in and approves authorization requests
+	LoginURL string
+	// Issuer is the public URL of this service, the "iss" of access and ID tokens
+	Issuer string
+	// MaxClientTokenTTLMinutes bounds the token lifetime service accounts may set
+	MaxClientTokenTTLMinutes int
+	// DeviceVerificationURL is the page where users enter the codes of devices
+	DeviceVerificationURL string
+}
+
+type RefreshCookieConfig struct {
+	// Enabled sets refresh tokens of first-party logins as an HttpOnly cookie
+	// instead of returning them in the body
+	Enabled bool
+	Name    string
+	// CSRFName is the cookie the SPA reads the CSRF token from
+	CSRFName string
+	// Domain is empty for cookies of the host only
+	Domain string
+	// SameSite is Strict, Lax or None
+	SameSite string
+}
+
+type AdminConfig struct {
+	APIToken string
+}
+
 type LoggerConfig struct {
 	Level slog.Level
 }
@@ -105,18 +213,474 @@ func InitializeJWTConfig() (JWTConfig, error) {
 		return JWTConfig{}, err
 	}
 
+	algorithm := strings.ToUpper(os.Getenv("JWT_ALGORITHM"))
+	if algorithm == "" {
+		algorithm = "HS512"
+	}
+	if algorithm == "EDDSA" {
+		algorithm = "EdDSA"
+	}
+
+	// Asymmetric algorithms need a private key, the public part is derived from it
+	var privateKeyPEM []byte
+	if privateKeyPath := os.Getenv("JWT_PRIVATE_KEY_PATH"); privateKeyPath != "" {
+		privateKeyPEM, err = os.ReadFile(privateKeyPath)
+		if err != nil {
+			return JWTConfig{}, fmt.Errorf("Failed to read JWT_PRIVATE_KEY_PATH: %v", err)
+		}
+	}
+
+	if !strings.HasPrefix(algorithm, "HS") && privateKeyPEM == nil {
+		return JWTConfig{}, fmt.Errorf("JWT_PRIVATE_KEY_PATH is required for JWT_ALGORITHM %s", algorithm)
+	}
+
+	// The configured key only seeds the key ring on the first start
+	keyID := os.Getenv("JWT_KEY_ID")
+	if keyID == "" {
+		keyID = "default"
+	}
+
+	audience := os.Getenv("JWT_AUDIENCE")
+	if strings.ContainsAny(audience, " \t") {
+		return JWTConfig{}, fmt.Errorf("Invalid JWT_AUDIENCE: %q, expected a name or URI without spaces", audience)
+	}
+
+	// Separate from MFA_ENCRYPTION_KEY, so either can be rotated on its own
+	encryptionKey, err := base64.StdEncoding.DecodeString(os.Getenv("SIGNING_KEY_ENCRYPTION_KEY"))
+	if err != nil {
+		return JWTConfig{}, fmt.Errorf("Invalid SIGNING_KEY_ENCRYPTION_KEY: %v", err)
+	}
+	if len(encryptionKey) != 32 {
+		return JWTConfig{}, fmt.Errorf("SIGNING_KEY_ENCRYPTION_KEY must be 32 bytes encoded with base64")
+	}
+
 	return JWTConfig{
-		Secret:   os.Getenv("APPLICATION_HOST"),
+		KeyID:                 keyID,
+		Algorithm:             algorithm,
+		Audience:              audience,
+		Secret:                os.Getenv("SECRET_STR"),
+		PrivateKeyPEM:         privateKeyPEM,
+		EncryptionKey:         encryptionKey,
 		ExpiresAccessMinutes:  expiresAccessMinutes,
 		ExpiresRefreshMinutes: expiresRefreshMinutes,
-	},  nil
+	}, nil
+}
+
+func InitializeIntrospectionConfig() (IntrospectionConfig, error) {
+
+	// Format: client_id:client_secret,client_id:client_secret
+	clients := map[string]string{}
+	for _, client := range strings.Split(os.Getenv("INTROSPECTION_CLIENTS"), ",") {
+		client = strings.TrimSpace(client)
+		if client == "" {
+			continue
+		}
+
+		clientID, clientSecret, ok := strings.Cut(client, ":")
+		if !ok || clientID == "" || clientSecret == "" {
+			return IntrospectionConfig{},
+				fmt.Errorf("Invalid INTROSPECTION_CLIENTS entry: %s expected client_id:client_secret", clientID)
+		}
+		clients[clientID] = clientSecret
+	}
+
+	return IntrospectionConfig{
+		Clients: clients,
+	}, nil
+}
+
+func InitializeSessionConfig() (SessionConfig, error) {
+
+	// Zero or unset means unlimited sessions
+	maxSessions := 0
+	if maxSessionsStr := os.Getenv("MAX_SESSIONS_PER_USER"); maxSessionsStr != "" {
+		var err error
+		maxSessions, err = strconv.Atoi(maxSessionsStr)
+		if err != nil {
+			return SessionConfig{}, fmt.Errorf("Invalid MAX_SESSIONS_PER_USER: %v", err)
+		}
+	}
+
+	evictionPolicy := strings.ToLower(os.Getenv("SESSION_EVICTION_POLICY"))
+	if evictionPolicy == "" {
+		evictionPolicy = "evict_oldest"
+	}
+
+	return SessionConfig{
+		MaxSessions:    maxSessions,
+		EvictionPolicy: evictionPolicy,
+	}, nil
+}
+
+func InitializePasswordConfig() (PasswordConfig, error) {
+
+	minLength, err := getEnvInt("PASSWORD_MIN_LENGTH", 8)
+	if err != nil {
+		return PasswordConfig{}, err
+	}
+	memoryKiB, err := getEnvInt("ARGON2_MEMORY_KIB", 64*1024)
+	if err != nil {
+		return PasswordConfig{}, err
+	}
+	iterations, err := getEnvInt("ARGON2_ITERATIONS", 3)
+	if err != nil {
+		return PasswordConfig{}, err
+	}
+	parallelism, err := getEnvInt("ARGON2_PARALLELISM", 2)
+	if err != nil {
+		return PasswordConfig{}, err
+	}
+
+	if memoryKiB < 8*parallelism || iterations < 1 || parallelism < 1 || parallelism > 255 {
+		return PasswordConfig{}, fmt.Errorf("Invalid Argon2 parameters: m=%d, t=%d, p=%d", memoryKiB, iterations, parallelism)
+	}
+
+	return PasswordConfig{
+		MinLength:         minLength,
+		Argon2MemoryKiB:   uint32(memoryKiB),
+		Argon2Iterations:  uint32(iterations),
+		Argon2Parallelism: uint8(parallelism),
+	}, nil
+}
+
+func InitializeAuthenticatorConfig() (AuthenticatorConfig, error) {
+
+	chainStr := os.Getenv("AUTHENTICATORS")
+	if chainStr == "" {
+		chainStr = "local"
+	}
+
+	var chain []string
+	usesLDAP := false
+	for _, name := range strings.Split(chainStr, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "local":
+		case "ldap":
+			usesLDAP = true
+		default:
+			return AuthenticatorConfig{}, fmt.Errorf("Unknown authenticator in AUTHENTICATORS: %q", name)
+		}
+		chain = append(chain, name)
+	}
+
+	if !usesLDAP {
+		return AuthenticatorConfig{Chain: chain}, nil
+	}
+
+	ldapConfig := LDAPConfig{
+		URL:              os.Getenv("LDAP_URL"),
+		StartTLS:         strings.EqualFold(os.Getenv("LDAP_START_TLS"), "true"),
+		BindDN:           os.Getenv("LDAP_BIND_DN"),
+		BindPassword:     os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:           os.Getenv("LDAP_BASE_DN"),
+		UserFilter:       os.Getenv("LDAP_USER_FILTER"),
+		SubjectAttribute: os.Getenv("LDAP_SUBJECT_ATTRIBUTE"),
+	}
+	if ldapConfig.URL == "" || ldapConfig.BaseDN == "" {
+		return AuthenticatorConfig{}, fmt.Errorf("LDAP_URL and LDAP_BASE_DN are required by the ldap authenticator")
+	}
+	if ldapConfig.UserFilter == "" {
+		ldapConfig.UserFilter = "(uid={login})"
+	}
+	if ldapConfig.SubjectAttribute == "" {
+		ldapConfig.SubjectAttribute = "entryUUID"
+	}
+
+	timeoutSeconds, err := getEnvInt("LDAP_TIMEOUT_SECONDS", 5)
+	if err != nil {
+		return AuthenticatorConfig{}, err
+	}
+	ldapConfig.TimeoutSeconds = timeoutSeconds
+
+	return AuthenticatorConfig{
+		Chain: chain,
+		LDAP:  ldapConfig,
+	}, nil
+}
+
+func InitializeMFAConfig() (MFAConfig, error) {
+
+	encryptionKey, err := base64.StdEncoding.DecodeString(os.Getenv("MFA_ENCRYPTION_KEY"))
+	if err != nil {
+		return MFAConfig{}, fmt.Errorf("Invalid MFA_ENCRYPTION_KEY: %v", err)
+	}
+	if len(encryptionKey) != 32 {
+		return MFAConfig{}, fmt.Errorf("MFA_ENCRYPTION_KEY must be 32 bytes encoded with base64")
+	}
+
+	issuer := os.Getenv("MFA_TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Go Auth"
+	}
+
+	return MFAConfig{
+		EncryptionKey: encryptionKey,
+		TOTPIssuer:    issuer,
+	}, nil
 }
 
+func InitializeWebAuthnConfig() (WebAuthnConfig, error) {
+
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	if rpID == "" {
+		rpID = "localhost"
+	}
+
+	rpDisplayName := os.Getenv("WEBAUTHN_RP_DISPLAY_NAME")
+	if rpDisplayName == "" {
+		rpDisplayName = "Go Auth"
+	}
+
+	var rpOrigins []string
+	for _, origin := range strings.Split(os.Getenv("WEBAUTHN_RP_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			rpOrigins = append(rpOrigins, origin)
+		}
+	}
+	if len(rpOrigins) == 0 {
+		rpOrigins = []string{"http://localhost:8000"}
+	}
+
+	attestation := strings.ToLower(os.Getenv("WEBAUTHN_ATTESTATION"))
+	switch attestation {
+	case "":
+		attestation = "none"
+	case "none", "direct":
+	default:
+		return WebAuthnConfig{}, fmt.Errorf("Invalid WEBAUTHN_ATTESTATION: %q, expected none or direct", attestation)
+	}
+
+	return WebAuthnConfig{
+		RPID:          rpID,
+		RPDisplayName: rpDisplayName,
+		RPOrigins:     rpOrigins,
+		Attestation:   attestation,
+	}, nil
+}
+
+func InitializeMailConfig() (MailConfig, error) {
+
+	transport := strings.ToLower(os.Getenv("MAIL_TRANSPORT"))
+	switch transport {
+	case "":
+		transport = "file"
+	case "smtp", "file":
+	default:
+		return MailConfig{}, fmt.Errorf("Invalid MAIL_TRANSPORT: %q, expected smtp or file", transport)
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	fileDir := os.Getenv("MAIL_FILE_DIR")
+	if fileDir == "" {
+		fileDir = "mail"
+	}
+
+	smtpHost := os.Getenv("SMTP_HOST")
+	if transport == "smtp" && smtpHost == "" {
+		return MailConfig{}, fmt.Errorf("SMTP_HOST is required for MAIL_TRANSPORT=smtp")
+	}
+
+	smtpPort, err := getEnvInt("SMTP_PORT", 587)
+	if err != nil {
+		return MailConfig{}, err
+	}
+
+	return MailConfig{
+		Transport:    transport,
+		From:         from,
+		FileDir:      fileDir,
+		SMTPHost:     smtpHost,
+		SMTPPort:     smtpPort,
+		SMTPUsername: os.Getenv("SMTP_USERNAME"),
+		SMTPPassword: os.Getenv("SMTP_PASSWORD"),
+		AppURL:       publicAppURL(),
+	}, nil
+}
+
+func InitializeOAuthConfig() (OAuthConfig, error) {
+
+	loginURL := os.Getenv("OAUTH_LOGIN_URL")
+	if loginURL == "" {
+		loginURL = strings.TrimSuffix(publicAppURL(), "/") + "/login"
+	}
+
+	parsedURL, err := url.Parse(loginURL)
+	if err != nil || !parsedURL.IsAbs() || parsedURL.RawQuery != "" || parsedURL.Fragment != "" {
+		return OAuthConfig{}, fmt.Errorf("Invalid OAUTH_LOGIN_URL: %s, expected an absolute URL without query", loginURL)
+	}
+
+	issuer := os.Getenv("OAUTH_ISSUER")
+	if issuer == "" {
+		issuer = "http://localhost:8000"
+	}
+	if parsedURL, err := url.Parse(issuer); err != nil || !parsedURL.IsAbs() || parsedURL.RawQuery != "" {
+		return OAuthConfig{}, fmt.Errorf("Invalid OAUTH_ISSUER: %s, expected an absolute URL without query", issuer)
+	}
+
+	maxClientTokenTTLMinutes, err := getEnvInt("OAUTH_MAX_CLIENT_TOKEN_TTL_MINUTES", 60)
+	if err != nil {
+		return OAuthConfig{}, err
+	}
+	if maxClientTokenTTLMinutes < 1 {
+		return OAuthConfig{}, fmt.Errorf("Invalid OAUTH_MAX_CLIENT_TOKEN_TTL_MINUTES: %d, expected at least 1", maxClientTokenTTLMinutes)
+	}
+
+	deviceVerificationURL := os.Getenv("OAUTH_DEVICE_VERIFICATION_URL")
+	if deviceVerificationURL == "" {
+		deviceVerificationURL = strings.TrimSuffix(publicAppURL(), "/") + "/device"
+	}
+	parsedURL, err = url.Parse(deviceVerificationURL)
+	if err != nil || !parsedURL.IsAbs() || parsedURL.RawQuery != "" || parsedURL.Fragment != "" {
+		return OAuthConfig{}, fmt.Errorf("Invalid OAUTH_DEVICE_VERIFICATION_URL: %s, expected an absolute URL without query", deviceVerificationURL)
+	}
+
+	return OAuthConfig{
+		LoginURL:                 loginURL,
+		Issuer:                   strings.TrimSuffix(issuer, "/"),
+		MaxClientTokenTTLMinutes: maxClientTokenTTLMinutes,
+		DeviceVerificationURL:    deviceVerificationURL,
+	}, nil
+}
+
+// publicAppURL is the address of the frontend from APP_PUBLIC_URL.
+func publicAppURL() string {
+	appURL := os.Getenv("APP_PUBLIC_URL")
+	if appURL == "" {
+		return "http://localhost:8000"
+	}
+	return appURL
+}
+
+func InitializeEmailLoginConfig() (EmailLoginConfig, error) {
+
+	codeTTLMinutes, err := getEnvInt("EMAIL_LOGIN_CODE_TTL_MINUTES", 10)
+	if err != nil {
+		return EmailLoginConfig{}, err
+	}
+	if codeTTLMinutes < 1 {
+		return EmailLoginConfig{}, fmt.Errorf("Invalid EMAIL_LOGIN_CODE_TTL_MINUTES: %d, expected at least 1", codeTTLMinutes)
+	}
+
+	rateLimit, err := getEnvInt("EMAIL_LOGIN_RATE_LIMIT", 3)
+	if err != nil {
+		return EmailLoginConfig{}, err
+	}
+	if rateLimit < 1 {
+		return EmailLoginConfig{}, fmt.Errorf("Invalid EMAIL_LOGIN_RATE_LIMIT: %d, expected at least 1", rateLimit)
+	}
+
+	rateWindowMinutes, err := getEnvInt("EMAIL_LOGIN_RATE_WINDOW_MINUTES", 15)
+	if err != nil {
+		return EmailLoginConfig{}, err
+	}
+	if rateWindowMinutes < 1 {
+		return EmailLoginConfig{}, fmt.Errorf("Invalid EMAIL_LOGIN_RATE_WINDOW_MINUTES: %d, expected at least 1", rateWindowMinutes)
+	}
+
+	return EmailLoginConfig{
+		CodeTTLMinutes:    codeTTLMinutes,
+		RateLimit:         rateLimit,
+		RateWindowMinutes: rateWindowMinutes,
+	}, nil
+}
+
+// getEnvInt reads an integer env variable, unset means the default value.
+func getEnvInt(name string, defaultValue int) (int, error) {
+	valueStr := os.Getenv(name)
+	if valueStr == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s: %v", name, err)
+	}
+	return value, nil
+}
+
+func InitializeRefreshCookieConfig() (RefreshCookieConfig, error) {
+
+	var enabled bool
+	switch delivery := strings.ToLower(os.Getenv("REFRESH_TOKEN_DELIVERY")); delivery {
+	case "", "body":
+	case "cookie":
+		enabled = true
+	default:
+		return RefreshCookieConfig{}, fmt.Errorf("Invalid REFRESH_TOKEN_DELIVERY: %q, expected body or cookie", delivery)
+	}
+
+	name := os.Getenv("REFRESH_COOKIE_NAME")
+	if name == "" {
+		name = "refresh_token"
+	}
+	csrfName := os.Getenv("CSRF_COOKIE_NAME")
+	if csrfName == "" {
+		csrfName = "csrf_token"
+	}
+	if name == csrfName {
+		return RefreshCookieConfig{}, fmt.Errorf("REFRESH_COOKIE_NAME and CSRF_COOKIE_NAME must differ")
+	}
+
+	var sameSite string
+	switch strings.ToLower(os.Getenv("REFRESH_COOKIE_SAMESITE")) {
+	case "", "strict":
+		sameSite = "Strict"
+	case "lax":
+		sameSite = "Lax"
+	case "none":
+		sameSite = "None"
+	default:
+		return RefreshCookieConfig{}, fmt.Errorf("Invalid REFRESH_COOKIE_SAMESITE: %q, expected strict, lax or none", os.Getenv("REFRESH_COOKIE_SAMESITE"))
+	}
+
+	return RefreshCookieConfig{
+		Enabled:  enabled,
+		Name:     name,
+		CSRFName: csrfName,
+		Domain:   os.Getenv("REFRESH_COOKIE_DOMAIN"),
+		SameSite: sameSite,
+	}, nil
+}
+
+func InitializeAdminConfig() (AdminConfig, error) {
+
+	return AdminConfig{
+		APIToken: os.Getenv("ADMIN_API_TOKEN"),
+	}, nil
+}
 
 func InitializeServerConfig() (ServerConfig, error) {
 
+	files := map[string][]byte{}
+	for _, name := range []string{"TLS_CERT_PATH", "TLS_KEY_PATH", "TLS_CLIENT_CA_PATH"} {
+		path := os.Getenv(name)
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return ServerConfig{}, fmt.Errorf("Failed to read %s: %v", name, err)
+		}
+		files[name] = content
+	}
+
+	if (files["TLS_CERT_PATH"] == nil) != (files["TLS_KEY_PATH"] == nil) {
+		return ServerConfig{}, fmt.Errorf("TLS_CERT_PATH and TLS_KEY_PATH must be set together")
+	}
+	if files["TLS_CLIENT_CA_PATH"] != nil && files["TLS_CERT_PATH"] == nil {
+		return ServerConfig{}, fmt.Errorf("TLS_CLIENT_CA_PATH needs TLS_CERT_PATH and TLS_KEY_PATH")
+	}
+
 	return ServerConfig{
-		Title: os.Getenv("APP_NAME"),
-		Port:  os.Getenv("APPLICATION_PORT"),
+		Title:          os.Getenv("APP_NAME"),
+		Port:           os.Getenv("APPLICATION_PORT"),
+		TLSCertPEM:     files["TLS_CERT_PATH"],
+		TLSKeyPEM:      files["TLS_KEY_PATH"],
+		TLSClientCAPEM: files["TLS_CLIENT_CA_PATH"],
 	}, nil
 }
@@ -45,7 +45,7 @@ func ConnectToDatabase(databaseConfig core.DatabaseConfig, logger *slog.Logger)
 
 	// run migrations
 	if err := goose.Up(db, "./migrations"); err != nil {
-    		logger.Error("goose up failed: %v", err)
+    		logger.Error("goose up failed", "error", err)
     	}
 
 	logger.Debug("Successfully connected to Database.")
@@ -0,0 +1,151 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" example:"john@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	// Token from the password reset mail
+	Token    string `json:"token" example:"cmVzZXQgdG9rZW4gZnJvbSB0aGUgbWFpbA"`
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
+type VerifyEmailRequest struct {
+	// Token from the verification mail
+	Token string `json:"token" example:"dmVyaWZpY2F0aW9uIHRva2VuIGZyb20gbWFpbA"`
+}
+
+// @Summary      Request a password reset
+// @Description  Mails a password reset link valid for 30 minutes. The response is the same whether the email is registered or not.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        email body ForgotPasswordRequest true "Email of the account"
+// @Success      202 {object} SuccessResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/password/forgot [post]
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email is required"})
+	}
+
+	if err := h.userService.RequestPasswordReset(c.Context(), req.Email); err != nil {
+		logger.Error("Password reset request error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not request password reset"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "if the email is registered, a reset link was sent"})
+}
+
+// @Summary      Reset the password
+// @Description  Sets a new password with the token of the reset mail. The token works once. All sessions and API keys of the user are revoked and the access tokens of the sessions are blocked.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        reset body ResetPasswordRequest true "Reset token and new password"
+// @Success      200 {object} SuccessResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Invalid or expired token"
+// @Failure      422 {object} ErrorResponse "Password doesn't meet the policy"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/password/reset [post]
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token is required"})
+	}
+
+	userID, err := h.userService.ResetPassword(c.Context(), req.Token, req.Password, h.authService.AccessTokenTTL())
+	if errors.Is(err, services.ErrInvalidActionToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is invalid or expired"})
+	} else if errors.Is(err, services.ErrWeakPassword) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "password is too short or too long"})
+	} else if err != nil {
+		logger.Error("Password reset error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not reset password"})
+	}
+
+	h.authService.NotifySecurityEventWebhook(services.SecurityEventPasswordReset, userID, nil)
+	return c.JSON(fiber.Map{"message": "password changed"})
+}
+
+// @Summary      Resend the verification mail
+// @Description  Mails a new email verification link valid for 24 hours. Earlier links stop working.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Success      202 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      409 {object} ErrorResponse "Email already verified"
+// @Failure      422 {object} ErrorResponse "User has no email"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/email/verify [post]
+func (h *AuthHandler) RequestEmailVerification(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	err := h.userService.RequestEmailVerification(c.Context(), userID)
+	if errors.Is(err, services.ErrEmailAlreadyVerified) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "email already verified"})
+	} else if errors.Is(err, services.ErrNoEmail) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "user has no email"})
+	} else if err != nil {
+		logger.Error("Email verification request error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not send verification mail"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "verification mail sent"})
+}
+
+// @Summary      Verify the email
+// @Description  Marks the email as verified with the token of the verification mail. The token works once and only while the email is unchanged.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        verification body VerifyEmailRequest true "Verification token"
+// @Success      200 {object} SuccessResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Invalid or expired token"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/email/verify [post]
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req VerifyEmailRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token is required"})
+	}
+
+	err := h.userService.VerifyEmail(c.Context(), req.Token)
+	if errors.Is(err, services.ErrInvalidActionToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is invalid or expired"})
+	} else if err != nil {
+		logger.Error("Email verification error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not verify email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "email verified"})
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type RotateSigningKeyRequest struct {
+	Algorithm string `json:"algorithm" example:"ES256"`
+}
+
+type RotateSigningKeyResponse struct {
+	KID         string   `json:"kid" example:"b7f0c7d2-7c4e-4a57-9d7e-2a8f1c6e3f10"`
+	DeletedKIDs []string `json:"deleted_kids"`
+}
+
+// @Summary      Rotate signing key
+// @Description  Promotes a new access token signing key. Retired keys keep verifying tokens until the max access TTL has passed, older retired keys are deleted.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        request body RotateSigningKeyRequest false "Algorithm of the new key, the current one by default"
+// @Success      200 {object} RotateSigningKeyResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      422 {object} ErrorResponse "Unsupported algorithm"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/keys/rotate [post]
+func (h *AuthHandler) RotateSigningKey(c *fiber.Ctx) error {
+	var req RotateSigningKeyRequest
+	if reqBytes := c.Request().Body(); len(reqBytes) > 0 {
+		if err := json.Unmarshal(reqBytes, &req); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "request body is invalid format"})
+		}
+	}
+
+	kid, deletedKIDs, err := h.authService.RotateSigningKey(c.Context(), req.Algorithm)
+	if errors.Is(err, services.ErrUnsupportedAlgorithm) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unsupported algorithm"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not rotate signing key"})
+	}
+
+	logger.Info("Signing key rotated", "kid", kid, "deleted_kids", deletedKIDs)
+	return c.JSON(fiber.Map{
+		"kid":          kid,
+		"deleted_kids": deletedKIDs,
+	})
+}
@@ -0,0 +1,208 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" example:"CI deploy"`
+	// Scopes must be permissions of the user or scopes of the service account
+	Scopes []string `json:"scopes" example:"articles:read"`
+	// ExpiresAt is omitted for keys that never expire
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2027-10-17T00:00:00Z"`
+}
+
+type APIKeyResponse struct {
+	ID string `json:"id" example:"5c3e7a1d-2b4f-4e8a-9d6c-1f0a2b3c4d5e"`
+	// Key is returned only on creation
+	Key        string     `json:"key,omitempty" example:"bga_1a2b3c4d5e6f_c2VjcmV0IHNob3duIG9uY2U"`
+	Prefix     string     `json:"prefix" example:"1a2b3c4d5e6f"`
+	Name       string     `json:"name" example:"CI deploy"`
+	Scopes     []string   `json:"scopes" example:"articles:read"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" example:"2027-10-17T00:00:00Z"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" example:"2026-10-17T16:00:00Z"`
+	LastUsedIP string     `json:"last_used_ip,omitempty" example:"203.0.113.7"`
+	CreatedAt  time.Time  `json:"created_at" example:"2026-10-17T16:00:00Z"`
+}
+
+// @Summary      Create an API key
+// @Description  Creates a long-lived key sent as "Authorization: ApiKey {key}". The key is shown only in this response. Its scopes must be permissions of the user, and a request made with it gets only the scopes the user still has. Keys are created only in the user's own session, not with an API key or a token of another party, so a leaked credential can't outlive its revocation.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        key body CreateAPIKeyRequest true "Name, scopes and expiry"
+// @Success      201 {object} APIKeyResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      422 {object} ErrorResponse "Invalid name, scopes or expiry"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/api-keys [post]
+func (h *AuthHandler) CreateAPIKey(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	return h.createAPIKey(c, services.APIKeyOwner{UserID: userID})
+}
+
+// @Summary      List API keys
+// @Description  Returns the API keys of the current user with their last use. Keys themselves are never returned.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Success      200 {array} APIKeyResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/api-keys [get]
+func (h *AuthHandler) ListAPIKeys(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	return h.listAPIKeys(c, services.APIKeyOwner{UserID: userID})
+}
+
+// @Summary      Revoke an API key
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        id path string true "API key ID" Format(uuid)
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      404 {object} ErrorResponse "API key not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/api-keys/{id} [delete]
+func (h *AuthHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	return h.revokeAPIKey(c, services.APIKeyOwner{UserID: userID}, c.Params("id"))
+}
+
+// @Summary      Create an API key of a service account
+// @Description  Creates a long-lived key of a client with the client_credentials grant. The key is shown only in this response, its scopes must be scopes of the client.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "Client ID"
+// @Param        key body CreateAPIKeyRequest true "Name, scopes and expiry"
+// @Success      201 {object} APIKeyResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "Client not found"
+// @Failure      422 {object} ErrorResponse "Invalid name, scopes or expiry, or the client is not a service account"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/oauth/clients/{id}/api-keys [post]
+func (h *AuthHandler) CreateClientAPIKey(c *fiber.Ctx) error {
+	return h.createAPIKey(c, services.APIKeyOwner{ClientID: c.Params("id")})
+}
+
+// @Summary      List API keys of a service account
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "Client ID"
+// @Success      200 {array} APIKeyResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/oauth/clients/{id}/api-keys [get]
+func (h *AuthHandler) ListClientAPIKeys(c *fiber.Ctx) error {
+	return h.listAPIKeys(c, services.APIKeyOwner{ClientID: c.Params("id")})
+}
+
+// @Summary      Revoke an API key of a service account
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "Client ID"
+// @Param        key_id path string true "API key ID" Format(uuid)
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "API key not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/oauth/clients/{id}/api-keys/{key_id} [delete]
+func (h *AuthHandler) RevokeClientAPIKey(c *fiber.Ctx) error {
+	return h.revokeAPIKey(c, services.APIKeyOwner{ClientID: c.Params("id")}, c.Params("key_id"))
+}
+
+func (h *AuthHandler) createAPIKey(c *fiber.Ctx, owner services.APIKeyOwner) error {
+	var req CreateAPIKeyRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "request body is invalid format"})
+	}
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+	}
+
+	key, rawKey, err := h.apiKeyService.CreateKey(c.Context(), owner, req.Name, req.Scopes, expiresAt)
+	if errors.Is(err, services.ErrOAuthClientNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "client not found"})
+	} else if errors.Is(err, services.ErrInvalidAPIKeyMetadata) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid api key: name, scopes or expiry"})
+	} else if err != nil {
+		logger.Error("Create API key error", "user_id", owner.UserID, "client_id", owner.ClientID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create api key"})
+	}
+
+	response := apiKeyResponse(key)
+	response.Key = rawKey
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func (h *AuthHandler) listAPIKeys(c *fiber.Ctx, owner services.APIKeyOwner) error {
+	keys, err := h.apiKeyService.ListKeys(c.Context(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not list api keys"})
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponse(key))
+	}
+	return c.JSON(response)
+}
+
+func (h *AuthHandler) revokeAPIKey(c *fiber.Ctx, owner services.APIKeyOwner, id string) error {
+	err := h.apiKeyService.RevokeKey(c.Context(), owner, id)
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "api key not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke api key"})
+	}
+
+	return c.JSON(fiber.Map{"message": "api key revoked"})
+}
+
+func apiKeyResponse(key services.APIKey) APIKeyResponse {
+	response := APIKeyResponse{
+		ID:         key.ID,
+		Prefix:     key.Prefix,
+		Name:       key.Name,
+		Scopes:     key.Scopes,
+		LastUsedIP: key.LastUsedIP,
+		CreatedAt:  key.CreatedAt,
+	}
+	if !key.ExpiresAt.IsZero() {
+		response.ExpiresAt = &key.ExpiresAt
+	}
+	if !key.LastUsedAt.IsZero() {
+		response.LastUsedAt = &key.LastUsedAt
+	}
+	return response
+}
@@ -0,0 +1,142 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+// DeviceAuthorizationResponse is the response of the device authorization endpoint (RFC 8628, section 3.2).
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code" example:"GmRhmhcxhwAzkoEqiMEg_DnyEysNkuNhszIySk9eS"`
+	UserCode                string `json:"user_code" example:"WDJB-MJHT"`
+	VerificationURI         string `json:"verification_uri" example:"http://localhost:8000/device"`
+	VerificationURIComplete string `json:"verification_uri_complete" example:"http://localhost:8000/device?user_code=WDJB-MJHT"`
+	ExpiresIn               int    `json:"expires_in" example:"600"`
+	Interval                int    `json:"interval" example:"5"`
+}
+
+type DeviceRequestResponse struct {
+	ClientID   string   `json:"client_id" example:"3f8b2a8e-7f1c-4a0e-9c1d-5b2e8f4a6d10"`
+	ClientName string   `json:"client_name" example:"Deploy CLI"`
+	Scope      []string `json:"scope" example:"openid,articles:read"`
+}
+
+type DeviceDecisionRequest struct {
+	UserCode string `json:"user_code" example:"WDJB-MJHT"`
+	// Approve is false to deny the request
+	Approve bool `json:"approve" example:"true"`
+}
+
+// @Summary      OAuth device authorization endpoint
+// @Description  Starts the device flow (RFC 8628) for clients with the urn:ietf:params:oauth:grant-type:device_code grant. The device shows the user code and the verification URI, then polls the token endpoint with the device code every interval seconds, with the User-Agent of this request.
+// @Tags         OAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Security     BasicAuth
+// @Param        client_id formData string false "Client ID, if not sent with HTTP Basic"
+// @Param        client_secret formData string false "Client secret of confidential clients, if not sent with HTTP Basic"
+// @Param        scope formData string false "Space separated scopes"
+// @Success      200 {object} DeviceAuthorizationResponse
+// @Failure      400 {object} OAuthErrorResponse "invalid_request, invalid_scope or unauthorized_client"
+// @Failure      401 {object} OAuthErrorResponse "invalid_client"
+// @Failure      500 {object} OAuthErrorResponse "Internal server error"
+// @Router       /oauth/device_authorization [post]
+func (h *AuthHandler) OAuthDeviceAuthorization(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	client, err := h.authenticateOAuthClient(c)
+	if err != nil {
+		return oauthTokenError(c, err)
+	}
+
+	userAgent := string(c.Request().Header.UserAgent())
+	authorization, err := h.oauthService.AuthorizeDevice(c.Context(), client, c.FormValue("scope"), userAgent)
+	if err != nil {
+		return oauthTokenError(c, err)
+	}
+
+	return c.JSON(DeviceAuthorizationResponse{
+		DeviceCode:              authorization.DeviceCode,
+		UserCode:                authorization.UserCode,
+		VerificationURI:         authorization.VerificationURI,
+		VerificationURIComplete: authorization.VerificationURIComplete,
+		ExpiresIn:               int(authorization.ExpiresIn.Seconds()),
+		Interval:                int(authorization.Interval.Seconds()),
+	})
+}
+
+// @Summary      Get a device request
+// @Description  Returns the client and the scope of the pending device request with the user code, for the verification page to show before the user decides.
+// @Tags         OAuth
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        user_code query string true "User code shown by the device, case and dashes don't matter"
+// @Success      200 {object} DeviceRequestResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      404 {object} ErrorResponse "Unknown, expired or decided user code"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /oauth/device [get]
+func (h *AuthHandler) GetDeviceRequest(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	request, err := h.oauthService.DeviceRequest(c.Context(), c.Query("user_code"))
+	if errors.Is(err, services.ErrDeviceCodeNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user code is invalid or expired"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not get device request"})
+	}
+
+	return c.JSON(DeviceRequestResponse{
+		ClientID:   request.ClientID,
+		ClientName: request.ClientName,
+		Scope:      request.Scope,
+	})
+}
+
+// @Summary      Approve or deny a device request
+// @Description  Decides the pending device request with the user code on behalf of the current user. The device gets tokens with the requested scope the user has permissions for on its next poll.
+// @Tags         OAuth
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        decision body DeviceDecisionRequest true "User code and decision"
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      404 {object} ErrorResponse "Unknown, expired or decided user code"
+// @Failure      422 {object} ErrorResponse "Invalid request body"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /oauth/device [post]
+func (h *AuthHandler) DecideDeviceRequest(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	var req DeviceDecisionRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "request body is invalid format"})
+	}
+
+	authentication, _ := c.Locals("authentication").(services.Authentication)
+	err := h.oauthService.DecideDeviceRequest(c.Context(), userID, authentication, req.UserCode, req.Approve)
+	if errors.Is(err, services.ErrDeviceCodeNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user code is invalid or expired"})
+	} else if err != nil {
+		logger.Error("Device request decision error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not decide device request"})
+	}
+
+	if !req.Approve {
+		return c.JSON(fiber.Map{"message": "device request denied"})
+	}
+	return c.JSON(fiber.Map{"message": "device request approved"})
+}
@@ -0,0 +1,117 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type EmailLoginRequest struct {
+	Email string `json:"email" example:"john@example.com"`
+}
+
+// EmailLoginVerifyRequest takes either the token of the login link or the
+// email together with the code.
+type EmailLoginVerifyRequest struct {
+	// Token from the login link
+	Token string `json:"token,omitempty" example:"bG9naW4gbGluayB0b2tlbiBmcm9tIHRoZSBtYWls"`
+	Email string `json:"email,omitempty" example:"john@example.com"`
+	Code  string `json:"code,omitempty" example:"123456"`
+}
+
+// @Summary      Request an email login
+// @Description  Mails a login link and a 6-digit code to a registered email. Both work once, for a few minutes, and only with the User-Agent of this request. The response is the same whether the email is registered or not.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        email body EmailLoginRequest true "Email of the account"
+// @Success      202 {object} SuccessResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      429 {object} ErrorResponse "Too many requests for the email"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/email-login [post]
+func (h *AuthHandler) RequestEmailLogin(c *fiber.Ctx) error {
+	var req EmailLoginRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if strings.TrimSpace(req.Email) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email is required"})
+	}
+
+	userAgent := string(c.Request().Header.UserAgent())
+
+	err := h.emailLoginService.RequestLogin(c.Context(), req.Email, userAgent)
+	if errors.Is(err, services.ErrEmailLoginRateLimited) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many login requests for this email, try again later"})
+	} else if err != nil {
+		logger.Error("Email login request error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not request email login"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "if the email is registered, a login link was sent"})
+}
+
+// @Summary      Complete an email login
+// @Description  Exchanges the token of the login link, or the email and the code from the mail, for a token pair. A code is dropped after 5 wrong attempts. Users with TOTP enabled get an MFA challenge token instead.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        login body EmailLoginVerifyRequest true "Link token, or email and code"
+// @Param        DPoP header string false "DPoP proof (RFC 9449) for POST of this URL, binds the session to its key"
+// @Success      200 {object} TokenPairResponse
+// @Success      202 {object} MFAChallengeResponse "Second factor required"
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Invalid or expired code, another User-Agent or invalid DPoP proof"
+// @Failure      409 {object} ErrorResponse "Maximum number of sessions reached"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/email-login/verify [post]
+func (h *AuthHandler) VerifyEmailLogin(c *fiber.Ctx) error {
+	var req EmailLoginVerifyRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.Token == "" && (req.Email == "" || req.Code == "") {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "token, or email and code are required"})
+	}
+
+	ipAddress := h.getFirstValidIP(c)
+	userAgent := string(c.Request().Header.UserAgent())
+
+	// Create a new context and add IP and User-Agent to it
+	ctxWithData := context.WithValue(c.Context(), ipAddressContextKey, ipAddress)
+	ctxWithData = context.WithValue(ctxWithData, userAgentContextKey, userAgent)
+
+	binding, err := h.loginBinding(c)
+	if err != nil {
+		return dpopProofError(c, err)
+	}
+
+	var userID string
+	if req.Token != "" {
+		userID, err = h.emailLoginService.LoginWithLink(ctxWithData, req.Token, userAgent)
+	} else {
+		userID, err = h.emailLoginService.LoginWithCode(ctxWithData, req.Email, req.Code, userAgent)
+	}
+	if errors.Is(err, services.ErrInvalidEmailLoginCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "login code is invalid or expired"})
+	} else if errors.Is(err, services.ErrUserAgentMismatch) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "login code was requested from another browser"})
+	} else if err != nil {
+		logger.Error("Email login error", "error", err, "ip_address", ipAddress)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not verify login code"})
+	}
+
+	result, err := h.authService.StartSession(ctxWithData, userID, services.AuthMethodEmail, ipAddress, userAgent, binding)
+	if errors.Is(err, services.ErrSessionLimitReached) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "maximum number of sessions reached"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate tokens"})
+	}
+
+	return h.loginResponse(c, result)
+}
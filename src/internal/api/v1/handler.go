@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"time"
 
 	"context" // Import context package
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
 	"github.com/nikuIin/base_go_auth/src/core"
 	"github.com/nikuIin/base_go_auth/src/internal/services"
 )
@@ -19,14 +19,29 @@ type ErrorResponse struct {
 }
 
 type TokenPairResponse struct {
-	AccessToken  string `json:"access_token" example:"eyJhbGciOiJIUzUxMiIsInR5cCI6IkpXVCJ9..."`
-	RefreshToken string `json:"refresh_token" example:"V29uZGVyZnVsIHJlZnJlc2ggdG9rZW4h"`
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzUxMiIsInR5cCI6IkpXVCJ9..."`
+	// RefreshToken is omitted in cookie mode, the refresh cookie holds it
+	RefreshToken string `json:"refresh_token,omitempty" example:"V29uZGVyZnVsIHJlZnJlc2ggdG9rZW4h"`
+	// CSRFToken is sent back in the X-CSRF-Token header to refresh with the cookie
+	CSRFToken string `json:"csrf_token,omitempty" example:"q8Kf3x0m2vRk1ZyC7nH5tWb9pLs4dE6aJ0uGiOyTcXw"`
 }
 
 type RefreshTokenRequest struct {
 	RefreshToken string `json:"refresh_token" example:"V29uZGVyZnVsIHJlZnJlc2ggdG9rZW4h"`
 }
 
+type RegisterRequest struct {
+	Username string `json:"username" example:"john_doe"`
+	Email    string `json:"email" example:"john@example.com"`
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
+type LoginRequest struct {
+	// Username or email
+	Login    string `json:"login" example:"john_doe"`
+	Password string `json:"password" example:"correct horse battery staple"`
+}
+
 type UserGUIDResponse struct {
 	UserID string `json:"user_id" example:"a1b2c3d4-e5f6-7890-1234-567890abcdef"`
 }
@@ -36,11 +51,39 @@ type SuccessResponse struct {
 }
 
 type AuthHandler struct {
-	authService *services.AuthService
+	authService       *services.AuthService
+	userService       *services.UserService
+	mfaService        *services.MFAService
+	webAuthnService   *services.WebAuthnService
+	emailLoginService *services.EmailLoginService
+	roleService       *services.RoleService
+	oauthService      *services.OAuthService
+	apiKeyService     *services.APIKeyService
+	refreshCookie     core.RefreshCookieConfig
 }
 
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(
+	authService *services.AuthService,
+	userService *services.UserService,
+	mfaService *services.MFAService,
+	webAuthnService *services.WebAuthnService,
+	emailLoginService *services.EmailLoginService,
+	roleService *services.RoleService,
+	oauthService *services.OAuthService,
+	apiKeyService *services.APIKeyService,
+	refreshCookie core.RefreshCookieConfig,
+) *AuthHandler {
+	return &AuthHandler{
+		authService:       authService,
+		userService:       userService,
+		mfaService:        mfaService,
+		webAuthnService:   webAuthnService,
+		emailLoginService: emailLoginService,
+		roleService:       roleService,
+		oauthService:      oauthService,
+		apiKeyService:     apiKeyService,
+		refreshCookie:     refreshCookie,
+	}
 }
 
 const (
@@ -66,66 +109,142 @@ func init() {
 }
 
 
-// @Summary      Generate a new token pair
-// @Description  Generates a new access and refresh token pair for a given user ID.
+// @Summary      Register a new user
+// @Description  Creates a user with a username, email and password.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
-// @Param        user_id query string true "User GUID" Format(uuid)
-// @Success      200 {object} TokenPairResponse
-// @Failure      400 {object} ErrorResponse "Invalid request: user_id is required"
-// @Failure      422 {object} ErrorResponse "Invalid request: user_id must be a valid UUID"
+// @Param        user body RegisterRequest true "New user"
+// @Success      201 {object} UserGUIDResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      409 {object} ErrorResponse "User already exists"
+// @Failure      422 {object} ErrorResponse "Invalid username, email or password"
 // @Failure      500 {object} ErrorResponse "Internal server error"
-// @Router       /api/v1/auth/token [post]
-func (h *AuthHandler) GenerateTokenPair(c *fiber.Ctx) error {
-	userID := c.Query("user_id")
-	if userID == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "user_id is required"})
+// @Router       /api/v1/auth/register [post]
+func (h *AuthHandler) Register(c *fiber.Ctx) error {
+	var req RegisterRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+
+	userID, err := h.userService.Register(c.Context(), req.Username, req.Email, req.Password)
+	if errors.Is(err, services.ErrUserAlreadyExists) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "user already exists"})
+	} else if errors.Is(err, services.ErrInvalidUsername) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "username must be 3-64 characters: letters, digits, '_', '.', '-'"})
+	} else if errors.Is(err, services.ErrInvalidEmail) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "email is invalid"})
+	} else if errors.Is(err, services.ErrWeakPassword) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "password is too short or too long"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not register user"})
 	}
 
-	// Add UUID validation check
-	if _, err := uuid.Parse(userID); err != nil {
-		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "user_id must be a valid UUID"})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"user_id": userID})
+}
+
+// @Summary      Log in with a password
+// @Description  Checks the password of the user with the username or email and generates a new access and refresh token pair.
+// @Description  Users with MFA enabled get an MFA challenge token instead, the pair is issued by /api/v1/auth/login/mfa.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        credentials body LoginRequest true "Username or email and password"
+// @Param        DPoP header string false "DPoP proof (RFC 9449) for POST of this URL, binds the session to its key"
+// @Success      200 {object} TokenPairResponse
+// @Success      202 {object} MFAChallengeResponse "Second factor required"
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Invalid credentials or DPoP proof"
+// @Failure      409 {object} ErrorResponse "Maximum number of sessions reached"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/login [post]
+func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	var req LoginRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.Login == "" || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "login and password are required"})
 	}
 
 	ipAddress := h.getFirstValidIP(c)
 	userAgent := string(c.Request().Header.UserAgent())
 
-	logger.Info("Generate new tokens pair", "user_id", userID, "ip_address", ipAddress, "user_agent", userAgent)
-
 	// Create a new context and add IP and User-Agent to it
 	ctxWithData := context.WithValue(c.Context(), ipAddressContextKey, ipAddress)
 	ctxWithData = context.WithValue(ctxWithData, userAgentContextKey, userAgent)
 
-	accessToken, refreshToken, err := h.authService.GenerateTokens(ctxWithData, userID, ipAddress, userAgent)
+	binding, err := h.loginBinding(c)
 	if err != nil {
+		return dpopProofError(c, err)
+	}
+
+	result, err := h.authService.Login(ctxWithData, req.Login, req.Password, ipAddress, userAgent, binding)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid login or password"})
+	} else if errors.Is(err, services.ErrSessionLimitReached) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "maximum number of sessions reached"})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate tokens"})
 	}
 
-	return c.JSON(fiber.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+	return h.loginResponse(c, result)
+}
+
+// loginResponse returns the token pair, or the MFA challenge with 202 Accepted.
+func (h *AuthHandler) loginResponse(c *fiber.Ctx, result services.LoginResult) error {
+	if result.MFAChallenge != nil {
+		return c.Status(fiber.StatusAccepted).JSON(MFAChallengeResponse{
+			MFAToken:  result.MFAChallenge.Token,
+			ExpiresIn: int(time.Until(result.MFAChallenge.ExpiresAt).Seconds()),
+		})
+	}
+
+	return h.tokenPairResponse(c, result.AccessToken, result.RefreshToken)
+}
+
+// loginBinding binds a new first-party session to the key of the DPoP proof
+// sent with the login, like the token endpoint does for OAuth clients.
+func (h *AuthHandler) loginBinding(c *fiber.Ctx) (services.TokenBinding, error) {
+	dpopJKT, err := h.dpopKey(c)
+	if err != nil {
+		return services.TokenBinding{}, err
+	}
+	return services.TokenBinding{DPoPJKT: dpopJKT}, nil
 }
 
 // @Summary      Refresh a token pair
-// @Description  Refreshes an existing token pair using a valid refresh token.
+// @Description  Refreshes an existing token pair using a valid refresh token. In cookie mode the refresh token may come from the refresh cookie instead of the body, the request then needs the CSRF token in the X-CSRF-Token header and works without an access token, for SPAs that lost it on reload. A session bound to a DPoP key is refreshed with "Authorization: DPoP {access_token}" and a proof of the key, a bearer session refreshed with a DPoP proof gets bound to its key. A session bound to a TLS client certificate is refreshed only over a connection with that certificate.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
-// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        Authorization header string false "Bearer {access_token} or DPoP {access_token}, optional with the refresh cookie"
+// @Param        DPoP header string false "DPoP proof (RFC 9449) for POST of this URL"
+// @Param        X-CSRF-Token header string false "CSRF token of cookie mode"
 // @Security     ApiKeyAuth
-// @Param        refresh_token body RefreshTokenRequest true "Refresh Token"
+// @Param        refresh_token body RefreshTokenRequest false "Refresh Token, omitted with the refresh cookie"
 // @Success      200 {object} TokenPairResponse
-// @Failure      400 {object} ErrorResponse "Invalid request body"
 // @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "CSRF token is missing or invalid"
+// @Failure      422 {object} ErrorResponse "Invalid request body"
 // @Router       /api/v1/auth/token/refresh [post]
 func (h *AuthHandler) RefreshTokenPair(c *fiber.Ctx) error {
 
 	var req RefreshTokenRequest
 	reqBytes := c.Request().Body()
-	if err := json.Unmarshal(reqBytes, &req); err != nil {
-		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "refresh token is invalid format"})
+	if len(reqBytes) > 0 || !h.refreshCookie.Enabled {
+		if err := json.Unmarshal(reqBytes, &req); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "refresh token is invalid format"})
+		}
+	}
+
+	fromCookie := false
+	if req.RefreshToken == "" && h.refreshCookie.Enabled {
+		refreshToken, ok := h.cookieRefreshToken(c)
+		if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "csrf token is missing or invalid"})
+		}
+		req.RefreshToken, fromCookie = refreshToken, refreshToken != ""
 	}
 
 	ipAddress := h.getFirstValidIP(c)
@@ -136,18 +255,31 @@ func (h *AuthHandler) RefreshTokenPair(c *fiber.Ctx) error {
 	ctxWithData := context.WithValue(c.Context(), ipAddressContextKey, ipAddress)
 	ctxWithData = context.WithValue(ctxWithData, userAgentContextKey, userAgent)
 
-	accessToken, ok := c.Locals("access_token").(string)
-	if !ok || accessToken == "" {
+	// Without the refresh cookie the access token is required, its session
+	// must be the one of the refresh token
+	accessToken, _ := c.Locals("access_token").(string)
+	userID, _ := c.Locals("user_id").(string)
+	if accessToken == "" && !fromCookie {
+		if c.Get("Authorization") == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "missing authorization header"})
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
 	}
-	userID, ok := c.Locals("user_id").(string)
-	if !ok || accessToken == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+
+	dpopJKT, err := h.dpopKey(c)
+	if err != nil {
+		return dpopProofError(c, err)
 	}
 
-	logger.Info("Refresh tokens.", "user_id", userID, "user_agent", userAgent, "ip_address", ipAddress)
+	logger.Info("Refresh tokens.", "user_id", userID, "cookie", fromCookie, "user_agent", userAgent, "ip_address", ipAddress)
 
-	newAccessToken, newRefreshToken, err := h.authService.RefreshTokens(ctxWithData, accessToken, req.RefreshToken)
+	binding := services.TokenBinding{DPoPJKT: dpopJKT, CertThumbprint: certificateThumbprint(c)}
+	var newAccessToken, newRefreshToken string
+	if accessToken != "" {
+		newAccessToken, newRefreshToken, err = h.authService.RefreshTokens(ctxWithData, accessToken, req.RefreshToken, binding)
+	} else {
+		newAccessToken, newRefreshToken, err = h.authService.RefreshSessionTokens(ctxWithData, req.RefreshToken, binding)
+	}
 	if err != nil {
 		// Handle specific errors from the service layer
 		if errors.Is(err, services.ErrInvalidToken) {
@@ -162,24 +294,30 @@ func (h *AuthHandler) RefreshTokenPair(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "user agent changed, please autentificate again"})
 		} else if errors.Is(err, services.ErrTokenBlocked) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is blocked"})
+		} else if errors.Is(err, services.ErrTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "refresh token reuse detected, please autentificate again"})
+		} else if errors.Is(err, services.ErrServiceToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "tokens of service accounts can't be refreshed"})
+		} else if errors.Is(err, services.ErrDPoPKeyMismatch) {
+			return dpopProofError(c, err)
+		} else if errors.Is(err, services.ErrCertificateMismatch) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "session is bound to another client certificate"})
 		}
 		logger.Error("Refresh token error", "user", userID, "user_agent", userAgent, "ip_address", ipAddress)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "cant refresh tokens"})
 	}
 
-	return c.JSON(fiber.Map{
-		"access_token":  newAccessToken,
-		"refresh_token": newRefreshToken,
-	})
+	return h.tokenPairResponse(c, newAccessToken, newRefreshToken)
 }
 
 // @Summary      Logout user
-// @Description  Revokes all refresh tokens for the current user, effectively logging them out.
+// @Description  Revokes all refresh tokens for the current user, effectively logging them out. In cookie mode the refresh and CSRF cookies are deleted too.
 // @Tags         Auth
 // @Security     ApiKeyAuth
 // @Produce      json
 // @Param        Authorization header string true "Bearer {access_token}"
 // @Success      200 {object} SuccessResponse
+// @Failure      400 {object} ErrorResponse "Token of a service account, revoke it with /auth/revoke"
 // @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
 // @Failure      500 {object} ErrorResponse "Internal server error"
 // @Router       /api/v1/auth/token/logout [post]
@@ -189,9 +327,12 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
 	}
 
-	if err := h.authService.LoggoutUser(c.Context(), accessToken); err != nil {
+	if err := h.authService.LoggoutUser(c.Context(), accessToken); errors.Is(err, services.ErrServiceToken) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "service account tokens have no session, revoke them with /auth/revoke"})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not logout"})
 	}
+	h.clearRefreshCookies(c)
 
 	return c.JSON(fiber.Map{"message": "logged out successfully"})
 }
@@ -214,6 +355,16 @@ func (h *AuthHandler) GetMyGUID(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"user_id": userID})
 }
 
+// @Summary      Get JSON Web Key Set
+// @Description  Returns the public keys used to sign access tokens. The set is empty when tokens are signed with an HMAC secret.
+// @Tags         Auth
+// @Produce      json
+// @Success      200 {object} services.JSONWebKeySet
+// @Router       /.well-known/jwks.json [get]
+func (h *AuthHandler) GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.authService.JWKS())
+}
 
 func (h *AuthHandler) getFirstValidIP(c *fiber.Ctx) string {
 	ipAddresses := c.IPs()
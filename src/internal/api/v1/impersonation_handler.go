@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type ImpersonateUserRequest struct {
+	// Actor names the admin, it is put into the token and the audit trail.
+	// It is self-asserted: the admin token doesn't identify who sends it.
+	Actor  string `json:"actor" example:"alice@example.com"`
+	Reason string `json:"reason" example:"Support ticket #4211"`
+	// Scopes default to every permission of the user
+	Scopes []string `json:"scopes" example:"articles:read"`
+	// TTL is the token lifetime in seconds, 900 by default and at most 3600
+	TTL int `json:"ttl" example:"900"`
+}
+
+type ImpersonationTokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzUxMiIsInR5cCI6IkpXVCJ9..."`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	ExpiresIn   int    `json:"expires_in" example:"900"`
+	Scope       string `json:"scope,omitempty" example:"articles:read"`
+}
+
+type ImpersonationResponse struct {
+	JTI       string    `json:"jti" example:"0f8e3c1a-6b2d-4e5f-9a7c-8d1e2f3a4b5c"`
+	Actor     string    `json:"actor" example:"alice@example.com"`
+	Reason    string    `json:"reason" example:"Support ticket #4211"`
+	Scopes    []string  `json:"scopes" example:"articles:read"`
+	IPAddress string    `json:"ip_address" example:"203.0.113.7"`
+	UserAgent string    `json:"user_agent" example:"Mozilla/5.0"`
+	CreatedAt time.Time `json:"created_at" example:"2026-10-17T17:00:00Z"`
+	ExpiresAt time.Time `json:"expires_at" example:"2026-10-17T17:15:00Z"`
+}
+
+// @Summary      Impersonate a user
+// @Description  Issues an access token of the user for support and debugging, without a refresh token. The token names the admin in the act claim marked with "imp": true, every token is recorded with the actor and the reason, and every request made with it is logged. The actor is self-asserted: X-Admin-Token is shared and doesn't identify the admin, so the actor is not verified. Impersonation tokens can't approve OAuth clients or create API keys.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "User ID"
+// @Param        impersonation body ImpersonateUserRequest true "Actor, reason, scopes and lifetime"
+// @Success      200 {object} ImpersonationTokenResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "User not found"
+// @Failure      422 {object} ErrorResponse "Missing actor or reason, scopes the user doesn't have or invalid lifetime"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/users/{id}/impersonate [post]
+func (h *AuthHandler) ImpersonateUser(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	var req ImpersonateUserRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "request body is invalid format"})
+	}
+
+	token, err := h.authService.Impersonate(c.Context(), c.Params("id"), services.Impersonation{
+		Actor:  req.Actor,
+		Reason: req.Reason,
+		Scope:  req.Scopes,
+		TTL:    time.Duration(req.TTL) * time.Second,
+	}, h.getFirstValidIP(c), string(c.Request().Header.UserAgent()))
+	if errors.Is(err, services.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	} else if errors.Is(err, services.ErrInvalidImpersonation) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid impersonation: actor, reason, scopes or ttl"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not impersonate user"})
+	}
+
+	return c.JSON(ImpersonationTokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(token.ExpiresAt).Seconds()),
+		Scope:       strings.Join(token.Scope, " "),
+	})
+}
+
+// @Summary      List impersonations of a user
+// @Description  Returns the audit trail of impersonation tokens issued for the user, newest first.
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "User ID"
+// @Success      200 {array} ImpersonationResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "User not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/users/{id}/impersonations [get]
+func (h *AuthHandler) ListImpersonations(c *fiber.Ctx) error {
+	impersonations, err := h.authService.ListImpersonations(c.Context(), c.Params("id"))
+	if errors.Is(err, services.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not list impersonations"})
+	}
+
+	response := make([]ImpersonationResponse, 0, len(impersonations))
+	for _, impersonation := range impersonations {
+		response = append(response, ImpersonationResponse{
+			JTI:       impersonation.JTI,
+			Actor:     impersonation.Actor,
+			Reason:    impersonation.Reason,
+			Scopes:    impersonation.Scope,
+			IPAddress: impersonation.IPAddress,
+			UserAgent: impersonation.UserAgent,
+			CreatedAt: impersonation.CreatedAt,
+			ExpiresAt: impersonation.ExpiresAt,
+		})
+	}
+	return c.JSON(response)
+}
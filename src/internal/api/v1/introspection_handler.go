@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IntrospectionResponse is the token state as defined by RFC 7662.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active" example:"true"`
+	TokenType string   `json:"token_type,omitempty" example:"access_token"`
+	Sub       string   `json:"sub,omitempty" example:"a1b2c3d4-e5f6-7890-1234-567890abcdef"`
+	Jti       string   `json:"jti,omitempty" example:"b7f0c7d2-7c4e-4a57-9d7e-2a8f1c6e3f10"`
+	Scope     string   `json:"scope,omitempty" example:"profile"`
+	ClientID  string   `json:"client_id,omitempty" example:"3f8b2a8e-7f1c-4a0e-9c1d-5b2e8f4a6d10"`
+	Exp       int64    `json:"exp,omitempty" example:"1753351183"`
+	Iat       int64    `json:"iat,omitempty" example:"1753350283"`
+	Iss       string   `json:"iss,omitempty" example:"http://localhost:8000"`
+	Aud       []string `json:"aud,omitempty" example:"orders-service"`
+	// Act names the party acting on behalf of the user (RFC 8693, section 4.1)
+	Act map[string]any `json:"act,omitempty"`
+	// Cnf holds the thumbprints of the DPoP key (RFC 9449, section 6.2) and
+	// the client certificate (RFC 8705, section 3.2) of bound tokens
+	Cnf map[string]string `json:"cnf,omitempty"`
+}
+
+// @Summary      Introspect a token
+// @Description  Returns whether an access or refresh token is active (RFC 7662). Requires client credentials of a resource server.
+// @Tags         Auth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Security     BasicAuth
+// @Param        token formData string true "Access or refresh token"
+// @Param        token_type_hint formData string false "access_token or refresh_token"
+// @Success      200 {object} IntrospectionResponse
+// @Failure      400 {object} ErrorResponse "Invalid request: token is required"
+// @Failure      401 {object} ErrorResponse "Invalid client credentials"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/introspect [post]
+func (h *AuthHandler) IntrospectToken(c *fiber.Ctx) error {
+	token := c.FormValue("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	}
+
+	introspection, err := h.authService.IntrospectToken(c.Context(), token, c.FormValue("token_type_hint"))
+	if err != nil {
+		logger.Error("Token introspection error", "client_id", c.Locals("client_id"), "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not introspect token"})
+	}
+
+	logger.Info("Token introspected", "client_id", c.Locals("client_id"), "active", introspection.Active)
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if !introspection.Active {
+		return c.JSON(IntrospectionResponse{Active: false})
+	}
+
+	response := IntrospectionResponse{
+		Active:    true,
+		TokenType: introspection.TokenType,
+		Sub:       introspection.UserID,
+		Jti:       introspection.JTI,
+		Scope:     introspection.Scope,
+		ClientID:  introspection.ClientID,
+		Exp:       introspection.ExpiresAt.Unix(),
+		Iat:       unixOrZero(introspection.IssuedAt),
+		Iss:       introspection.Issuer,
+		Aud:       introspection.Audience,
+	}
+	if introspection.Actor != nil {
+		response.Act = introspection.Actor.Claim()
+	}
+	if introspection.DPoPJKT != "" || introspection.CertThumbprint != "" {
+		response.Cnf = map[string]string{}
+		if introspection.DPoPJKT != "" {
+			response.Cnf["jkt"] = introspection.DPoPJKT
+		}
+		if introspection.CertThumbprint != "" {
+			response.Cnf["x5t#S256"] = introspection.CertThumbprint
+		}
+	}
+	return c.JSON(response)
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,166 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type MFAChallengeResponse struct {
+	MFAToken  string `json:"mfa_token" example:"b3BhcXVlIG1mYSBjaGFsbGVuZ2UgdG9rZW4"`
+	ExpiresIn int    `json:"expires_in" example:"300"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" example:"b3BhcXVlIG1mYSBjaGFsbGVuZ2UgdG9rZW4"`
+	// TOTP code or recovery code
+	Code string `json:"code" example:"123456"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret" example:"JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+	OTPAuthURI string `json:"otpauth_uri" example:"otpauth://totp/Go%20Auth:john_doe?algorithm=SHA1&digits=6&issuer=Go+Auth&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"`
+}
+
+type TOTPConfirmRequest struct {
+	Code string `json:"code" example:"123456"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes" example:"abcde-fgh23,k7mnp-qrs45"`
+}
+
+// @Summary      Complete login with a second factor
+// @Description  Exchanges the MFA challenge token of /api/v1/auth/login and a TOTP or recovery code for a token pair. A challenge is dropped after 5 wrong codes, after 10 wrong codes in a row the user can't complete MFA for 15 minutes.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        mfa body MFALoginRequest true "MFA challenge token and code"
+// @Param        DPoP header string false "DPoP proof (RFC 9449) for POST of this URL, binds the session to its key"
+// @Success      200 {object} TokenPairResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Invalid code, challenge or DPoP proof"
+// @Failure      409 {object} ErrorResponse "Maximum number of sessions reached"
+// @Failure      429 {object} ErrorResponse "Too many wrong codes"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/login/mfa [post]
+func (h *AuthHandler) LoginMFA(c *fiber.Ctx) error {
+	var req MFALoginRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid request body"})
+	}
+	if req.MFAToken == "" || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mfa_token and code are required"})
+	}
+
+	ipAddress := h.getFirstValidIP(c)
+	userAgent := string(c.Request().Header.UserAgent())
+
+	// Create a new context and add IP and User-Agent to it
+	ctxWithData := context.WithValue(c.Context(), ipAddressContextKey, ipAddress)
+	ctxWithData = context.WithValue(ctxWithData, userAgentContextKey, userAgent)
+
+	binding, err := h.loginBinding(c)
+	if err != nil {
+		return dpopProofError(c, err)
+	}
+
+	accessToken, refreshToken, err := h.authService.CompleteMFALogin(
+		ctxWithData, req.MFAToken, req.Code, ipAddress, userAgent, binding,
+	)
+	if errors.Is(err, services.ErrInvalidMFAChallenge) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "mfa token is invalid or expired"})
+	} else if errors.Is(err, services.ErrInvalidMFACode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid code"})
+	} else if errors.Is(err, services.ErrMFALocked) {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many wrong codes, try again later"})
+	} else if errors.Is(err, services.ErrSessionLimitReached) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "maximum number of sessions reached"})
+	} else if err != nil {
+		logger.Error("MFA login error", "error", err, "ip_address", ipAddress)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate tokens"})
+	}
+
+	return h.tokenPairResponse(c, accessToken, refreshToken)
+}
+
+// @Summary      Start TOTP enrollment
+// @Description  Generates a TOTP secret for the current user. It takes effect after /api/v1/user/mfa/totp/confirm, until then enrolling again replaces it.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Success      200 {object} TOTPEnrollmentResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      409 {object} ErrorResponse "MFA already enabled"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/mfa/totp [post]
+func (h *AuthHandler) EnrollTOTP(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	accountName, err := h.userService.DisplayName(c.Context(), userID)
+	if err != nil {
+		logger.Error("TOTP enrollment error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not enroll totp"})
+	}
+
+	secret, uri, err := h.mfaService.EnrollTOTP(c.Context(), userID, accountName)
+	if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "mfa already enabled"})
+	} else if err != nil {
+		logger.Error("TOTP enrollment error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not enroll totp"})
+	}
+
+	return c.JSON(TOTPEnrollmentResponse{Secret: secret, OTPAuthURI: uri})
+}
+
+// @Summary      Confirm TOTP enrollment
+// @Description  Enables the pending TOTP secret of the current user with a code from the authenticator app and returns one-time recovery codes. They are shown only once.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        code body TOTPConfirmRequest true "TOTP code"
+// @Success      200 {object} RecoveryCodesResponse
+// @Failure      400 {object} ErrorResponse "Invalid request body"
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      404 {object} ErrorResponse "TOTP enrollment not started"
+// @Failure      409 {object} ErrorResponse "MFA already enabled"
+// @Failure      422 {object} ErrorResponse "Invalid code"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/mfa/totp/confirm [post]
+func (h *AuthHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	var req TOTPConfirmRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+	}
+
+	recoveryCodes, err := h.mfaService.ConfirmTOTP(c.Context(), userID, req.Code)
+	if errors.Is(err, services.ErrMFANotEnrolled) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "totp enrollment not started"})
+	} else if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "mfa already enabled"})
+	} else if errors.Is(err, services.ErrInvalidMFACode) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid code"})
+	} else if err != nil {
+		logger.Error("TOTP confirmation error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not confirm totp"})
+	}
+
+	return c.JSON(RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
@@ -1,7 +1,12 @@
 package v1
 
 import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
 	"errors"
+	"net/url"
+	"slices"
 	"strings"
 
 	"github.com/nikuIin/base_go_auth/src/internal/services"
@@ -9,7 +14,14 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
-func AuthMiddleware(authService *services.AuthService) fiber.Handler {
+// AuthMiddleware authenticates the request with a bearer access token, a DPoP
+// bound access token with its proof or an API key. Access tokens must be
+// issued by this service for its audience, certificate-bound ones must come
+// over a connection with their certificate, and both must grant every one of
+// requiredScopes.
+func AuthMiddleware(
+	authService *services.AuthService, apiKeyService *services.APIKeyService, requiredScopes ...string,
+) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -17,21 +29,275 @@ func AuthMiddleware(authService *services.AuthService) fiber.Handler {
 		}
 
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid authorization header format. Should be: Bearer {access_token}"})
+		if len(parts) != 2 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid authorization header format. Should be: Bearer {access_token}, DPoP {access_token} or ApiKey {api_key}"})
 		}
 
-		accessToken := parts[1]
-		userID, _, _, err := authService.VerifyAccessToken(c.Context(), accessToken)
-		if errors.Is(err, services.ErrTokenBlocked) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is blocked"})
-		} else if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
-		}
+		var accessToken string
+		var claims *services.AccessTokenClaims
+		switch scheme := strings.ToLower(parts[0]); scheme {
+		case "bearer", "dpop":
+			var err error
+			accessToken = parts[1]
+			claims, err = authService.VerifyAccessTokenClaims(c.Context(), accessToken, requiredScopes...)
+			if errors.Is(err, services.ErrTokenBlocked) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is blocked"})
+			} else if errors.Is(err, services.ErrInvalidIssuer) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token issuer is invalid"})
+			} else if errors.Is(err, services.ErrInvalidAudience) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is not meant for this service"})
+			} else if errors.Is(err, services.ErrInsufficientScope) {
+				return insufficientScope(c, requiredScopes)
+			} else if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+			}
+
+			// Bound tokens go with the DPoP scheme and a proof of their key (RFC 9449, section 7.1)
+			if claims.DPoPJKT == "" && scheme == "dpop" {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is not DPoP bound, send it with the Bearer scheme"})
+			} else if claims.DPoPJKT != "" && scheme == "bearer" {
+				c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_token", algs="`+strings.Join(services.DPoPSigningAlgorithms, " ")+`"`)
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is DPoP bound, send it with the DPoP scheme"})
+			}
+			if scheme == "dpop" {
+				jkt, err := requestDPoPKey(c, authService, accessToken)
+				if jkt == "" && err == nil {
+					err = services.ErrInvalidDPoPProof
+				} else if err == nil && jkt != claims.DPoPJKT {
+					err = services.ErrDPoPKeyMismatch
+				}
+				if err != nil {
+					return dpopProofError(c, err)
+				}
+			}
 
+			// Certificate-bound tokens go over a connection with their certificate (RFC 8705, section 3)
+			if claims.CertThumbprint != "" && certificateThumbprint(c) != claims.CertThumbprint {
+				if scheme == "dpop" {
+					c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_token"`)
+				} else {
+					c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				}
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "token is bound to another client certificate"})
+			}
+		case "apikey":
+			ipAddress := c.IP()
+			if ipAddresses := c.IPs(); len(ipAddresses) > 0 {
+				ipAddress = ipAddresses[0]
+			}
 
+			var err error
+			claims, err = apiKeyService.Authenticate(c.Context(), parts[1], ipAddress)
+			if errors.Is(err, services.ErrAPIKeyExpired) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "api key has expired"})
+			} else if errors.Is(err, services.ErrInvalidAPIKey) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid api key"})
+			} else if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not check api key"})
+			}
+			if !claims.HasScopes(requiredScopes...) {
+				return insufficientScope(c, requiredScopes)
+			}
+		default:
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid authorization header format. Should be: Bearer {access_token}, DPoP {access_token} or ApiKey {api_key}"})
+		}
+
+		// Empty for API keys, so token routes (refresh, logout) reject them
 		c.Locals("access_token", accessToken)
-		c.Locals("user_id", userID)
+		c.Locals("user_id", claims.UserID)
+		c.Locals("jti", claims.JTI)
+		c.Locals("roles", claims.Roles)
+		c.Locals("permissions", claims.Permissions)
+		// Set for tokens issued to OAuth clients
+		c.Locals("client_id", claims.ClientID)
+		c.Locals("authentication", claims.Authentication)
+		c.Locals("api_key_id", claims.APIKeyID)
+		// Set for DPoP bound tokens, whose proof was checked
+		c.Locals("dpop_jkt", claims.DPoPJKT)
+		// Set for tokens acting on behalf of the user
+		c.Locals("actor", claims.Actor)
+		if claims.Actor.Impersonated() {
+			logger.Info("Impersonated request",
+				"user_id", claims.UserID,
+				"actor", claims.Actor.Subject,
+				"jti", claims.JTI,
+				"method", c.Method(),
+				"path", c.Path(),
+			)
+		}
+		return c.Next()
+	}
+}
+
+// requestDPoPKey verifies the DPoP proof of the request for its method and
+// path and returns the thumbprint of its key, or "" for requests without a
+// proof. accessToken is the token the proof goes with, if any.
+func requestDPoPKey(c *fiber.Ctx, authService *services.AuthService, accessToken string) (string, error) {
+	proofs := c.Request().Header.PeekAll("DPoP")
+	if len(proofs) == 0 {
+		return "", nil
+	} else if len(proofs) > 1 {
+		return "", services.ErrInvalidDPoPProof
+	}
+
+	return authService.VerifyDPoPProof(c.Context(), services.DPoPRequest{
+		Proof:       string(proofs[0]),
+		Method:      c.Method(),
+		Path:        c.Path(),
+		AccessToken: accessToken,
+	})
+}
+
+// clientCertificate is the TLS client certificate of the connection verified
+// against the client CA, nil without one.
+func clientCertificate(c *fiber.Ctx) *x509.Certificate {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
+// certificateThumbprint is the thumbprint of the verified client certificate
+// of the connection, "" without one.
+func certificateThumbprint(c *fiber.Ctx) string {
+	certificate := clientCertificate(c)
+	if certificate == nil {
+		return ""
+	}
+	return services.CertificateThumbprint(certificate)
+}
+
+// dpopProofError rejects a request to a resource with a missing or invalid DPoP proof (RFC 9449, section 7.1).
+func dpopProofError(c *fiber.Ctx, err error) error {
+	algs := strings.Join(services.DPoPSigningAlgorithms, " ")
+	switch {
+	case errors.Is(err, services.ErrDPoPKeyMismatch):
+		c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_token", algs="`+algs+`"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "dpop proof key does not match the token"})
+	case errors.Is(err, services.ErrDPoPProofReplayed):
+		c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_dpop_proof", algs="`+algs+`"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "dpop proof was used already"})
+	case errors.Is(err, services.ErrInvalidDPoPProof):
+		c.Set(fiber.HeaderWWWAuthenticate, `DPoP error="invalid_dpop_proof", algs="`+algs+`"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "dpop proof is missing or invalid"})
+	default:
+		logger.Error("DPoP proof check error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not check dpop proof"})
+	}
+}
+
+// OptionalAuth runs authMiddleware only for requests with an Authorization
+// header, so browsers in cookie mode can refresh with the refresh cookie alone.
+func OptionalAuth(authMiddleware fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Get("Authorization") == "" {
+			return c.Next()
+		}
+		return authMiddleware(c)
+	}
+}
+
+// RequireFirstParty lets through only the user's own sessions: not tokens of
+// OAuth clients, exchanged or impersonation tokens, nor API keys. It guards
+// routes that grant access to others and goes after AuthMiddleware.
+func RequireFirstParty() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		clientID, _ := c.Locals("client_id").(string)
+		apiKeyID, _ := c.Locals("api_key_id").(string)
+		actor, _ := c.Locals("actor").(*services.Actor)
+		if clientID != "" || apiKeyID != "" || actor != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "only the user's own session can do this"})
+		}
+
+		return c.Next()
+	}
+}
+
+// RequirePermission lets the request through if the access token grants every
+// one of the permissions. It goes after AuthMiddleware.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, _ := c.Locals("permissions").([]string)
+		for _, permission := range permissions {
+			if !slices.Contains(granted, permission) {
+				return insufficientScope(c, permissions)
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+// insufficientScope rejects a request whose token lacks some of the scopes (RFC 6750, section 3.1).
+func insufficientScope(c *fiber.Ctx, scopes []string) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="`+strings.Join(scopes, " ")+`"`)
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "insufficient_scope"})
+}
+
+// AdminMiddleware protects operational routes with a static token from ADMIN_API_TOKEN.
+// The routes are disabled when the token is not configured.
+func AdminMiddleware(adminToken string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if adminToken == "" {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "admin api is disabled"})
+		}
+
+		requestToken := c.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(requestToken), []byte(adminToken)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid admin token"})
+		}
+
+		return c.Next()
+	}
+}
+
+// ClientCredentialsMiddleware authenticates confidential clients with HTTP Basic
+// credentials or client_id/client_secret form fields (RFC 6749, section 2.3.1).
+func ClientCredentialsMiddleware(clients map[string]string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		clientID, clientSecret, ok := parseBasicAuth(c.Get("Authorization"))
+		if !ok {
+			clientID, clientSecret = c.FormValue("client_id"), c.FormValue("client_secret")
+		}
+
+		expectedSecret, found := clients[clientID]
+		if !found {
+			// Compare anyway, so unknown clients take as long as known ones
+			expectedSecret = clientSecret + "-"
+		}
+		if clientID == "" || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(expectedSecret)) != 1 {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="auth"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_client"})
+		}
+
+		c.Locals("client_id", clientID)
 		return c.Next()
 	}
 }
+
+func parseBasicAuth(authHeader string) (username, password string, ok bool) {
+	scheme, credentials, found := strings.Cut(authHeader, " ")
+	if !found || strings.ToLower(scheme) != "basic" {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return "", "", false
+	}
+
+	username, password, ok = strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	// Credentials are form-urlencoded before being put into the header
+	if username, err = url.QueryUnescape(username); err != nil {
+		return "", "", false
+	}
+	if password, err = url.QueryUnescape(password); err != nil {
+		return "", "", false
+	}
+	return username, password, true
+}
@@ -0,0 +1,618 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+// OAuthErrorResponse is an error response of RFC 6749, section 5.2.
+type OAuthErrorResponse struct {
+	Error            string `json:"error" example:"invalid_grant"`
+	ErrorDescription string `json:"error_description,omitempty" example:"authorization code is invalid, expired or used"`
+}
+
+// OAuthTokenResponse is a successful response of the token endpoint (RFC 6749, section 5.1).
+type OAuthTokenResponse struct {
+	AccessToken string `json:"access_token" example:"eyJhbGciOiJIUzUxMiIsInR5cCI6IkpXVCJ9..."`
+	TokenType   string `json:"token_type" example:"Bearer"`
+	ExpiresIn   int    `json:"expires_in" example:"900"`
+	// RefreshToken is not issued to service accounts
+	RefreshToken string `json:"refresh_token,omitempty" example:"V29uZGVyZnVsIHJlZnJlc2ggdG9rZW4h"`
+	Scope        string `json:"scope,omitempty" example:"openid articles:read"`
+	// IDToken is issued for the openid scope
+	IDToken string `json:"id_token,omitempty" example:"eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	// IssuedTokenType is set by token exchange
+	IssuedTokenType string `json:"issued_token_type,omitempty" example:"urn:ietf:params:oauth:token-type:access_token"`
+}
+
+type AuthorizationRedirectResponse struct {
+	RedirectTo string `json:"redirect_to" example:"https://app.example.com/callback?code=V29uZGVyZnVs&state=af0ifjsldkj"`
+}
+
+type RegisterOAuthClientRequest struct {
+	Name         string   `json:"name" example:"Example App"`
+	RedirectURIs []string `json:"redirect_uris" example:"https://app.example.com/callback"`
+	Scopes       []string `json:"scopes" example:"articles:read"`
+	// Confidential clients get a secret, public clients (SPAs, mobile apps) rely on PKCE
+	Confidential bool `json:"confidential" example:"true"`
+	// GrantTypes default to authorization_code and refresh_token, client_credentials makes a service account
+	GrantTypes []string `json:"grant_types" example:"authorization_code,refresh_token"`
+	// AccessTokenTTL is the lifetime of client_credentials tokens in seconds, 0 for the default
+	AccessTokenTTL int `json:"access_token_ttl" example:"3600"`
+	// One of the tls_client_auth_* fields makes a confidential client authenticate with a TLS
+	// client certificate instead of a secret (RFC 8705, section 2.1.2)
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty" example:"CN=billing,O=Example"`
+	TLSClientAuthSANDNS    string `json:"tls_client_auth_san_dns,omitempty" example:"billing.internal.example.com"`
+	TLSClientAuthSANURI    string `json:"tls_client_auth_san_uri,omitempty" example:"spiffe://example.com/billing"`
+	TLSClientAuthSANIP     string `json:"tls_client_auth_san_ip,omitempty" example:"10.0.0.7"`
+	TLSClientAuthSANEmail  string `json:"tls_client_auth_san_email,omitempty" example:"billing@example.com"`
+}
+
+type OAuthClientResponse struct {
+	ClientID string `json:"client_id" example:"3f8b2a8e-7f1c-4a0e-9c1d-5b2e8f4a6d10"`
+	// ClientSecret is returned only on registration
+	ClientSecret string   `json:"client_secret,omitempty" example:"c2VjcmV0IHNob3duIG9uY2U"`
+	Name         string   `json:"name" example:"Example App"`
+	Confidential bool     `json:"confidential" example:"true"`
+	RedirectURIs []string `json:"redirect_uris" example:"https://app.example.com/callback"`
+	Scopes       []string `json:"scopes" example:"articles:read"`
+	GrantTypes   []string `json:"grant_types" example:"authorization_code,refresh_token"`
+	// AccessTokenTTL is omitted when client_credentials tokens have the default lifetime
+	AccessTokenTTL int `json:"access_token_ttl,omitempty" example:"3600"`
+	// TokenEndpointAuthMethod is tls_client_auth for clients with a certificate, with the attribute it must have
+	TokenEndpointAuthMethod string    `json:"token_endpoint_auth_method" example:"client_secret_basic"`
+	TLSClientAuthSubjectDN  string    `json:"tls_client_auth_subject_dn,omitempty" example:"CN=billing,O=Example"`
+	TLSClientAuthSANDNS     string    `json:"tls_client_auth_san_dns,omitempty" example:"billing.internal.example.com"`
+	TLSClientAuthSANURI     string    `json:"tls_client_auth_san_uri,omitempty" example:"spiffe://example.com/billing"`
+	TLSClientAuthSANIP      string    `json:"tls_client_auth_san_ip,omitempty" example:"10.0.0.7"`
+	TLSClientAuthSANEmail   string    `json:"tls_client_auth_san_email,omitempty" example:"billing@example.com"`
+	CreatedAt               time.Time `json:"created_at" example:"2026-10-17T14:30:00Z"`
+}
+
+// @Summary      OAuth authorization endpoint
+// @Description  Starts the authorization code flow (RFC 6749, section 4.1). PKCE with S256 is required. A valid request is redirected to the login page with the same query, which approves it with POST /oauth/authorize. Other errors are redirected to the redirect URI with error and state.
+// @Tags         OAuth
+// @Produce      json
+// @Param        response_type query string true "code"
+// @Param        client_id query string true "Client ID"
+// @Param        redirect_uri query string false "Registered redirect URI, optional if the client has only one"
+// @Param        scope query string false "Space separated scopes"
+// @Param        state query string false "Opaque value returned to the client"
+// @Param        code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param        code_challenge_method query string true "S256"
+// @Param        nonce query string false "OpenID Connect nonce, returned in the ID token"
+// @Success      302 "Redirect to the login page or to the redirect URI with an error"
+// @Failure      400 {object} OAuthErrorResponse "Unknown client or redirect URI"
+// @Failure      500 {object} OAuthErrorResponse "Internal server error"
+// @Router       /oauth/authorize [get]
+func (h *AuthHandler) OAuthAuthorize(c *fiber.Ctx) error {
+	req := authorizationRequestFrom(c)
+	_, err := h.oauthService.ValidateAuthorizationRequest(c.Context(), &req)
+
+	var oauthErr *services.OAuthError
+	if errors.Is(err, services.ErrUnknownOAuthClient) || errors.Is(err, services.ErrInvalidRedirectURI) {
+		// Never redirect to a URI the client hasn't registered
+		return c.Status(fiber.StatusBadRequest).JSON(OAuthErrorResponse{
+			Error:            services.OAuthErrorInvalidRequest,
+			ErrorDescription: err.Error(),
+		})
+	} else if errors.As(err, &oauthErr) {
+		return c.Redirect(authorizationErrorRedirect(req, oauthErr), fiber.StatusFound)
+	} else if err != nil {
+		logger.Error("Authorization request error", "client_id", req.ClientID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(OAuthErrorResponse{Error: "server_error"})
+	}
+
+	loginURL := h.oauthService.LoginURL() + "?" + string(c.Request().URI().QueryString())
+	return c.Redirect(loginURL, fiber.StatusFound)
+}
+
+// @Summary      Approve an OAuth authorization request
+// @Description  Called by the login page for the logged in user with the query of GET /oauth/authorize. Issues an authorization code for the requested scopes the user has permissions for and returns the redirect URI of the client. Tokens issued to OAuth clients can't approve requests.
+// @Tags         OAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Security     ApiKeyAuth
+// @Param        response_type query string true "code"
+// @Param        client_id query string true "Client ID"
+// @Param        redirect_uri query string false "Registered redirect URI"
+// @Param        scope query string false "Space separated scopes"
+// @Param        state query string false "Opaque value returned to the client"
+// @Param        code_challenge query string true "BASE64URL(SHA256(code_verifier))"
+// @Param        code_challenge_method query string true "S256"
+// @Param        nonce query string false "OpenID Connect nonce, returned in the ID token"
+// @Success      200 {object} AuthorizationRedirectResponse "Redirect URI with the code, or with an error"
+// @Failure      400 {object} OAuthErrorResponse "Unknown client or redirect URI"
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      500 {object} OAuthErrorResponse "Internal server error"
+// @Router       /oauth/authorize [post]
+func (h *AuthHandler) ApproveOAuthAuthorization(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	authentication, _ := c.Locals("authentication").(services.Authentication)
+
+	req := authorizationRequestFrom(c)
+	code, err := h.oauthService.Authorize(c.Context(), userID, authentication, &req)
+
+	var oauthErr *services.OAuthError
+	if errors.Is(err, services.ErrUnknownOAuthClient) || errors.Is(err, services.ErrInvalidRedirectURI) {
+		return c.Status(fiber.StatusBadRequest).JSON(OAuthErrorResponse{
+			Error:            services.OAuthErrorInvalidRequest,
+			ErrorDescription: err.Error(),
+		})
+	} else if errors.As(err, &oauthErr) {
+		return c.JSON(AuthorizationRedirectResponse{RedirectTo: authorizationErrorRedirect(req, oauthErr)})
+	} else if err != nil {
+		logger.Error("Authorization error", "user_id", userID, "client_id", req.ClientID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(OAuthErrorResponse{Error: "server_error"})
+	}
+
+	params := url.Values{"code": {code}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return c.JSON(AuthorizationRedirectResponse{RedirectTo: withQueryParams(req.RedirectURI, params)})
+}
+
+// @Summary      OAuth token endpoint
+// @Description  Exchanges an authorization code (grant_type=authorization_code) or a refresh token (grant_type=refresh_token) of an OAuth client for a token pair. Confidential clients authenticate with HTTP Basic or client_id/client_secret, public clients send client_id only. Refresh tokens are rotated.
+// @Description  Service accounts get an access token of their own with grant_type=client_credentials, without a refresh token, for this service or the requested audience.
+// @Description  Devices without a browser poll with grant_type=urn:ietf:params:oauth:grant-type:device_code and the device_code until the user approves the request: authorization_pending while waiting, slow_down when polling faster than the interval, access_denied or expired_token at the end (RFC 8628, section 3.5). Polls need the User-Agent of the device authorization request.
+// @Description  A DPoP proof (RFC 9449) in the DPoP header binds the issued tokens to the key of the proof, the token type is then DPoP. Refresh tokens of a bound session are accepted only with a proof of its key.
+// @Description  Over a connection with a verified TLS client certificate (RFC 8705) access tokens are bound to the certificate (cnf.x5t#S256), and so are refresh tokens of public clients. Clients registered with tls_client_auth authenticate with the certificate and client_id, without a secret.
+// @Description  Services exchange the access token of a user for a token to call another service on the user's behalf with grant_type=urn:ietf:params:oauth:grant-type:token-exchange (RFC 8693): the subject token must be meant for this service, a bound one is exchanged only with a proof of its DPoP key or over a connection with its certificate, and the new token has at most the scope of the subject token, the required audience, no refresh token and the client in the act claim.
+// @Tags         OAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Security     BasicAuth
+// @Param        DPoP header string false "DPoP proof (RFC 9449) for POST of this URL"
+// @Param        grant_type formData string true "authorization_code, refresh_token, client_credentials, urn:ietf:params:oauth:grant-type:device_code or urn:ietf:params:oauth:grant-type:token-exchange"
+// @Param        code formData string false "Authorization code"
+// @Param        redirect_uri formData string false "Redirect URI of the authorization request"
+// @Param        code_verifier formData string false "PKCE code verifier"
+// @Param        refresh_token formData string false "Refresh token"
+// @Param        device_code formData string false "Device code"
+// @Param        subject_token formData string false "Access token of the user to exchange"
+// @Param        subject_token_type formData string false "urn:ietf:params:oauth:token-type:access_token"
+// @Param        audience formData string false "Service a client_credentials or exchanged token is for, may repeat. Required for token exchange, this service for client_credentials if empty"
+// @Param        resource formData string false "URI of the service a client_credentials or exchanged token is for, may repeat"
+// @Param        scope formData string false "Space separated scopes of a client_credentials or exchanged token, all scopes of the client or of the subject token if empty"
+// @Param        client_id formData string false "Client ID, if not sent with HTTP Basic"
+// @Param        client_secret formData string false "Client secret, if not sent with HTTP Basic"
+// @Success      200 {object} OAuthTokenResponse
+// @Failure      400 {object} OAuthErrorResponse "invalid_request, invalid_grant, invalid_scope, invalid_target, invalid_dpop_proof, unauthorized_client, unsupported_grant_type or a device polling error"
+// @Failure      401 {object} OAuthErrorResponse "invalid_client"
+// @Failure      500 {object} OAuthErrorResponse "Internal server error"
+// @Router       /oauth/token [post]
+func (h *AuthHandler) OAuthToken(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	client, err := h.authenticateOAuthClient(c)
+	if err != nil {
+		return oauthTokenError(c, err)
+	}
+
+	dpopJKT, err := h.dpopKey(c)
+	if err != nil {
+		return oauthTokenError(c, dpopOAuthError(err))
+	}
+	tokenType := "Bearer"
+	if dpopJKT != "" {
+		tokenType = "DPoP"
+	}
+	// Refresh tokens of confidential clients are bound to their authentication instead (RFC 8705, section 4)
+	binding := services.TokenBinding{
+		DPoPJKT:               dpopJKT,
+		CertThumbprint:        certificateThumbprint(c),
+		CertBoundRefreshToken: !client.Confidential,
+	}
+
+	ipAddress := h.getFirstValidIP(c)
+	userAgent := string(c.Request().Header.UserAgent())
+
+	// Create a new context and add IP and User-Agent to it
+	ctxWithData := context.WithValue(c.Context(), ipAddressContextKey, ipAddress)
+	ctxWithData = context.WithValue(ctxWithData, userAgentContextKey, userAgent)
+
+	var tokens services.ClientTokens
+	var nonce string
+	switch grantType := c.FormValue("grant_type"); grantType {
+	case services.GrantTypeAuthorizationCode, services.GrantTypeDeviceCode:
+		var grant services.AuthorizationGrant
+		if grantType == services.GrantTypeAuthorizationCode {
+			grant, err = h.oauthService.ExchangeAuthorizationCode(
+				c.Context(), client, c.FormValue("code"), c.FormValue("redirect_uri"), c.FormValue("code_verifier"),
+			)
+		} else {
+			// Only the device that requested the code gets past the poll, so
+			// the session is bound to the user agent of that device
+			grant, err = h.oauthService.PollDeviceCode(c.Context(), client, c.FormValue("device_code"), userAgent)
+		}
+		if err != nil {
+			return oauthTokenError(c, err)
+		}
+
+		// Not GenerateTokens: the device is an OAuth client, its session is
+		// limited to the approved scope and refreshed here like any client
+		// session. IssueClientTokens goes through the same generateTokens,
+		// without the MFA check the approving session has already passed.
+		nonce = grant.Nonce
+		tokens, err = h.authService.IssueClientTokens(
+			ctxWithData, grant.UserID, client.ClientID, grant.Scope, grant.Authentication, ipAddress, userAgent, binding,
+		)
+		if errors.Is(err, services.ErrSessionLimitReached) {
+			return oauthTokenError(c, &services.OAuthError{
+				Code:        services.OAuthErrorInvalidGrant,
+				Description: "maximum number of sessions reached",
+			})
+		} else if err != nil {
+			return oauthTokenError(c, err)
+		}
+
+	case services.GrantTypeRefreshToken:
+		if !client.AllowsGrant(services.GrantTypeRefreshToken) {
+			return oauthTokenError(c, &services.OAuthError{
+				Code:        services.OAuthErrorUnauthorizedClient,
+				Description: "client may not use the refresh token grant",
+			})
+		}
+
+		refreshToken := c.FormValue("refresh_token")
+		if refreshToken == "" {
+			return oauthTokenError(c, &services.OAuthError{
+				Code:        services.OAuthErrorInvalidRequest,
+				Description: "refresh_token is required",
+			})
+		}
+
+		tokens, err = h.authService.RefreshClientTokens(
+			ctxWithData, client.ClientID, refreshToken, binding,
+		)
+		if errors.Is(err, services.ErrDPoPKeyMismatch) {
+			return oauthTokenError(c, dpopOAuthError(err))
+		} else if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrTokenNotFound) ||
+			errors.Is(err, services.ErrTokenRevoked) || errors.Is(err, services.ErrTokenReused) ||
+			errors.Is(err, services.ErrUserAgentMismatch) || errors.Is(err, services.ErrCertificateMismatch) {
+			return oauthTokenError(c, &services.OAuthError{
+				Code:        services.OAuthErrorInvalidGrant,
+				Description: err.Error(),
+			})
+		} else if err != nil {
+			return oauthTokenError(c, err)
+		}
+
+	case services.GrantTypeClientCredentials:
+		scope, err := h.oauthService.ClientCredentialsScope(client, c.FormValue("scope"))
+		if err != nil {
+			return oauthTokenError(c, err)
+		}
+
+		ttl := client.AccessTokenTTL
+		if ttl == 0 {
+			ttl = h.authService.AccessTokenTTL()
+		}
+		accessToken, err := h.authService.IssueServiceToken(
+			c.Context(), client.ClientID, scope, requestedAudience(c), ttl, binding,
+		)
+		if err != nil {
+			return oauthTokenError(c, err)
+		}
+
+		logger.Info("Token issued to service account", "client_id", client.ClientID, "ip_address", ipAddress)
+		return c.JSON(OAuthTokenResponse{
+			AccessToken: accessToken,
+			TokenType:   tokenType,
+			ExpiresIn:   int(ttl.Seconds()),
+			Scope:       strings.Join(scope, " "),
+		})
+
+	case services.GrantTypeTokenExchange:
+		if !client.AllowsGrant(services.GrantTypeTokenExchange) {
+			return oauthTokenError(c, &services.OAuthError{
+				Code:        services.OAuthErrorUnauthorizedClient,
+				Description: "client may not use the token exchange grant",
+			})
+		}
+
+		token, err := h.authService.ExchangeToken(c.Context(), client.ClientID, services.TokenExchangeRequest{
+			SubjectToken:       c.FormValue("subject_token"),
+			SubjectTokenType:   c.FormValue("subject_token_type"),
+			RequestedTokenType: c.FormValue("requested_token_type"),
+			ActorToken:         c.FormValue("actor_token"),
+			Scope:              c.FormValue("scope"),
+			Audience:           requestedAudience(c),
+			Binding:            binding,
+		})
+		if err != nil {
+			return oauthTokenError(c, err)
+		}
+
+		logger.Info("Token exchanged", "client_id", client.ClientID, "user_id", token.UserID, "ip_address", ipAddress)
+		return c.JSON(OAuthTokenResponse{
+			AccessToken:     token.AccessToken,
+			TokenType:       tokenType,
+			ExpiresIn:       int(time.Until(token.ExpiresAt).Seconds()),
+			Scope:           strings.Join(token.Scope, " "),
+			IssuedTokenType: services.TokenTypeAccessToken,
+		})
+
+	default:
+		return oauthTokenError(c, &services.OAuthError{
+			Code: services.OAuthErrorUnsupportedGrantType,
+			Description: "grant_type must be authorization_code, refresh_token, client_credentials, " +
+				services.GrantTypeDeviceCode + " or " + services.GrantTypeTokenExchange,
+		})
+	}
+
+	response := OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int(h.authService.AccessTokenTTL().Seconds()),
+		RefreshToken: tokens.RefreshToken,
+		Scope:        strings.Join(tokens.Scope, " "),
+	}
+	if slices.Contains(tokens.Scope, services.ScopeOpenID) {
+		response.IDToken, err = h.oauthService.IDToken(c.Context(), client.ClientID, tokens, nonce)
+		if err != nil {
+			return oauthTokenError(c, err)
+		}
+	}
+
+	logger.Info("Tokens issued to OAuth client", "client_id", client.ClientID, "ip_address", ipAddress)
+	return c.JSON(response)
+}
+
+// @Summary      Register an OAuth client
+// @Description  Redirect URIs must be https, http on localhost or a private-use scheme like com.example.app:/callback, and are matched exactly. Scopes limit what the client may request. The secret of a confidential client is returned only once.
+// @Description  Confidential clients with the client_credentials grant are service accounts, they need no redirect URIs and may set the lifetime of their tokens.
+// @Description  A confidential client with one of the tls_client_auth_* attributes authenticates with a TLS client certificate issued by the client CA of the server and having that subject DN or subject alternative name, it gets no secret.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        client body RegisterOAuthClientRequest true "Client metadata"
+// @Success      201 {object} OAuthClientResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      422 {object} ErrorResponse "Invalid client metadata"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/oauth/clients [post]
+func (h *AuthHandler) RegisterOAuthClient(c *fiber.Ctx) error {
+	var req RegisterOAuthClientRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "request body is invalid format"})
+	}
+
+	tlsClientAuth, ok := certificateSubjectFrom(req)
+	if !ok {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "only one tls_client_auth attribute may be set"})
+	}
+
+	client, secret, err := h.oauthService.RegisterClient(c.Context(), services.OAuthClient{
+		Name:           req.Name,
+		Confidential:   req.Confidential,
+		RedirectURIs:   req.RedirectURIs,
+		Scopes:         req.Scopes,
+		GrantTypes:     req.GrantTypes,
+		AccessTokenTTL: time.Duration(req.AccessTokenTTL) * time.Second,
+		TLSClientAuth:  tlsClientAuth,
+	})
+	if errors.Is(err, services.ErrInvalidClientMetadata) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid client metadata: name, grant types, redirect uris, scopes, token ttl or tls_client_auth attribute"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not register client"})
+	}
+
+	response := oauthClientResponse(client)
+	response.ClientSecret = secret
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// @Summary      List OAuth clients
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Success      200 {array} OAuthClientResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/oauth/clients [get]
+func (h *AuthHandler) ListOAuthClients(c *fiber.Ctx) error {
+	clients, err := h.oauthService.ListClients(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not list clients"})
+	}
+
+	response := make([]OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		response = append(response, oauthClientResponse(client))
+	}
+	return c.JSON(response)
+}
+
+// @Summary      Delete an OAuth client
+// @Description  Deletes the client with its authorization codes and refresh tokens. Access tokens issued to it stay valid until they expire.
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "Client ID"
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "Client not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/oauth/clients/{id} [delete]
+func (h *AuthHandler) DeleteOAuthClient(c *fiber.Ctx) error {
+	err := h.oauthService.DeleteClient(c.Context(), c.Params("id"))
+	if errors.Is(err, services.ErrOAuthClientNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "client not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete client"})
+	}
+
+	return c.JSON(fiber.Map{"message": "client deleted"})
+}
+
+func authorizationRequestFrom(c *fiber.Ctx) services.AuthorizationRequest {
+	return services.AuthorizationRequest{
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		ResponseType:        c.Query("response_type"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+		Nonce:               c.Query("nonce"),
+	}
+}
+
+// authorizationErrorRedirect is the redirect URI with the error of RFC 6749, section 4.1.2.1.
+func authorizationErrorRedirect(req services.AuthorizationRequest, oauthErr *services.OAuthError) string {
+	params := url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	return withQueryParams(req.RedirectURI, params)
+}
+
+// withQueryParams adds the params to the query the URI may already have.
+func withQueryParams(rawURI string, params url.Values) string {
+	uri, err := url.Parse(rawURI)
+	if err != nil {
+		return rawURI
+	}
+
+	query := uri.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	uri.RawQuery = query.Encode()
+	return uri.String()
+}
+
+// authenticateOAuthClient authenticates the client with HTTP Basic or
+// client_id/client_secret form fields (RFC 6749, section 2.3.1), or with the
+// client certificate of the connection (RFC 8705, section 2).
+func (h *AuthHandler) authenticateOAuthClient(c *fiber.Ctx) (services.OAuthClient, error) {
+	clientID, clientSecret, basicAuth := parseBasicAuth(c.Get("Authorization"))
+	if !basicAuth {
+		clientID, clientSecret = c.FormValue("client_id"), c.FormValue("client_secret")
+	}
+
+	client, err := h.oauthService.AuthenticateClient(c.Context(), clientID, clientSecret, clientCertificate(c))
+	if err != nil && basicAuth {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth"`)
+	}
+	return client, err
+}
+
+// oauthTokenError writes an error of the token endpoint (RFC 6749, section 5.2).
+func oauthTokenError(c *fiber.Ctx, err error) error {
+	var oauthErr *services.OAuthError
+	if !errors.As(err, &oauthErr) {
+		logger.Error("OAuth token error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(OAuthErrorResponse{Error: "server_error"})
+	}
+
+	status := fiber.StatusBadRequest
+	if oauthErr.Code == services.OAuthErrorInvalidClient {
+		status = fiber.StatusUnauthorized
+	}
+	return c.Status(status).JSON(OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
+
+func oauthClientResponse(client services.OAuthClient) OAuthClientResponse {
+	response := OAuthClientResponse{
+		ClientID:                client.ClientID,
+		Name:                    client.Name,
+		Confidential:            client.Confidential,
+		RedirectURIs:            client.RedirectURIs,
+		Scopes:                  client.Scopes,
+		GrantTypes:              client.GrantTypes,
+		AccessTokenTTL:          int(client.AccessTokenTTL.Seconds()),
+		TokenEndpointAuthMethod: "client_secret_basic",
+		CreatedAt:               client.CreatedAt,
+	}
+	if !client.Confidential {
+		response.TokenEndpointAuthMethod = "none"
+	}
+	if client.TLSClientAuth != nil {
+		response.TokenEndpointAuthMethod = "tls_client_auth"
+		switch client.TLSClientAuth.Attribute {
+		case services.TLSClientAuthSubjectDN:
+			response.TLSClientAuthSubjectDN = client.TLSClientAuth.Value
+		case services.TLSClientAuthSANDNS:
+			response.TLSClientAuthSANDNS = client.TLSClientAuth.Value
+		case services.TLSClientAuthSANURI:
+			response.TLSClientAuthSANURI = client.TLSClientAuth.Value
+		case services.TLSClientAuthSANIP:
+			response.TLSClientAuthSANIP = client.TLSClientAuth.Value
+		case services.TLSClientAuthSANEmail:
+			response.TLSClientAuthSANEmail = client.TLSClientAuth.Value
+		}
+	}
+	return response
+}
+
+// certificateSubjectFrom is the tls_client_auth attribute of the registration
+// request, nil for clients without one. It reports false if several are set.
+func certificateSubjectFrom(req RegisterOAuthClientRequest) (*services.CertificateSubject, bool) {
+	var subject *services.CertificateSubject
+	for attribute, value := range map[string]string{
+		services.TLSClientAuthSubjectDN: req.TLSClientAuthSubjectDN,
+		services.TLSClientAuthSANDNS:    req.TLSClientAuthSANDNS,
+		services.TLSClientAuthSANURI:    req.TLSClientAuthSANURI,
+		services.TLSClientAuthSANIP:     req.TLSClientAuthSANIP,
+		services.TLSClientAuthSANEmail:  req.TLSClientAuthSANEmail,
+	} {
+		if value == "" {
+			continue
+		}
+		if subject != nil {
+			return nil, false
+		}
+		subject = &services.CertificateSubject{Attribute: attribute, Value: value}
+	}
+	return subject, true
+}
+
+// requestedAudience is the audience of the token request. Resource indicators
+// (RFC 8707) name the audience by URI.
+func requestedAudience(c *fiber.Ctx) []string {
+	var audience []string
+	for _, name := range []string{"audience", "resource"} {
+		for _, value := range c.Request().PostArgs().PeekMulti(name) {
+			audience = append(audience, string(value))
+		}
+	}
+	return audience
+}
+
+// dpopKey returns the DPoP key of a token request: the key of the bound access
+// token checked by AuthMiddleware or of the proof sent with the request, ""
+// without a proof.
+func (h *AuthHandler) dpopKey(c *fiber.Ctx) (string, error) {
+	if jkt, _ := c.Locals("dpop_jkt").(string); jkt != "" {
+		return jkt, nil
+	}
+	return requestDPoPKey(c, h.authService, "")
+}
+
+// dpopOAuthError is the token endpoint error of an invalid DPoP proof (RFC 9449, section 5).
+func dpopOAuthError(err error) error {
+	if errors.Is(err, services.ErrInvalidDPoPProof) || errors.Is(err, services.ErrDPoPProofReplayed) ||
+		errors.Is(err, services.ErrDPoPKeyMismatch) {
+		return &services.OAuthError{Code: services.OAuthErrorInvalidDPoPProof, Description: err.Error()}
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+// UserInfoResponse holds the claims of the user (OpenID Connect Core 1.0, section 5.3).
+type UserInfoResponse struct {
+	Sub               string `json:"sub" example:"a1b2c3d4-e5f6-7890-1234-567890abcdef"`
+	PreferredUsername string `json:"preferred_username,omitempty" example:"john_doe"`
+	Email             string `json:"email,omitempty" example:"john@example.com"`
+	EmailVerified     *bool  `json:"email_verified,omitempty" example:"true"`
+}
+
+// @Summary      OpenID Connect discovery document
+// @Description  Describes the OpenID provider: endpoints, supported scopes and the algorithm of ID tokens (OpenID Connect Discovery 1.0).
+// @Tags         OAuth
+// @Produce      json
+// @Success      200 {object} services.OpenIDConfiguration
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /.well-known/openid-configuration [get]
+func (h *AuthHandler) GetOpenIDConfiguration(c *fiber.Ctx) error {
+	configuration, err := h.oauthService.OpenIDConfiguration(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not build configuration"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(configuration)
+}
+
+// @Summary      OpenID Connect user info
+// @Description  Returns the claims of the user for an access token with the openid scope: preferred_username for the profile scope, email and email_verified for the email scope.
+// @Tags         OAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Security     ApiKeyAuth
+// @Success      200 {object} UserInfoResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Token without the openid scope"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /userinfo [get]
+// @Router       /userinfo [post]
+func (h *AuthHandler) UserInfo(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+	scope, _ := c.Locals("permissions").([]string)
+
+	userInfo, err := h.oauthService.UserInfo(c.Context(), userID, scope)
+	if errors.Is(err, services.ErrUserNotFound) {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not get user info"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(UserInfoResponse{
+		Sub:               userInfo.Subject,
+		PreferredUsername: userInfo.Username,
+		Email:             userInfo.Email,
+		EmailVerified:     userInfo.EmailVerified,
+	})
+}
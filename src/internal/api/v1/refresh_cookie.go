@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// refreshCookiePath keeps the browser from sending the refresh cookie
+	// anywhere but the refresh endpoint
+	refreshCookiePath = apiPrefix + refreshRoute
+	csrfHeader        = "X-CSRF-Token"
+)
+
+// csrfToken is derived from the refresh token, so a CSRF cookie planted by
+// another site can't be paired with the refresh cookie of the user.
+func csrfToken(refreshToken string) string {
+	digest := sha256.Sum256([]byte("csrf:" + refreshToken))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+// tokenPairResponse returns the token pair of a first-party login or refresh.
+// In cookie mode the refresh token is set as an HttpOnly cookie instead, with
+// the CSRF token in a cookie the SPA reads and in the body.
+func (h *AuthHandler) tokenPairResponse(c *fiber.Ctx, accessToken, refreshToken string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	if !h.refreshCookie.Enabled {
+		return c.JSON(TokenPairResponse{AccessToken: accessToken, RefreshToken: refreshToken})
+	}
+
+	csrf := csrfToken(refreshToken)
+	expires := time.Now().Add(h.authService.RefreshTokenTTL())
+	h.setCookie(c, h.refreshCookie.Name, refreshToken, refreshCookiePath, true, expires)
+	h.setCookie(c, h.refreshCookie.CSRFName, csrf, "/", false, expires)
+	return c.JSON(TokenPairResponse{AccessToken: accessToken, CSRFToken: csrf})
+}
+
+// clearRefreshCookies deletes the cookies of cookie mode.
+func (h *AuthHandler) clearRefreshCookies(c *fiber.Ctx) {
+	if !h.refreshCookie.Enabled {
+		return
+	}
+	h.setCookie(c, h.refreshCookie.Name, "", refreshCookiePath, true, time.Unix(0, 0))
+	h.setCookie(c, h.refreshCookie.CSRFName, "", "/", false, time.Unix(0, 0))
+}
+
+func (h *AuthHandler) setCookie(c *fiber.Ctx, name, value, path string, httpOnly bool, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   h.refreshCookie.Domain,
+		Expires:  expires,
+		Secure:   true,
+		HTTPOnly: httpOnly,
+		SameSite: h.refreshCookie.SameSite,
+	})
+}
+
+// cookieRefreshToken reads the refresh cookie. The browser attaches it to
+// requests of any origin, so the request must prove it comes from the SPA by
+// double-submitting the CSRF cookie in the X-CSRF-Token header, which other
+// origins can't read. ok is false when the CSRF token is missing or wrong.
+func (h *AuthHandler) cookieRefreshToken(c *fiber.Ctx) (refreshToken string, ok bool) {
+	refreshToken = c.Cookies(h.refreshCookie.Name)
+	if refreshToken == "" {
+		return "", true
+	}
+
+	header := c.Get(csrfHeader)
+	cookie := c.Cookies(h.refreshCookie.CSRFName)
+	if header == "" ||
+		subtle.ConstantTimeCompare([]byte(header), []byte(cookie)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(cookie), []byte(csrfToken(refreshToken))) != 1 {
+		return "", false
+	}
+	return refreshToken, true
+}
@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+// @Summary      Revoke a token
+// @Description  Revokes an access token (block list) or a refresh token (deleted) together with the other half of its pair (RFC 7009). OAuth clients authenticate like at /oauth/token and revoke only tokens issued to them, first-party apps send no client credentials and revoke first-party tokens. Unknown, already revoked and foreign tokens are answered with 200 as well.
+// @Tags         Auth
+// @Security     BasicAuth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token formData string true "Access or refresh token"
+// @Param        token_type_hint formData string false "access_token or refresh_token"
+// @Param        client_id formData string false "Client ID, if not sent with HTTP Basic"
+// @Param        client_secret formData string false "Client secret, if not sent with HTTP Basic"
+// @Success      200 {object} SuccessResponse
+// @Failure      400 {object} OAuthErrorResponse "invalid_request: token is required"
+// @Failure      401 {object} OAuthErrorResponse "invalid_client"
+// @Failure      500 {object} OAuthErrorResponse "Internal server error"
+// @Router       /api/v1/auth/revoke [post]
+func (h *AuthHandler) RevokeToken(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	var clientID string
+	if _, _, basicAuth := parseBasicAuth(c.Get("Authorization")); basicAuth || c.FormValue("client_id") != "" {
+		client, err := h.authenticateOAuthClient(c)
+		if err != nil {
+			return oauthTokenError(c, err)
+		}
+		clientID = client.ClientID
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauthTokenError(c, &services.OAuthError{
+			Code:        services.OAuthErrorInvalidRequest,
+			Description: "token is required",
+		})
+	}
+
+	if err := h.authService.RevokeTokenPair(c.Context(), clientID, token, c.FormValue("token_type_hint")); err != nil {
+		logger.Error("Token revocation error", "client_id", clientID, "error", err)
+		return oauthTokenError(c, err)
+	}
+
+	return c.JSON(fiber.Map{"message": "token revoked"})
+}
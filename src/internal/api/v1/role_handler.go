@@ -0,0 +1,176 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type RoleResponse struct {
+	Name        string   `json:"name" example:"editor"`
+	Description string   `json:"description" example:"Edits articles"`
+	Permissions []string `json:"permissions" example:"articles:read,articles:write"`
+}
+
+type PutRoleRequest struct {
+	Description string   `json:"description" example:"Edits articles"`
+	Permissions []string `json:"permissions" example:"articles:read,articles:write"`
+}
+
+type UserRolesResponse struct {
+	Roles []string `json:"roles" example:"editor"`
+}
+
+// @Summary      List roles
+// @Description  Returns every role with its permissions.
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Success      200 {array} RoleResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/roles [get]
+func (h *AuthHandler) ListRoles(c *fiber.Ctx) error {
+	roles, err := h.roleService.ListRoles(c.Context())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not list roles"})
+	}
+
+	response := make([]RoleResponse, 0, len(roles))
+	for _, role := range roles {
+		response = append(response, RoleResponse{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+		})
+	}
+	return c.JSON(response)
+}
+
+// @Summary      Create or replace a role
+// @Description  Creates the role or replaces its description and permissions. Role names match ^[a-z][a-z0-9_.-]{0,63}$, permission names ^[a-z][a-z0-9_.:-]{0,127}$. Users get the new permissions with their next token.
+// @Tags         Admin
+// @Accept       json
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        name path string true "Role name"
+// @Param        role body PutRoleRequest true "Description and permissions"
+// @Success      200 {object} RoleResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      422 {object} ErrorResponse "Invalid role or permission name"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/roles/{name} [put]
+func (h *AuthHandler) PutRole(c *fiber.Ctx) error {
+	var req PutRoleRequest
+	if err := json.Unmarshal(c.Request().Body(), &req); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "request body is invalid format"})
+	}
+
+	role := services.Role{Name: c.Params("name"), Description: req.Description, Permissions: req.Permissions}
+	err := h.roleService.PutRole(c.Context(), role)
+	if errors.Is(err, services.ErrInvalidRole) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid role name"})
+	} else if errors.Is(err, services.ErrInvalidPermission) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid permission name"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not store role"})
+	}
+
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	return c.JSON(RoleResponse{Name: role.Name, Description: role.Description, Permissions: role.Permissions})
+}
+
+// @Summary      Delete a role
+// @Description  Deletes the role and takes it from every user.
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        name path string true "Role name"
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "Role not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/roles/{name} [delete]
+func (h *AuthHandler) DeleteRole(c *fiber.Ctx) error {
+	err := h.roleService.DeleteRole(c.Context(), c.Params("name"))
+	if errors.Is(err, services.ErrRoleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete role"})
+	}
+
+	return c.JSON(fiber.Map{"message": "role deleted"})
+}
+
+// @Summary      List roles of a user
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "User ID"
+// @Success      200 {object} UserRolesResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "User not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/users/{id}/roles [get]
+func (h *AuthHandler) ListUserRoles(c *fiber.Ctx) error {
+	roles, err := h.roleService.UserRoles(c.Context(), c.Params("id"))
+	if errors.Is(err, services.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not list user roles"})
+	}
+
+	return c.JSON(fiber.Map{"roles": roles})
+}
+
+// @Summary      Assign a role to a user
+// @Description  Assigning a role the user already has is not an error. The user gets the role with the next token.
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "User ID"
+// @Param        role path string true "Role name"
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "User or role not found"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/users/{id}/roles/{role} [put]
+func (h *AuthHandler) AssignUserRole(c *fiber.Ctx) error {
+	err := h.roleService.AssignRole(c.Context(), c.Params("id"), c.Params("role"))
+	if errors.Is(err, services.ErrUserNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+	} else if errors.Is(err, services.ErrRoleNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not assign role"})
+	}
+
+	return c.JSON(fiber.Map{"message": "role assigned"})
+}
+
+// @Summary      Take a role from a user
+// @Description  Tokens issued before keep the role until they are refreshed or expire.
+// @Tags         Admin
+// @Produce      json
+// @Param        X-Admin-Token header string true "Admin API token"
+// @Param        id path string true "User ID"
+// @Param        role path string true "Role name"
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Invalid admin token"
+// @Failure      404 {object} ErrorResponse "User doesn't have the role"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/admin/users/{id}/roles/{role} [delete]
+func (h *AuthHandler) UnassignUserRole(c *fiber.Ctx) error {
+	err := h.roleService.UnassignRole(c.Context(), c.Params("id"), c.Params("role"))
+	if errors.Is(err, services.ErrUserNotFound) || errors.Is(err, services.ErrRoleNotAssigned) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not assigned"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not unassign role"})
+	}
+
+	return c.JSON(fiber.Map{"message": "role unassigned"})
+}
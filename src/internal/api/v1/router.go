@@ -1,26 +1,106 @@
 package v1
 
 import (
+	"github.com/nikuIin/base_go_auth/src/core"
 	"github.com/nikuIin/base_go_auth/src/internal/services"
 
 	"github.com/gofiber/fiber/v2"
 	swagger "github.com/gofiber/swagger"
 )
 
+const (
+	apiPrefix = "/api/v1"
+	// refreshRoute is the refresh endpoint in the API group, the refresh
+	// cookie is scoped to it
+	refreshRoute = "/auth/token/refresh"
+)
+
 // SetupRoutes sets up all the v1 routes.
-func SetupRoutes(app *fiber.App, handler *AuthHandler, authService *services.AuthService) {
+func SetupRoutes(
+	app *fiber.App,
+	handler *AuthHandler,
+	authService *services.AuthService,
+	apiKeyService *services.APIKeyService,
+	adminConfig core.AdminConfig,
+	introspectionConfig core.IntrospectionConfig,
+) {
 	// Swagger documentation route
 	app.Get("/swagger/*", swagger.HandlerDefault)
 
-	api := app.Group("/api/v1")
+	// Public keys for offline verification of access tokens
+	app.Get("/.well-known/jwks.json", handler.GetJWKS)
+
+	authMiddleware := AuthMiddleware(authService, apiKeyService)
+	firstParty := RequireFirstParty()
 
-	authMiddleware := AuthMiddleware(authService)
+	// OAuth 2.0 authorization server
+	app.Get("/oauth/authorize", handler.OAuthAuthorize)
+	app.Post("/oauth/authorize", authMiddleware, firstParty, handler.ApproveOAuthAuthorization)
+	app.Post("/oauth/token", handler.OAuthToken)
+	app.Post("/oauth/device_authorization", handler.OAuthDeviceAuthorization)
+	app.Get("/oauth/device", authMiddleware, handler.GetDeviceRequest)
+	app.Post("/oauth/device", authMiddleware, firstParty, handler.DecideDeviceRequest)
+
+	// OpenID Connect provider
+	app.Get("/.well-known/openid-configuration", handler.GetOpenIDConfiguration)
+	userInfoMiddleware := AuthMiddleware(authService, apiKeyService, services.ScopeOpenID)
+	app.Get("/userinfo", userInfoMiddleware, handler.UserInfo)
+	app.Post("/userinfo", userInfoMiddleware, handler.UserInfo)
+
+	api := app.Group(apiPrefix)
 
 	// Auth routes
-	api.Post("/auth/token", handler.GenerateTokenPair)
-	api.Post("/auth/token/refresh", authMiddleware, handler.RefreshTokenPair)
+	api.Post("/auth/register", handler.Register)
+	api.Post("/auth/login", handler.Login)
+	api.Post("/auth/login/mfa", handler.LoginMFA)
+	api.Post("/auth/webauthn/login/begin", handler.BeginWebAuthnLogin)
+	api.Post("/auth/webauthn/login/finish", handler.FinishWebAuthnLogin)
+	api.Post("/auth/email-login", handler.RequestEmailLogin)
+	api.Post("/auth/email-login/verify", handler.VerifyEmailLogin)
+	api.Post("/auth/password/forgot", handler.ForgotPassword)
+	api.Post("/auth/password/reset", handler.ResetPassword)
+	api.Post("/auth/email/verify", handler.VerifyEmail)
+	api.Post(refreshRoute, OptionalAuth(authMiddleware), handler.RefreshTokenPair)
 	api.Post("/auth/token/logout", authMiddleware, handler.Logout)
+	api.Post("/auth/revoke", handler.RevokeToken)
+	api.Post(
+		"/auth/introspect",
+		ClientCredentialsMiddleware(introspectionConfig.Clients),
+		handler.IntrospectToken,
+	)
 
 	// User routes
 	api.Get("/user/me", authMiddleware, handler.GetMyGUID)
+	// Credentials and sessions are managed by the user's own sessions only: a
+	// client, an API key or an impersonating admin must not enroll a second
+	// factor or passkey of its own nor log the user out
+	api.Get("/user/sessions", authMiddleware, firstParty, handler.ListSessions)
+	api.Delete("/user/sessions/:id", authMiddleware, firstParty, handler.RevokeSession)
+	api.Delete("/user/sessions", authMiddleware, firstParty, handler.RevokeSessions)
+	api.Post("/user/mfa/totp", authMiddleware, firstParty, handler.EnrollTOTP)
+	api.Post("/user/mfa/totp/confirm", authMiddleware, firstParty, handler.ConfirmTOTP)
+	api.Post("/user/webauthn/register/begin", authMiddleware, firstParty, handler.BeginWebAuthnRegistration)
+	api.Post("/user/webauthn/register/finish", authMiddleware, firstParty, handler.FinishWebAuthnRegistration)
+	api.Post("/user/email/verify", authMiddleware, firstParty, handler.RequestEmailVerification)
+	api.Post("/user/api-keys", authMiddleware, firstParty, handler.CreateAPIKey)
+	api.Get("/user/api-keys", authMiddleware, firstParty, handler.ListAPIKeys)
+	api.Delete("/user/api-keys/:id", authMiddleware, firstParty, handler.RevokeAPIKey)
+
+	// Admin routes
+	admin := api.Group("/admin", AdminMiddleware(adminConfig.APIToken))
+	admin.Post("/keys/rotate", handler.RotateSigningKey)
+	admin.Get("/roles", handler.ListRoles)
+	admin.Put("/roles/:name", handler.PutRole)
+	admin.Delete("/roles/:name", handler.DeleteRole)
+	admin.Post("/users/:id/impersonate", handler.ImpersonateUser)
+	admin.Get("/users/:id/impersonations", handler.ListImpersonations)
+	admin.Get("/users/:id/roles", handler.ListUserRoles)
+	admin.Put("/users/:id/roles/:role", handler.AssignUserRole)
+	admin.Delete("/users/:id/roles/:role", handler.UnassignUserRole)
+	admin.Post("/oauth/clients", handler.RegisterOAuthClient)
+	admin.Get("/oauth/clients", handler.ListOAuthClients)
+	admin.Delete("/oauth/clients/:id", handler.DeleteOAuthClient)
+	admin.Post("/oauth/clients/:id/api-keys", handler.CreateClientAPIKey)
+	admin.Get("/oauth/clients/:id/api-keys", handler.ListClientAPIKeys)
+	admin.Delete("/oauth/clients/:id/api-keys/:key_id", handler.RevokeClientAPIKey)
 }
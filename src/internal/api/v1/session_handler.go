@@ -0,0 +1,153 @@
+package v1
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+type DeviceResponse struct {
+	Browser string `json:"browser" example:"Firefox"`
+	OS      string `json:"os" example:"Linux"`
+	Type    string `json:"type" example:"desktop"`
+}
+
+type SessionResponse struct {
+	ID              string         `json:"id" example:"b7f0c7d2-7c4e-4a57-9d7e-2a8f1c6e3f10"`
+	IPAddress       string         `json:"ip_address" example:"192.168.1.10"`
+	UserAgent       string         `json:"user_agent" example:"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"`
+	Device          DeviceResponse `json:"device"`
+	AuthenticatedAt time.Time      `json:"authenticated_at" example:"2025-07-24T09:59:43+04:00"`
+	LastUsedAt      time.Time      `json:"last_used_at" example:"2025-07-25T10:00:00+04:00"`
+	ExpiresAt       time.Time      `json:"expires_at" example:"2025-08-09T10:00:00+04:00"`
+	Current         bool           `json:"current" example:"true"`
+}
+
+type SessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+type RevokedSessionsResponse struct {
+	RevokedCount int `json:"revoked_count" example:"2"`
+}
+
+// @Summary      List sessions
+// @Description  Returns the live sessions of the current user with their device information. The session of the presented access token is marked as current.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Success      200 {object} SessionsResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/sessions [get]
+func (h *AuthHandler) ListSessions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+	jti, _ := c.Locals("jti").(string)
+
+	sessions, err := h.authService.ListSessions(c.Context(), userID, jti)
+	if err != nil {
+		logger.Error("List sessions error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not list sessions"})
+	}
+
+	response := SessionsResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionResponse{
+			ID:        session.ID,
+			IPAddress: session.IPAddress,
+			UserAgent: session.UserAgent,
+			Device: DeviceResponse{
+				Browser: session.Device.Browser,
+				OS:      session.Device.OS,
+				Type:    session.Device.Type,
+			},
+			AuthenticatedAt: session.AuthenticatedAt,
+			LastUsedAt:      session.LastUsedAt,
+			ExpiresAt:       session.ExpiresAt,
+			Current:         session.Current,
+		})
+	}
+
+	return c.JSON(response)
+}
+
+// @Summary      Revoke a session
+// @Description  Logs the current user out of the session: its refresh tokens are deleted and access tokens blocked.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        id path string true "Session ID" Format(uuid)
+// @Success      200 {object} SuccessResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      404 {object} ErrorResponse "Session not found"
+// @Failure      422 {object} ErrorResponse "Session id must be a valid UUID"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	sessionID := c.Params("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "session id must be a valid UUID"})
+	}
+
+	err := h.authService.RevokeSession(c.Context(), userID, sessionID)
+	if errors.Is(err, services.ErrSessionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+	} else if err != nil {
+		logger.Error("Revoke session error", "user_id", userID, "session_id", sessionID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke session"})
+	}
+
+	return c.JSON(fiber.Map{"message": "session revoked"})
+}
+
+// @Summary      Revoke sessions
+// @Description  Logs the current user out of every session, or of every other session with except=current.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        except query string false "Keep the current session" Enums(current)
+// @Success      200 {object} RevokedSessionsResponse
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      422 {object} ErrorResponse "Invalid except value"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/sessions [delete]
+func (h *AuthHandler) RevokeSessions(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	var exceptJTI string
+	switch c.Query("except") {
+	case "":
+	case "current":
+		exceptJTI, _ = c.Locals("jti").(string)
+	default:
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "except must be current"})
+	}
+
+	revokedCount, err := h.authService.RevokeSessions(c.Context(), userID, exceptJTI)
+	if err != nil {
+		logger.Error("Revoke sessions error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke sessions"})
+	}
+
+	return c.JSON(fiber.Map{"revoked_count": revokedCount})
+}
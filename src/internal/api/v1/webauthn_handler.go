@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nikuIin/base_go_auth/src/internal/services"
+)
+
+// @Summary      Start passkey registration
+// @Description  Returns the PublicKeyCredentialCreationOptions for navigator.credentials.create(). The challenge is valid for 5 minutes.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Success      200 {object} object "{publicKey: PublicKeyCredentialCreationOptions}"
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/webauthn/register/begin [post]
+func (h *AuthHandler) BeginWebAuthnRegistration(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	creation, err := h.webAuthnService.BeginRegistration(c.Context(), userID)
+	if err != nil {
+		logger.Error("WebAuthn registration error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start passkey registration"})
+	}
+
+	return c.JSON(creation)
+}
+
+// @Summary      Finish passkey registration
+// @Description  Verifies the PublicKeyCredential returned by navigator.credentials.create() and stores the passkey. Attestation formats "none" and "packed" are accepted.
+// @Tags         User
+// @Security     ApiKeyAuth
+// @Accept       json
+// @Produce      json
+// @Param        Authorization header string true "Bearer {access_token}"
+// @Param        credential body object true "PublicKeyCredential"
+// @Success      201 {object} SuccessResponse
+// @Failure      400 {object} ErrorResponse "Invalid or expired challenge"
+// @Failure      401 {object} ErrorResponse "Unauthorized: invalid or missing token"
+// @Failure      403 {object} ErrorResponse "Not the user's own session: token of an OAuth client, exchanged or impersonation token, or an API key"
+// @Failure      409 {object} ErrorResponse "Passkey already registered"
+// @Failure      422 {object} ErrorResponse "Verification failed or unsupported attestation"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/user/webauthn/register/finish [post]
+func (h *AuthHandler) FinishWebAuthnRegistration(c *fiber.Ctx) error {
+	userID, ok := c.Locals("user_id").(string)
+	if !ok || userID == "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid token"})
+	}
+
+	err := h.webAuthnService.FinishRegistration(c.Context(), userID, c.Body())
+	if errors.Is(err, services.ErrInvalidWebAuthnChallenge) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "challenge is invalid or expired"})
+	} else if errors.Is(err, services.ErrCredentialAlreadyExists) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "passkey already registered"})
+	} else if errors.Is(err, services.ErrWebAuthnVerification) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "passkey verification failed"})
+	} else if errors.Is(err, services.ErrUnsupportedAttestation) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unsupported attestation format"})
+	} else if err != nil {
+		logger.Error("WebAuthn registration error", "user_id", userID, "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not register passkey"})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "passkey registered"})
+}
+
+// @Summary      Start passkey login
+// @Description  Returns the PublicKeyCredentialRequestOptions for navigator.credentials.get(). The authenticator picks the account, so no login is needed. The challenge is valid for 5 minutes.
+// @Tags         Auth
+// @Produce      json
+// @Success      200 {object} object "{publicKey: PublicKeyCredentialRequestOptions}"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/webauthn/login/begin [post]
+func (h *AuthHandler) BeginWebAuthnLogin(c *fiber.Ctx) error {
+	assertion, err := h.webAuthnService.BeginLogin(c.Context())
+	if err != nil {
+		logger.Error("WebAuthn login error", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start passkey login"})
+	}
+
+	return c.JSON(assertion)
+}
+
+// @Summary      Finish passkey login
+// @Description  Verifies the PublicKeyCredential returned by navigator.credentials.get() and generates a new token pair. Users with TOTP enabled get an MFA challenge token instead.
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        credential body object true "PublicKeyCredential"
+// @Param        DPoP header string false "DPoP proof (RFC 9449) for POST of this URL, binds the session to its key"
+// @Success      200 {object} TokenPairResponse
+// @Success      202 {object} MFAChallengeResponse "Second factor required"
+// @Failure      400 {object} ErrorResponse "Invalid or expired challenge"
+// @Failure      401 {object} ErrorResponse "Passkey verification failed or invalid DPoP proof"
+// @Failure      409 {object} ErrorResponse "Maximum number of sessions reached"
+// @Failure      500 {object} ErrorResponse "Internal server error"
+// @Router       /api/v1/auth/webauthn/login/finish [post]
+func (h *AuthHandler) FinishWebAuthnLogin(c *fiber.Ctx) error {
+	ipAddress := h.getFirstValidIP(c)
+	userAgent := string(c.Request().Header.UserAgent())
+
+	// Create a new context and add IP and User-Agent to it
+	ctxWithData := context.WithValue(c.Context(), ipAddressContextKey, ipAddress)
+	ctxWithData = context.WithValue(ctxWithData, userAgentContextKey, userAgent)
+
+	binding, err := h.loginBinding(c)
+	if err != nil {
+		return dpopProofError(c, err)
+	}
+
+	userID, err := h.webAuthnService.FinishLogin(ctxWithData, c.Body())
+	if errors.Is(err, services.ErrInvalidWebAuthnChallenge) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "challenge is invalid or expired"})
+	} else if errors.Is(err, services.ErrWebAuthnVerification) || errors.Is(err, services.ErrAuthenticatorCloned) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "passkey verification failed"})
+	} else if err != nil {
+		logger.Error("WebAuthn login error", "error", err, "ip_address", ipAddress)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not verify passkey"})
+	}
+
+	result, err := h.authService.StartSession(
+		ctxWithData, userID, services.AuthMethodHardwareKey, ipAddress, userAgent, binding,
+	)
+	if errors.Is(err, services.ErrSessionLimitReached) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "maximum number of sessions reached"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate tokens"})
+	}
+
+	return h.loginResponse(c, result)
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// apiKeyTouchInterval throttles the last-used writes of busy keys.
+const apiKeyTouchInterval = time.Minute
+
+type APIKeyData struct {
+	ID      string
+	Prefix  string
+	KeyHash string
+	Name    string
+	// Exactly one of UserID and ClientID is set
+	UserID     sql.NullString
+	ClientID   sql.NullString
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	LastUsedIP sql.NullString
+	CreatedAt  time.Time
+}
+
+type APIKeyRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewAPIKeyRepository(db *sql.DB, logger *slog.Logger) *APIKeyRepository {
+	return &APIKeyRepository{db: db, logger: logger}
+}
+
+// CreateAPIKey returns ErrAlreadyExists if the prefix is taken.
+func (r *APIKeyRepository) CreateAPIKey(ctx context.Context, key APIKeyData) error {
+	query := `
+		INSERT INTO api_key (id, prefix, key_hash, name, user_id, client_id, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5::UUID, $6, $7, $8);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		key.ID, key.Prefix, key.KeyHash, key.Name, key.UserID, key.ClientID, pq.Array(key.Scopes), key.ExpiresAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	} else if err != nil {
+		r.logger.Error("Failed to create API key", "error", err, "prefix", key.Prefix)
+		return err
+	}
+
+	r.logger.Debug("Successfully created API key", "prefix", key.Prefix)
+	return nil
+}
+
+// GetAPIKeyByPrefix returns the key, sql.ErrNoRows if it doesn't exist.
+func (r *APIKeyRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (APIKeyData, error) {
+	query := `
+		SELECT id, prefix, key_hash, name, user_id, client_id, scopes, expires_at, last_used_at, last_used_ip,
+			created_at
+		FROM api_key
+			WHERE prefix = $1;
+	`
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, prefix))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get API key from db", "error", err, "prefix", prefix)
+		}
+		return APIKeyData{}, err
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of the user or of the client, whichever is set.
+func (r *APIKeyRepository) ListAPIKeys(ctx context.Context, userID, clientID sql.NullString) ([]APIKeyData, error) {
+	query := `
+		SELECT id, prefix, key_hash, name, user_id, client_id, scopes, expires_at, last_used_at, last_used_ip,
+			created_at
+		FROM api_key
+			WHERE user_id = $1::UUID OR client_id = $2
+		ORDER BY created_at;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, clientID)
+	if err != nil {
+		r.logger.Error("Failed to get API keys from db", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKeyData{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			r.logger.Error("Failed to scan API key", "error", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate API keys", "error", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey deletes the key of the user or of the client, whichever is set.
+// It reports false if they have no such key.
+func (r *APIKeyRepository) DeleteAPIKey(ctx context.Context, id string, userID, clientID sql.NullString) (bool, error) {
+	query := `DELETE FROM api_key WHERE id = $1::UUID AND (user_id = $2::UUID OR client_id = $3);`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID, clientID)
+	if err != nil {
+		r.logger.Error("Failed to delete API key", "error", err, "id", id)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// TouchAPIKey records the use of the key. Uses from the same address are
+// recorded at most once per apiKeyTouchInterval.
+func (r *APIKeyRepository) TouchAPIKey(ctx context.Context, id, ipAddress string) error {
+	query := `
+		UPDATE api_key SET last_used_at = current_timestamp, last_used_ip = $2
+			WHERE id = $1::UUID AND (
+				last_used_at IS NULL
+				OR last_used_at < current_timestamp - $3 * interval '1 second'
+				OR last_used_ip IS DISTINCT FROM $2
+			);
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id, ipAddress, int(apiKeyTouchInterval.Seconds()))
+	if err != nil {
+		r.logger.Error("Failed to touch API key", "error", err, "id", id)
+		return err
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (APIKeyData, error) {
+	var key APIKeyData
+	err := row.Scan(
+		&key.ID,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Name,
+		&key.UserID,
+		&key.ClientID,
+		pq.Array(&key.Scopes),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.CreatedAt,
+	)
+	return key, err
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+type EmailLoginCodeData struct {
+	ChallengeID string
+	Email       string
+	// UserID is null for addresses that don't belong to a user
+	UserID        sql.NullString
+	LinkTokenHash string
+	CodeHash      string
+	UserAgent     string
+	Attempts      int
+	ExpiresAt     time.Time
+}
+
+type EmailLoginRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewEmailLoginRepository(db *sql.DB, logger *slog.Logger) *EmailLoginRepository {
+	return &EmailLoginRepository{db: db, logger: logger}
+}
+
+// CountEmailLoginCodesSince counts the codes requested for the address since the time.
+func (r *EmailLoginRepository) CountEmailLoginCodesSince(ctx context.Context, email string, since time.Time) (int, error) {
+	query := `SELECT count(*) FROM email_login_code WHERE email = $1 AND created_at > $2;`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, email, since).Scan(&count); err != nil {
+		r.logger.Error("Failed to count email login codes", "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// StoreEmailLoginCode stores a new code and expires the live codes of the
+// address, so only the latest mail works. Rows created before pruneBefore are
+// deleted.
+func (r *EmailLoginRepository) StoreEmailLoginCode(
+	ctx context.Context, codeData EmailLoginCodeData, pruneBefore time.Time,
+) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin email login code transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	expireQuery := `
+		UPDATE email_login_code SET expires_at = current_timestamp
+			WHERE email = $1 AND used_at IS NULL AND expires_at > current_timestamp;
+	`
+	if _, err = tx.ExecContext(ctx, expireQuery, codeData.Email); err != nil {
+		r.logger.Error("Failed to expire old email login codes", "error", err)
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO email_login_code
+			(challenge_id, email, user_id, link_token_hash, code_hash, user_agent, expires_at)
+		VALUES ($1::UUID, $2, $3::UUID, $4, $5, $6, $7);
+	`
+	_, err = tx.ExecContext(ctx, insertQuery,
+		codeData.ChallengeID,
+		codeData.Email,
+		codeData.UserID,
+		codeData.LinkTokenHash,
+		codeData.CodeHash,
+		codeData.UserAgent,
+		codeData.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store email login code", "error", err)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit email login code transaction", "error", err)
+		return err
+	}
+
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM email_login_code WHERE created_at < $1;`, pruneBefore); err != nil {
+		r.logger.Warn("Failed to delete old email login codes", "error", err)
+	}
+
+	r.logger.Debug("Successfully stored email login code", "challenge_id", codeData.ChallengeID)
+	return nil
+}
+
+// GetEmailLoginCodeByLink returns the live code with the link token hash,
+// sql.ErrNoRows if there is none.
+func (r *EmailLoginRepository) GetEmailLoginCodeByLink(ctx context.Context, linkTokenHash string) (EmailLoginCodeData, error) {
+	query := `
+		SELECT challenge_id, email, user_id, link_token_hash, code_hash, user_agent, attempts, expires_at
+		FROM email_login_code
+			WHERE link_token_hash = $1 AND used_at IS NULL AND expires_at > current_timestamp;
+	`
+	return r.getEmailLoginCode(ctx, query, linkTokenHash)
+}
+
+// ReserveEmailLoginCodeAttempt counts an attempt of the live code of the
+// address before it is checked, so concurrent requests can't exceed
+// maxAttempts. It returns the code, sql.ErrNoRows if there is none or it has no
+// attempts left.
+func (r *EmailLoginRepository) ReserveEmailLoginCodeAttempt(
+	ctx context.Context, email string, maxAttempts int,
+) (EmailLoginCodeData, error) {
+	query := `
+		UPDATE email_login_code SET attempts = attempts + 1
+			WHERE challenge_id = (
+				SELECT challenge_id FROM email_login_code
+					WHERE email = $1 AND used_at IS NULL AND expires_at > current_timestamp
+				ORDER BY created_at DESC
+				LIMIT 1
+			) AND attempts < $2
+		RETURNING challenge_id, email, user_id, link_token_hash, code_hash, user_agent, attempts, expires_at;
+	`
+	return r.getEmailLoginCode(ctx, query, email, maxAttempts)
+}
+
+// ConsumeEmailLoginCode marks the code as used. It reports false if the code
+// was used or expired in the meantime, so a code completes a single login.
+func (r *EmailLoginRepository) ConsumeEmailLoginCode(ctx context.Context, challengeID string) (bool, error) {
+	query := `
+		UPDATE email_login_code SET used_at = current_timestamp
+			WHERE challenge_id = $1::UUID AND used_at IS NULL AND expires_at > current_timestamp;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, challengeID)
+	if err != nil {
+		r.logger.Error("Failed to consume email login code", "error", err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *EmailLoginRepository) getEmailLoginCode(ctx context.Context, query string, args ...any) (EmailLoginCodeData, error) {
+	var codeData EmailLoginCodeData
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&codeData.ChallengeID,
+		&codeData.Email,
+		&codeData.UserID,
+		&codeData.LinkTokenHash,
+		&codeData.CodeHash,
+		&codeData.UserAgent,
+		&codeData.Attempts,
+		&codeData.ExpiresAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get email login code from db", "error", err)
+		}
+		return EmailLoginCodeData{}, err
+	}
+
+	return codeData, nil
+}
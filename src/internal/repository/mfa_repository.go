@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type TOTPData struct {
+	UserID          string
+	SecretEncrypted string
+	ConfirmedAt     sql.NullTime
+	LastUsedStep    int64
+}
+
+type MFAChallengeData struct {
+	ChallengeHash string
+	UserID        string
+	// AuthMethod is the method of the first login step
+	AuthMethod string
+	Attempts   int
+	ExpiresAt  time.Time
+}
+
+type MFARepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewMFARepository(db *sql.DB, logger *slog.Logger) *MFARepository {
+	return &MFARepository{db: db, logger: logger}
+}
+
+// GetTOTP returns the TOTP enrollment of the user, sql.ErrNoRows if there is none.
+func (r *MFARepository) GetTOTP(ctx context.Context, userID string) (TOTPData, error) {
+	query := `
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step
+		FROM user_totp
+			WHERE user_id = $1::UUID;
+	`
+
+	var totpData TOTPData
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&totpData.UserID,
+		&totpData.SecretEncrypted,
+		&totpData.ConfirmedAt,
+		&totpData.LastUsedStep,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get TOTP from db", "error", err, "userID", userID)
+		}
+		return TOTPData{}, err
+	}
+
+	return totpData, nil
+}
+
+// StorePendingTOTP stores a new unconfirmed secret, replacing an unconfirmed one.
+// ErrAlreadyExists means the user has a confirmed secret.
+func (r *MFARepository) StorePendingTOTP(ctx context.Context, userID, secretEncrypted string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret_encrypted)
+		VALUES ($1::UUID, $2)
+		ON CONFLICT (user_id) DO UPDATE
+			SET secret_encrypted = excluded.secret_encrypted, created_at = current_timestamp
+			WHERE user_totp.confirmed_at IS NULL;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secretEncrypted)
+	if err != nil {
+		r.logger.Error("Failed to store pending TOTP", "error", err, "userID", userID)
+		return err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rowsAffected == 0 {
+		return ErrAlreadyExists
+	}
+
+	r.logger.Debug("Successfully stored pending TOTP", "userID", userID)
+	return nil
+}
+
+// ConfirmTOTP enables the pending secret and replaces the recovery codes. It
+// reports false if there was no pending secret.
+func (r *MFARepository) ConfirmTOTP(ctx context.Context, userID string, step int64, codeHashes []string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin TOTP confirmation transaction", "error", err)
+		return false, err
+	}
+	defer tx.Rollback()
+
+	confirmQuery := `
+		UPDATE user_totp SET confirmed_at = current_timestamp, last_used_step = $2
+			WHERE user_id = $1::UUID AND confirmed_at IS NULL;
+	`
+	result, err := tx.ExecContext(ctx, confirmQuery, userID, step)
+	if err != nil {
+		r.logger.Error("Failed to confirm TOTP", "error", err, "userID", userID)
+		return false, err
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return false, err
+	} else if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_code WHERE user_id = $1::UUID;`, userID); err != nil {
+		r.logger.Error("Failed to delete recovery codes", "error", err, "userID", userID)
+		return false, err
+	}
+
+	insertQuery := `
+		INSERT INTO mfa_recovery_code (user_id, code_hash)
+		SELECT $1::UUID, unnest($2::VARCHAR[]);
+	`
+	if _, err = tx.ExecContext(ctx, insertQuery, userID, pq.Array(codeHashes)); err != nil {
+		r.logger.Error("Failed to store recovery codes", "error", err, "userID", userID)
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit TOTP confirmation transaction", "error", err, "userID", userID)
+		return false, err
+	}
+
+	r.logger.Debug("Successfully confirmed TOTP", "userID", userID, "recovery_codes", len(codeHashes))
+	return true, nil
+}
+
+// UseTOTPStep records the step of an accepted code. It reports false if the
+// step, or a later one, was used already.
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp SET last_used_step = $2
+			WHERE user_id = $1::UUID AND confirmed_at IS NOT NULL AND last_used_step < $2;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		r.logger.Error("Failed to use TOTP step", "error", err, "userID", userID)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks the code as used. It reports false if the code doesn't
+// exist or was used already.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_code SET used_at = current_timestamp
+			WHERE user_id = $1::UUID AND code_hash = $2 AND used_at IS NULL;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		r.logger.Error("Failed to use recovery code", "error", err, "userID", userID)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	r.logger.Debug("Recovery code used", "userID", userID, "found", rowsAffected == 1)
+	return rowsAffected == 1, nil
+}
+
+func (r *MFARepository) StoreMFAChallenge(
+	ctx context.Context, challengeHash, userID, authMethod string, expiresAt time.Time,
+) error {
+	query := `
+		INSERT INTO mfa_challenge (challenge_hash, user_id, auth_method, expires_at)
+		VALUES ($1, $2::UUID, $3, $4);
+	`
+
+	_, err := r.db.ExecContext(ctx, query, challengeHash, userID, authMethod, expiresAt)
+	if err != nil {
+		r.logger.Error("Failed to store MFA challenge", "error", err, "userID", userID)
+		return err
+	}
+
+	// Expired challenges are useless, drop them while we are here
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM mfa_challenge WHERE expires_at < current_timestamp;`); err != nil {
+		r.logger.Warn("Failed to delete expired MFA challenges", "error", err)
+	}
+
+	r.logger.Debug("Successfully stored MFA challenge", "userID", userID)
+	return nil
+}
+
+// ReserveMFAChallengeAttempt counts an attempt of the live challenge before
+// its code is checked, so concurrent requests can't exceed maxAttempts. It
+// returns sql.ErrNoRows if the challenge doesn't exist, expired or has no
+// attempts left.
+func (r *MFARepository) ReserveMFAChallengeAttempt(
+	ctx context.Context, challengeHash string, maxAttempts int,
+) (MFAChallengeData, error) {
+	query := `
+		UPDATE mfa_challenge SET attempts = attempts + 1
+			WHERE challenge_hash = $1 AND attempts < $2 AND expires_at > current_timestamp
+		RETURNING challenge_hash, user_id, auth_method, attempts, expires_at;
+	`
+
+	var challengeData MFAChallengeData
+	err := r.db.QueryRowContext(ctx, query, challengeHash, maxAttempts).Scan(
+		&challengeData.ChallengeHash,
+		&challengeData.UserID,
+		&challengeData.AuthMethod,
+		&challengeData.Attempts,
+		&challengeData.ExpiresAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to reserve MFA challenge attempt", "error", err)
+		}
+		return MFAChallengeData{}, err
+	}
+
+	return challengeData, nil
+}
+
+// ReserveMFAAttempt counts a code of the user before it is checked. Reaching
+// maxAttempts locks the user out of MFA for lockout, ReserveMFAAttempt reports
+// false while the lock lasts. ClearMFAAttempts resets the count.
+func (r *MFARepository) ReserveMFAAttempt(
+	ctx context.Context, userID string, maxAttempts int, lockout time.Duration,
+) (bool, error) {
+	// An expired lock starts a new count
+	query := `
+		UPDATE user_totp SET
+			failed_attempts = CASE WHEN locked_until IS NULL THEN failed_attempts + 1 ELSE 1 END,
+			locked_until = CASE
+				WHEN (CASE WHEN locked_until IS NULL THEN failed_attempts + 1 ELSE 1 END) >= $2
+					THEN current_timestamp + make_interval(secs => $3)
+			END
+		WHERE user_id = $1::UUID AND (locked_until IS NULL OR locked_until <= current_timestamp);
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, maxAttempts, lockout.Seconds())
+	if err != nil {
+		r.logger.Error("Failed to reserve MFA attempt", "error", err, "userID", userID)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// ClearMFAAttempts resets the count of ReserveMFAAttempt after an accepted code.
+func (r *MFARepository) ClearMFAAttempts(ctx context.Context, userID string) error {
+	query := `UPDATE user_totp SET failed_attempts = 0, locked_until = NULL WHERE user_id = $1::UUID;`
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		r.logger.Error("Failed to clear MFA attempts", "error", err, "userID", userID)
+		return err
+	}
+	return nil
+}
+
+// ConsumeMFAChallenge deletes the challenge. It reports false if it was consumed
+// already, so a challenge completes a single login.
+func (r *MFARepository) ConsumeMFAChallenge(ctx context.Context, challengeHash string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM mfa_challenge WHERE challenge_hash = $1;`, challengeHash)
+	if err != nil {
+		r.logger.Error("Failed to consume MFA challenge", "error", err)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
@@ -0,0 +1,408 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type OAuthClientData struct {
+	ClientID string
+	// ClientSecretHash is null for public clients
+	ClientSecretHash sql.NullString
+	Name             string
+	RedirectURIs     []string
+	Scopes           []string
+	GrantTypes       []string
+	// AccessTokenTTL is the lifetime of client_credentials tokens in seconds,
+	// null for the default
+	AccessTokenTTL sql.NullInt64
+	// TLSClientAuthAttribute and TLSClientAuthValue are set for clients that
+	// authenticate with a TLS client certificate
+	TLSClientAuthAttribute sql.NullString
+	TLSClientAuthValue     sql.NullString
+	CreatedAt              time.Time
+}
+
+type AuthorizationCodeData struct {
+	CodeHash      string
+	ClientID      string
+	UserID        string
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string
+	ExpiresAt     time.Time
+	// RedirectURIRequested is false when the redirect URI was filled in for
+	// a client with a single one
+	RedirectURIRequested bool
+	// Nonce is the OpenID Connect nonce, put into the ID token
+	Nonce sql.NullString
+	// AuthTime and AuthMethods describe the login of the approving session
+	AuthTime    time.Time
+	AuthMethods []string
+}
+
+type OAuthRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewOAuthRepository(db *sql.DB, logger *slog.Logger) *OAuthRepository {
+	return &OAuthRepository{db: db, logger: logger}
+}
+
+func (r *OAuthRepository) CreateClient(ctx context.Context, client OAuthClientData) error {
+	query := `
+		INSERT INTO oauth_client (
+			client_id, client_secret_hash, name, redirect_uris, scopes, grant_types, access_token_ttl_seconds,
+			tls_client_auth_attribute, tls_client_auth_value
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		client.ClientID, client.ClientSecretHash, client.Name, pq.Array(client.RedirectURIs), pq.Array(client.Scopes),
+		pq.Array(client.GrantTypes), client.AccessTokenTTL, client.TLSClientAuthAttribute, client.TLSClientAuthValue,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	} else if err != nil {
+		r.logger.Error("Failed to create OAuth client", "error", err, "client_id", client.ClientID)
+		return err
+	}
+
+	r.logger.Debug("Successfully created OAuth client", "client_id", client.ClientID)
+	return nil
+}
+
+// GetClient returns the client, sql.ErrNoRows if it doesn't exist.
+func (r *OAuthRepository) GetClient(ctx context.Context, clientID string) (OAuthClientData, error) {
+	query := `
+		SELECT client_id, client_secret_hash, name, redirect_uris, scopes, grant_types, access_token_ttl_seconds,
+			tls_client_auth_attribute, tls_client_auth_value, created_at
+		FROM oauth_client
+			WHERE client_id = $1;
+	`
+
+	var client OAuthClientData
+	err := r.db.QueryRowContext(ctx, query, clientID).Scan(
+		&client.ClientID,
+		&client.ClientSecretHash,
+		&client.Name,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.Scopes),
+		pq.Array(&client.GrantTypes),
+		&client.AccessTokenTTL,
+		&client.TLSClientAuthAttribute,
+		&client.TLSClientAuthValue,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get OAuth client from db", "error", err, "client_id", clientID)
+		}
+		return OAuthClientData{}, err
+	}
+
+	return client, nil
+}
+
+func (r *OAuthRepository) ListClients(ctx context.Context) ([]OAuthClientData, error) {
+	query := `
+		SELECT client_id, client_secret_hash, name, redirect_uris, scopes, grant_types, access_token_ttl_seconds,
+			tls_client_auth_attribute, tls_client_auth_value, created_at
+		FROM oauth_client
+		ORDER BY created_at;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.Error("Failed to get OAuth clients from db", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []OAuthClientData{}
+	for rows.Next() {
+		var client OAuthClientData
+		err := rows.Scan(
+			&client.ClientID,
+			&client.ClientSecretHash,
+			&client.Name,
+			pq.Array(&client.RedirectURIs),
+			pq.Array(&client.Scopes),
+			pq.Array(&client.GrantTypes),
+			&client.AccessTokenTTL,
+			&client.TLSClientAuthAttribute,
+			&client.TLSClientAuthValue,
+			&client.CreatedAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan OAuth client", "error", err)
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate OAuth clients", "error", err)
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// DeleteClient deletes the client together with its codes and refresh tokens.
+// It reports false if the client doesn't exist.
+func (r *OAuthRepository) DeleteClient(ctx context.Context, clientID string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM oauth_client WHERE client_id = $1;`, clientID)
+	if err != nil {
+		r.logger.Error("Failed to delete OAuth client", "error", err, "client_id", clientID)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *OAuthRepository) StoreAuthorizationCode(ctx context.Context, code AuthorizationCodeData) error {
+	query := `
+		INSERT INTO oauth_authorization_code (
+			code_hash, client_id, user_id, redirect_uri, scope, code_challenge, expires_at,
+			nonce, auth_time, auth_methods, redirect_uri_requested
+		)
+		VALUES ($1, $2, $3::UUID, $4, $5, $6, $7, $8, $9, $10, $11);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.CodeChallenge, code.ExpiresAt,
+		code.Nonce, code.AuthTime, pq.Array(code.AuthMethods), code.RedirectURIRequested,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store authorization code", "error", err, "client_id", code.ClientID)
+		return err
+	}
+
+	// Expired codes are useless, drop them while we are here
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM oauth_authorization_code WHERE expires_at < current_timestamp;`); err != nil {
+		r.logger.Warn("Failed to delete expired authorization codes", "error", err)
+	}
+
+	r.logger.Debug("Successfully stored authorization code", "client_id", code.ClientID, "userID", code.UserID)
+	return nil
+}
+
+// ConsumeAuthorizationCode marks a live code as used and returns it.
+// sql.ErrNoRows means the code doesn't exist, has expired or was used already.
+func (r *OAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (AuthorizationCodeData, error) {
+	query := `
+		UPDATE oauth_authorization_code SET used_at = current_timestamp
+			WHERE code_hash = $1 AND used_at IS NULL AND expires_at > current_timestamp
+		RETURNING code_hash, client_id, user_id, redirect_uri, scope, code_challenge, expires_at,
+			nonce, auth_time, auth_methods, redirect_uri_requested;
+	`
+
+	var code AuthorizationCodeData
+	err := r.db.QueryRowContext(ctx, query, codeHash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.ExpiresAt,
+		&code.Nonce,
+		&code.AuthTime,
+		pq.Array(&code.AuthMethods),
+		&code.RedirectURIRequested,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to consume authorization code", "error", err)
+		}
+		return AuthorizationCodeData{}, err
+	}
+
+	r.logger.Debug("Successfully consumed authorization code", "client_id", code.ClientID, "userID", code.UserID)
+	return code, nil
+}
+
+// Statuses of device codes.
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeUsed     = "used"
+)
+
+type DeviceCodeData struct {
+	DeviceCodeHash string
+	UserCode       string
+	ClientID       string
+	Scope          string
+	Status         string
+	// UserID, AuthTime and AuthMethods are set when the user decides
+	UserID       sql.NullString
+	AuthTime     sql.NullTime
+	AuthMethods  []string
+	Interval     int
+	LastPolledAt sql.NullTime
+	ExpiresAt    time.Time
+	// UserAgent is the User-Agent of the device that requested the code
+	UserAgent string
+}
+
+// StoreDeviceCode returns ErrAlreadyExists if the user code is taken.
+func (r *OAuthRepository) StoreDeviceCode(ctx context.Context, code DeviceCodeData) error {
+	// Expired codes hold their user codes, drop them first
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oauth_device_code WHERE expires_at < current_timestamp;`); err != nil {
+		r.logger.Warn("Failed to delete expired device codes", "error", err)
+	}
+
+	query := `
+		INSERT INTO oauth_device_code (
+			device_code_hash, user_code, client_id, scope, interval_seconds, expires_at, user_agent
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		code.DeviceCodeHash, code.UserCode, code.ClientID, code.Scope, code.Interval, code.ExpiresAt, code.UserAgent,
+	)
+	if isUniqueViolation(err) {
+		return ErrAlreadyExists
+	} else if err != nil {
+		r.logger.Error("Failed to store device code", "error", err, "client_id", code.ClientID)
+		return err
+	}
+
+	r.logger.Debug("Successfully stored device code", "client_id", code.ClientID)
+	return nil
+}
+
+// GetDeviceCode returns the code, sql.ErrNoRows if it doesn't exist.
+func (r *OAuthRepository) GetDeviceCode(ctx context.Context, deviceCodeHash string) (DeviceCodeData, error) {
+	query := `
+		SELECT device_code_hash, user_code, client_id, scope, status, user_id, auth_time, auth_methods,
+			interval_seconds, last_polled_at, expires_at, user_agent
+		FROM oauth_device_code
+			WHERE device_code_hash = $1;
+	`
+
+	code, err := scanDeviceCode(r.db.QueryRowContext(ctx, query, deviceCodeHash))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get device code from db", "error", err)
+		}
+		return DeviceCodeData{}, err
+	}
+
+	return code, nil
+}
+
+// GetPendingDeviceCode returns the live code waiting for the user with the user
+// code, sql.ErrNoRows if there is none.
+func (r *OAuthRepository) GetPendingDeviceCode(ctx context.Context, userCode string) (DeviceCodeData, error) {
+	query := `
+		SELECT device_code_hash, user_code, client_id, scope, status, user_id, auth_time, auth_methods,
+			interval_seconds, last_polled_at, expires_at, user_agent
+		FROM oauth_device_code
+			WHERE user_code = $1 AND status = 'pending' AND expires_at > current_timestamp;
+	`
+
+	code, err := scanDeviceCode(r.db.QueryRowContext(ctx, query, userCode))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get device code from db", "error", err)
+		}
+		return DeviceCodeData{}, err
+	}
+
+	return code, nil
+}
+
+// DecideDeviceCode records the decision of the user on a live pending code.
+// It reports false if there is no such code.
+func (r *OAuthRepository) DecideDeviceCode(ctx context.Context, code DeviceCodeData) (bool, error) {
+	query := `
+		UPDATE oauth_device_code
+			SET status = $2, user_id = $3::UUID, scope = $4, auth_time = $5, auth_methods = $6
+			WHERE user_code = $1 AND status = 'pending' AND expires_at > current_timestamp;
+	`
+
+	result, err := r.db.ExecContext(ctx, query,
+		code.UserCode, code.Status, code.UserID, code.Scope, code.AuthTime, pq.Array(code.AuthMethods),
+	)
+	if err != nil {
+		r.logger.Error("Failed to decide device code", "error", err, "userID", code.UserID.String)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// MarkDeviceCodePolled records a poll of the device and its new interval.
+func (r *OAuthRepository) MarkDeviceCodePolled(
+	ctx context.Context, deviceCodeHash string, polledAt time.Time, interval int,
+) error {
+	query := `
+		UPDATE oauth_device_code SET last_polled_at = $2, interval_seconds = $3
+			WHERE device_code_hash = $1;
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, deviceCodeHash, polledAt, interval); err != nil {
+		r.logger.Error("Failed to mark device code polled", "error", err)
+		return err
+	}
+	return nil
+}
+
+// ConsumeDeviceCode marks a live approved code as used and returns it.
+// sql.ErrNoRows means the code isn't approved, has expired or was used already.
+func (r *OAuthRepository) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (DeviceCodeData, error) {
+	query := `
+		UPDATE oauth_device_code SET status = 'used'
+			WHERE device_code_hash = $1 AND status = 'approved' AND expires_at > current_timestamp
+		RETURNING device_code_hash, user_code, client_id, scope, status, user_id, auth_time, auth_methods,
+			interval_seconds, last_polled_at, expires_at, user_agent;
+	`
+
+	code, err := scanDeviceCode(r.db.QueryRowContext(ctx, query, deviceCodeHash))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to consume device code", "error", err)
+		}
+		return DeviceCodeData{}, err
+	}
+
+	r.logger.Debug("Successfully consumed device code", "client_id", code.ClientID, "userID", code.UserID.String)
+	return code, nil
+}
+
+func scanDeviceCode(row rowScanner) (DeviceCodeData, error) {
+	var code DeviceCodeData
+	err := row.Scan(
+		&code.DeviceCodeHash,
+		&code.UserCode,
+		&code.ClientID,
+		&code.Scope,
+		&code.Status,
+		&code.UserID,
+		&code.AuthTime,
+		pq.Array(&code.AuthMethods),
+		&code.Interval,
+		&code.LastPolledAt,
+		&code.ExpiresAt,
+		&code.UserAgent,
+	)
+	return code, err
+}
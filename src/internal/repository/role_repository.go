@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"github.com/lib/pq"
+)
+
+type RoleData struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+type RoleRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewRoleRepository(db *sql.DB, logger *slog.Logger) *RoleRepository {
+	return &RoleRepository{db: db, logger: logger}
+}
+
+func (r *RoleRepository) ListRoles(ctx context.Context) ([]RoleData, error) {
+	query := `
+		SELECT r.name, r.description,
+			coalesce(array_agg(rp.permission_name ORDER BY rp.permission_name)
+				FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM role r
+			LEFT JOIN role_permission rp ON rp.role_name = r.name
+		GROUP BY r.name, r.description
+		ORDER BY r.name;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.Error("Failed to get roles from db", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []RoleData{}
+	for rows.Next() {
+		var role RoleData
+		if err := rows.Scan(&role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			r.logger.Error("Failed to scan role", "error", err)
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate roles", "error", err)
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// PutRole creates the role or replaces its description and permissions.
+// Permissions that don't exist yet are created.
+func (r *RoleRepository) PutRole(ctx context.Context, role RoleData) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin role transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	roleQuery := `
+		INSERT INTO role (name, description) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET description = excluded.description;
+	`
+	if _, err = tx.ExecContext(ctx, roleQuery, role.Name, role.Description); err != nil {
+		r.logger.Error("Failed to store role", "error", err, "role", role.Name)
+		return err
+	}
+
+	permissionQuery := `
+		INSERT INTO permission (name) SELECT unnest($1::text[])
+		ON CONFLICT (name) DO NOTHING;
+	`
+	if _, err = tx.ExecContext(ctx, permissionQuery, pq.Array(role.Permissions)); err != nil {
+		r.logger.Error("Failed to store permissions", "error", err, "role", role.Name)
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM role_permission WHERE role_name = $1;`, role.Name); err != nil {
+		r.logger.Error("Failed to delete role permissions", "error", err, "role", role.Name)
+		return err
+	}
+
+	grantQuery := `
+		INSERT INTO role_permission (role_name, permission_name) SELECT $1, unnest($2::text[]);
+	`
+	if _, err = tx.ExecContext(ctx, grantQuery, role.Name, pq.Array(role.Permissions)); err != nil {
+		r.logger.Error("Failed to store role permissions", "error", err, "role", role.Name)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit role transaction", "error", err, "role", role.Name)
+		return err
+	}
+
+	r.logger.Debug("Successfully stored role", "role", role.Name, "permissions", role.Permissions)
+	return nil
+}
+
+// DeleteRole deletes the role and its assignments. It reports false if the
+// role doesn't exist.
+func (r *RoleRepository) DeleteRole(ctx context.Context, name string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM role WHERE name = $1;`, name)
+	if err != nil {
+		r.logger.Error("Failed to delete role", "error", err, "role", name)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *RoleRepository) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	query := `SELECT role_name FROM user_role WHERE user_id = $1::UUID ORDER BY role_name;`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		r.logger.Error("Failed to get user roles from db", "error", err, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			r.logger.Error("Failed to scan user role", "error", err, "userID", userID)
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate user roles", "error", err, "userID", userID)
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetUserGrants returns the roles of the user and the permissions they grant.
+func (r *RoleRepository) GetUserGrants(ctx context.Context, userID string) (roles, permissions []string, err error) {
+	query := `
+		SELECT
+			coalesce(array_agg(DISTINCT ur.role_name), '{}'),
+			coalesce(array_agg(DISTINCT rp.permission_name) FILTER (WHERE rp.permission_name IS NOT NULL), '{}')
+		FROM user_role ur
+			LEFT JOIN role_permission rp ON rp.role_name = ur.role_name
+		WHERE ur.user_id = $1::UUID;
+	`
+
+	err = r.db.QueryRowContext(ctx, query, userID).Scan(pq.Array(&roles), pq.Array(&permissions))
+	if err != nil {
+		r.logger.Error("Failed to get user grants from db", "error", err, "userID", userID)
+		return nil, nil, err
+	}
+
+	return roles, permissions, nil
+}
+
+// AssignUserRole is idempotent. It reports false if the role doesn't exist,
+// ErrReferenceNotFound means the user doesn't exist.
+func (r *RoleRepository) AssignUserRole(ctx context.Context, userID, role string) (bool, error) {
+	// The no-op update counts the existing assignment as affected
+	query := `
+		INSERT INTO user_role (user_id, role_name) SELECT $1::UUID, name FROM role WHERE name = $2
+		ON CONFLICT (user_id, role_name) DO UPDATE SET granted_at = user_role.granted_at;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, role)
+	if isForeignKeyViolation(err) {
+		return false, ErrReferenceNotFound
+	} else if err != nil {
+		r.logger.Error("Failed to assign role", "error", err, "userID", userID, "role", role)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	r.logger.Debug("Successfully assigned role", "userID", userID, "role", role, "role_found", rowsAffected == 1)
+	return rowsAffected == 1, nil
+}
+
+// UnassignUserRole reports false if the user didn't have the role.
+func (r *RoleRepository) UnassignUserRole(ctx context.Context, userID, role string) (bool, error) {
+	query := `DELETE FROM user_role WHERE user_id = $1::UUID AND role_name = $2;`
+
+	result, err := r.db.ExecContext(ctx, query, userID, role)
+	if err != nil {
+		r.logger.Error("Failed to unassign role", "error", err, "userID", userID, "role", role)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
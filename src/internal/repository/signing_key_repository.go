@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type SigningKeyData struct {
+	KID         string
+	Algorithm   string
+	KeyMaterial string
+	// Encrypted is false for keys stored before key material was encrypted
+	Encrypted bool
+	CreatedAt time.Time
+	RetiredAt sql.NullTime
+}
+
+func (r *TokenRepository) GetSigningKeys(ctx context.Context) ([]SigningKeyData, error) {
+	query := `
+		SELECT kid, algorithm, key_material, encrypted, created_at, retired_at
+		FROM signing_key
+		ORDER BY created_at DESC;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		r.logger.Error("Failed to get signing keys from db", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SigningKeyData
+	for rows.Next() {
+		var keyData SigningKeyData
+		err := rows.Scan(
+			&keyData.KID,
+			&keyData.Algorithm,
+			&keyData.KeyMaterial,
+			&keyData.Encrypted,
+			&keyData.CreatedAt,
+			&keyData.RetiredAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan signing key row", "error", err)
+			return nil, err
+		}
+		keys = append(keys, keyData)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error("Error during rows iteration for signing keys", "error", err)
+		return nil, err
+	}
+
+	r.logger.Debug("Successfully retrieved signing keys", "count", len(keys))
+	return keys, nil
+}
+
+// StoreActiveSigningKey inserts a new key and retires every other active key in one transaction.
+func (r *TokenRepository) StoreActiveSigningKey(ctx context.Context, keyData SigningKeyData) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin signing key transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	retireQuery := `UPDATE signing_key SET retired_at = $1 WHERE retired_at IS NULL;`
+	if _, err = tx.ExecContext(ctx, retireQuery, keyData.CreatedAt); err != nil {
+		r.logger.Error("Failed to retire signing keys", "error", err)
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO signing_key (kid, algorithm, key_material, encrypted, created_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+	_, err = tx.ExecContext(
+		ctx, insertQuery, keyData.KID, keyData.Algorithm, keyData.KeyMaterial, keyData.Encrypted, keyData.CreatedAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store signing key", "error", err, "kid", keyData.KID)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit signing key transaction", "error", err, "kid", keyData.KID)
+		return err
+	}
+
+	r.logger.Debug("Successfully stored active signing key", "kid", keyData.KID, "algorithm", keyData.Algorithm)
+	return nil
+}
+
+// EncryptSigningKey replaces the plaintext material of a key with the sealed one.
+func (r *TokenRepository) EncryptSigningKey(ctx context.Context, kid, sealedMaterial string) error {
+	query := `UPDATE signing_key SET key_material = $2, encrypted = true WHERE kid = $1 AND NOT encrypted;`
+
+	if _, err := r.db.ExecContext(ctx, query, kid, sealedMaterial); err != nil {
+		r.logger.Error("Failed to encrypt signing key", "error", err, "kid", kid)
+		return err
+	}
+
+	r.logger.Debug("Signing key encrypted", "kid", kid)
+	return nil
+}
+
+func (r *TokenRepository) DeleteSigningKeysRetiredBefore(ctx context.Context, retiredBefore time.Time) ([]string, error) {
+	query := `DELETE FROM signing_key WHERE retired_at IS NOT NULL AND retired_at <= $1 RETURNING kid;`
+
+	rows, err := r.db.QueryContext(ctx, query, retiredBefore)
+	if err != nil {
+		r.logger.Error("Failed to delete retired signing keys", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletedKIDs := []string{}
+	for rows.Next() {
+		var kid string
+		if err := rows.Scan(&kid); err != nil {
+			r.logger.Error("Failed to scan deleted signing key", "error", err)
+			return nil, err
+		}
+		deletedKIDs = append(deletedKIDs, kid)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error("Error during rows iteration for deleted signing keys", "error", err)
+		return nil, err
+	}
+
+	r.logger.Debug("Retired signing keys deleted", "kids", deletedKIDs)
+	return deletedKIDs, nil
+}
@@ -5,16 +5,32 @@ import (
 	"database/sql"
 	"log/slog"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type TokenData struct {
 	JTI       string
+	FamilyID  string
 	TokenHash string
 	UserID    string
 	IPAddress string
 	UserAgent string
 	CreatedAt time.Time
 	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	// AuthenticatedAt is the login time of the session the token belongs to
+	AuthenticatedAt time.Time
+	// ClientID and Scope are set for sessions of OAuth clients
+	ClientID sql.NullString
+	Scope    sql.NullString
+	// AuthMethods are the amr values of the login
+	AuthMethods []string
+	// DPoPJKT is the thumbprint of the DPoP key of bound sessions
+	DPoPJKT sql.NullString
+	// CertThumbprint is the thumbprint of the client certificate of bound
+	// sessions of public clients
+	CertThumbprint sql.NullString
 }
 
 type TokenRepository struct {
@@ -26,35 +42,126 @@ func NewTokenRepository(db *sql.DB, logger *slog.Logger) *TokenRepository {
 	return &TokenRepository{db: db, logger: logger}
 }
 
-func (r *TokenRepository) AddUser(ctx context.Context, userID string) error {
-	query := `INSERT INTO "user" (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING;`
+// queryer is implemented by *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (r *TokenRepository) StoreRefreshToken(
+	ctx context.Context,
+	tokenHash, jti, familyID, userID, ipAddress, userAgent string,
+	createdAt, expiresAt, authenticatedAt time.Time,
+	authMethods []string,
+	clientID, scope, dpopJKT, certThumbprint sql.NullString,
+) error {
+	return r.insertRefreshToken(
+		ctx, r.db, tokenHash, jti, familyID, userID, ipAddress, userAgent, createdAt, expiresAt, authenticatedAt,
+		authMethods, clientID, scope, dpopJKT, certThumbprint,
+	)
+}
+
+// StoreSessionRefreshToken stores the first refresh token of a new session
+// like StoreRefreshToken, in one transaction with making room for it. The row
+// of the user is locked, so concurrent logins of the user are counted one after
+// another. makeRoom gets the live sessions of the user and returns the ones to
+// evict, or an error to reject the login. Evicted sessions are deleted and their
+// access tokens, which live for accessTTL and share the jti, are blocked.
+func (r *TokenRepository) StoreSessionRefreshToken(
+	ctx context.Context,
+	makeRoom func(sessions []TokenData) ([]TokenData, error),
+	accessTTL time.Duration,
+	tokenHash, jti, familyID, userID, ipAddress, userAgent string,
+	createdAt, expiresAt, authenticatedAt time.Time,
+	authMethods []string,
+	clientID, scope, dpopJKT, certThumbprint sql.NullString,
+) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin session transaction", "error", err, "userID", userID)
+		return err
+	}
+	defer tx.Rollback()
+
+	lockQuery := `SELECT user_id FROM "user" WHERE user_id = $1::UUID FOR UPDATE;`
+	if _, err = tx.ExecContext(ctx, lockQuery, userID); err != nil {
+		r.logger.Error("Failed to lock user sessions", "error", err, "userID", userID)
+		return err
+	}
+
+	sessions, err := r.getActiveUserSessions(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	evicted, err := makeRoom(sessions)
+	if err != nil {
+		return err
+	}
+
+	if len(evicted) > 0 {
+		familyIDs := make([]string, 0, len(evicted))
+		for _, session := range evicted {
+			familyIDs = append(familyIDs, session.FamilyID)
+		}
+		evictQuery := `
+			WITH revoked AS (
+				DELETE FROM refresh_token WHERE family_id = ANY($1::UUID[])
+				RETURNING refresh_token_id, created_at
+			)
+			INSERT INTO token_black_list (token_id, revoke_at)
+			SELECT refresh_token_id, created_at + make_interval(secs => $2)
+			FROM revoked
+				WHERE created_at + make_interval(secs => $2) > current_timestamp
+			ON CONFLICT (token_id) DO NOTHING;
+		`
+		if _, err = tx.ExecContext(ctx, evictQuery, pq.Array(familyIDs), accessTTL.Seconds()); err != nil {
+			r.logger.Error("Failed to evict sessions", "error", err, "userID", userID, "family_ids", familyIDs)
+			return err
+		}
+	}
 
-	_, err := r.db.ExecContext(ctx, query, userID)
+	err = r.insertRefreshToken(
+		ctx, tx, tokenHash, jti, familyID, userID, ipAddress, userAgent, createdAt, expiresAt, authenticatedAt,
+		authMethods, clientID, scope, dpopJKT, certThumbprint,
+	)
 	if err != nil {
-		r.logger.Error("Failed to add user to db", "error", err, "userID", userID)
 		return err
 	}
 
-	r.logger.Debug("Successfully executed add user query", "userID", userID)
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit session transaction", "error", err, "userID", userID)
+		return err
+	}
 	return nil
 }
 
-func (r *TokenRepository) StoreRefreshToken(
+func (r *TokenRepository) insertRefreshToken(
 	ctx context.Context,
-	tokenHash, jti, userID, ipAddress, userAgent string,
-	createdAt, expiresAt time.Time,
+	db queryer,
+	tokenHash, jti, familyID, userID, ipAddress, userAgent string,
+	createdAt, expiresAt, authenticatedAt time.Time,
+	authMethods []string,
+	clientID, scope, dpopJKT, certThumbprint sql.NullString,
 ) error {
 	query := `
-		INSERT INTO refresh_token (refresh_token_id, user_id, token_hash, ip_address, user_agent, created_at, expires_at)
-		VALUES ($1::UUID, $2::UUID, $3, $4, $5, $6, $7);
+		INSERT INTO refresh_token (
+			refresh_token_id, family_id, user_id, token_hash, ip_address, user_agent,
+			created_at, expires_at, authenticated_at, auth_methods, client_id, scope, dpop_jkt, cert_thumbprint,
+			has_selector
+		)
+		VALUES ($1::UUID, $2::UUID, $3::UUID, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, true);
 	`
-	_, err := r.db.ExecContext(ctx, query, jti, userID, tokenHash, ipAddress, userAgent, createdAt, expiresAt)
+	_, err := db.ExecContext(
+		ctx, query, jti, familyID, userID, tokenHash, ipAddress, userAgent, createdAt, expiresAt, authenticatedAt,
+		pq.Array(authMethods), clientID, scope, dpopJKT, certThumbprint,
+	)
 	if err != nil {
 		r.logger.Error("Failed to store refresh token in db", "error", err, "jti", jti)
 		return err
 	}
 
-	r.logger.Debug("Successfully stored refresh token", "jti", jti, "userID", userID)
+	r.logger.Debug("Successfully stored refresh token", "jti", jti, "family_id", familyID, "userID", userID)
 	return nil
 }
 
@@ -71,16 +178,18 @@ func (r *TokenRepository) RevokeToken(ctx context.Context, token_hash string) er
 	return nil
 }
 
-func (r *TokenRepository) GetRefreshUserTokens(ctx context.Context, userID string) ([]TokenData, error) {
+// GetLegacyRefreshUserTokens returns live tokens issued before refresh tokens carried a selector.
+func (r *TokenRepository) GetLegacyRefreshUserTokens(ctx context.Context, userID string) ([]TokenData, error) {
 	query := `
-		SELECT user_id, refresh_token_id, token_hash, ip_address, user_agent, created_at, expires_at
+		SELECT user_id, refresh_token_id, family_id, token_hash, ip_address, user_agent,
+			created_at, expires_at, used_at, authenticated_at
 		FROM refresh_token
-			WHERE user_id=$1 and expires_at > current_timestamp;
+			WHERE user_id=$1 and expires_at > current_timestamp and not has_selector;
 	`
 
 	rows, err := r.db.QueryContext(ctx, query, userID)
 	if err != nil {
-		r.logger.Error("Failed to get refresh tokens from db", "error", err, "userID", userID)
+		r.logger.Error("Failed to get legacy refresh tokens from db", "error", err, "userID", userID)
 		return nil, err
 	}
 	defer rows.Close()
@@ -91,11 +200,14 @@ func (r *TokenRepository) GetRefreshUserTokens(ctx context.Context, userID strin
 		err := rows.Scan(
 			&tokenData.UserID,
 			&tokenData.JTI,
+			&tokenData.FamilyID,
 			&tokenData.TokenHash,
 			&tokenData.IPAddress,
 			&tokenData.UserAgent,
 			&tokenData.CreatedAt,
 			&tokenData.ExpiresAt,
+			&tokenData.UsedAt,
+			&tokenData.AuthenticatedAt,
 		)
 		if err != nil {
 			r.logger.Error("Failed to scan refresh token row", "error", err, "userID", userID)
@@ -105,18 +217,237 @@ func (r *TokenRepository) GetRefreshUserTokens(ctx context.Context, userID strin
 	}
 
 	if err = rows.Err(); err != nil {
-		r.logger.Error("Error during rows iteration for refresh tokens", "error", err, "userID", userID)
+		r.logger.Error("Error during rows iteration for legacy refresh tokens", "error", err, "userID", userID)
+		return nil, err
+	}
+
+	r.logger.Debug("Successfully retrieved legacy refresh tokens", "count", len(tokens), "userID", userID)
+	return tokens, nil
+}
+
+// GetActiveUserSessions returns the current token of every live session of the user:
+// tokens that are neither rotated nor expired.
+func (r *TokenRepository) GetActiveUserSessions(ctx context.Context, userID string) ([]TokenData, error) {
+	return r.getActiveUserSessions(ctx, r.db, userID)
+}
+
+func (r *TokenRepository) getActiveUserSessions(ctx context.Context, db queryer, userID string) ([]TokenData, error) {
+	query := `
+		SELECT user_id, refresh_token_id, family_id, token_hash, ip_address, user_agent,
+			created_at, expires_at, used_at, authenticated_at, auth_methods, client_id, scope, dpop_jkt,
+			cert_thumbprint
+		FROM refresh_token
+			WHERE user_id=$1 and used_at is null and expires_at > current_timestamp
+		ORDER BY authenticated_at;
+	`
+
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		r.logger.Error("Failed to get active sessions from db", "error", err, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []TokenData
+	for rows.Next() {
+		var tokenData TokenData
+		err := rows.Scan(
+			&tokenData.UserID,
+			&tokenData.JTI,
+			&tokenData.FamilyID,
+			&tokenData.TokenHash,
+			&tokenData.IPAddress,
+			&tokenData.UserAgent,
+			&tokenData.CreatedAt,
+			&tokenData.ExpiresAt,
+			&tokenData.UsedAt,
+			&tokenData.AuthenticatedAt,
+			pq.Array(&tokenData.AuthMethods),
+			&tokenData.ClientID,
+			&tokenData.Scope,
+			&tokenData.DPoPJKT,
+			&tokenData.CertThumbprint,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan active session row", "error", err, "userID", userID)
+			return nil, err
+		}
+		tokens = append(tokens, tokenData)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error("Error during rows iteration for active sessions", "error", err, "userID", userID)
+		return nil, err
+	}
+
+	r.logger.Debug("Successfully retrieved active sessions", "count", len(tokens), "userID", userID)
+	return tokens, nil
+}
+
+func (r *TokenRepository) GetRefreshTokenByJTI(ctx context.Context, jti string) (TokenData, error) {
+	query := `
+		SELECT user_id, refresh_token_id, family_id, token_hash, ip_address, user_agent,
+			created_at, expires_at, used_at, authenticated_at, auth_methods, client_id, scope, dpop_jkt,
+			cert_thumbprint
+		FROM refresh_token
+			WHERE refresh_token_id=$1::UUID;
+	`
+
+	var tokenData TokenData
+	err := r.db.QueryRowContext(ctx, query, jti).Scan(
+		&tokenData.UserID,
+		&tokenData.JTI,
+		&tokenData.FamilyID,
+		&tokenData.TokenHash,
+		&tokenData.IPAddress,
+		&tokenData.UserAgent,
+		&tokenData.CreatedAt,
+		&tokenData.ExpiresAt,
+		&tokenData.UsedAt,
+		&tokenData.AuthenticatedAt,
+		pq.Array(&tokenData.AuthMethods),
+		&tokenData.ClientID,
+		&tokenData.Scope,
+		&tokenData.DPoPJKT,
+		&tokenData.CertThumbprint,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get refresh token by jti from db", "error", err, "jti", jti)
+		}
+		return TokenData{}, err
+	}
+
+	r.logger.Debug("Successfully retrieved refresh token", "jti", jti)
+	return tokenData, nil
+}
+
+// MarkRefreshTokenUsed marks the token as rotated. It reports false when the
+// token was already used, which means it is being replayed.
+func (r *TokenRepository) MarkRefreshTokenUsed(ctx context.Context, jti string, usedAt time.Time) (bool, error) {
+	query := `UPDATE refresh_token SET used_at = $2 WHERE refresh_token_id = $1::UUID AND used_at IS NULL;`
+
+	result, err := r.db.ExecContext(ctx, query, jti, usedAt)
+	if err != nil {
+		r.logger.Error("Failed to mark refresh token as used", "error", err, "jti", jti)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Failed to get affected rows of used refresh token", "error", err, "jti", jti)
+		return false, err
+	}
+
+	r.logger.Debug("Marked refresh token as used", "jti", jti, "marked", rowsAffected == 1)
+	return rowsAffected == 1, nil
+}
+
+// RevokeTokenFamily deletes every token of the rotation chain and returns them.
+func (r *TokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) ([]TokenData, error) {
+	query := `
+		DELETE FROM refresh_token WHERE family_id = $1::UUID
+		RETURNING user_id, refresh_token_id, family_id, created_at, expires_at;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, familyID)
+	if err != nil {
+		r.logger.Error("Failed to revoke refresh token family", "error", err, "family_id", familyID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []TokenData
+	for rows.Next() {
+		var tokenData TokenData
+		err := rows.Scan(
+			&tokenData.UserID,
+			&tokenData.JTI,
+			&tokenData.FamilyID,
+			&tokenData.CreatedAt,
+			&tokenData.ExpiresAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan revoked refresh token row", "error", err, "family_id", familyID)
+			return nil, err
+		}
+		tokens = append(tokens, tokenData)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error("Error during rows iteration for revoked token family", "error", err, "family_id", familyID)
 		return nil, err
 	}
 
-	r.logger.Debug("Successfully retrieved refresh tokens", "count", len(tokens), "userID", userID)
+	r.logger.Debug("Successfully revoked refresh token family", "family_id", familyID, "revoked_count", len(tokens))
 	return tokens, nil
 }
 
-func (r *TokenRepository) RevokeTokensByUserID(ctx context.Context, userID string) error {
-	query := `DELETE FROM refresh_token WHERE user_id=$1;`
+// RevokeUserTokenFamily deletes every token of the user's session and returns them.
+// Nothing is deleted when the session belongs to another user.
+func (r *TokenRepository) RevokeUserTokenFamily(ctx context.Context, userID, familyID string) ([]TokenData, error) {
+	query := `
+		DELETE FROM refresh_token WHERE family_id = $1::UUID AND user_id = $2::UUID
+		RETURNING user_id, refresh_token_id, family_id, created_at, expires_at;
+	`
 
-	result, err := r.db.ExecContext(ctx, query, userID)
+	rows, err := r.db.QueryContext(ctx, query, familyID, userID)
+	if err != nil {
+		r.logger.Error("Failed to revoke refresh token family", "error", err, "family_id", familyID, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []TokenData
+	for rows.Next() {
+		var tokenData TokenData
+		err := rows.Scan(
+			&tokenData.UserID,
+			&tokenData.JTI,
+			&tokenData.FamilyID,
+			&tokenData.CreatedAt,
+			&tokenData.ExpiresAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan revoked refresh token row", "error", err, "family_id", familyID, "userID", userID)
+			return nil, err
+		}
+		tokens = append(tokens, tokenData)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error("Error during rows iteration for revoked token family", "error", err, "family_id", familyID, "userID", userID)
+		return nil, err
+	}
+
+	r.logger.Debug("Successfully revoked refresh token family", "family_id", familyID, "userID", userID, "revoked_count", len(tokens))
+	return tokens, nil
+}
+
+// RevokeTokensByUserID deletes the refresh tokens of the user and blacklists
+// the access tokens issued with them for accessTTL. It runs in tx if it isn't
+// nil.
+func (r *TokenRepository) RevokeTokensByUserID(
+	ctx context.Context, tx *sql.Tx, userID string, accessTTL time.Duration,
+) error {
+	var db queryer = r.db
+	if tx != nil {
+		db = tx
+	}
+
+	query := `
+		WITH revoked AS (
+			DELETE FROM refresh_token WHERE user_id = $1::UUID
+			RETURNING refresh_token_id, created_at
+		)
+		INSERT INTO token_black_list (token_id, revoke_at)
+		SELECT refresh_token_id, created_at + make_interval(secs => $2)
+		FROM revoked
+			WHERE created_at + make_interval(secs => $2) > current_timestamp
+		ON CONFLICT (token_id) DO NOTHING;
+	`
+
+	result, err := db.ExecContext(ctx, query, userID, accessTTL.Seconds())
 	if err != nil {
 		r.logger.Error("Failed to revoke all tokens for user", "error", err, "userID", userID)
 		return err
@@ -145,7 +476,7 @@ func (r *TokenRepository) IsTokenInBlackList(ctx context.Context, jti string) (b
 
 
 func (r *TokenRepository) BlockTokenById(ctx context.Context, jti string, revoke_at time.Time) error {
-	query := "insert into token_black_list (token_id, revoke_at) values ($1, $2);"
+	query := "insert into token_black_list (token_id, revoke_at) values ($1, $2) on conflict (token_id) do nothing;"
 
 	_, err := r.db.ExecContext(ctx, query, jti, revoke_at)
 
@@ -172,3 +503,107 @@ func (r *TokenRepository) ClearBlockListFromRevokedTokens() error {
 	r.logger.Debug("Blocked token table cleared of revoked tokens SUCCESS")
 	return nil
 }
+
+type ImpersonationData struct {
+	JTI       string
+	Actor     string
+	UserID    string
+	Reason    string
+	Scope     string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// StoreImpersonation records an impersonation token. ErrReferenceNotFound
+// means the user doesn't exist.
+func (r *TokenRepository) StoreImpersonation(ctx context.Context, impersonation ImpersonationData) error {
+	query := `
+		INSERT INTO impersonation (jti, actor, user_id, reason, scope, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3::UUID, $4, $5, $6, $7, $8);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		impersonation.JTI, impersonation.Actor, impersonation.UserID, impersonation.Reason, impersonation.Scope,
+		impersonation.IPAddress, impersonation.UserAgent, impersonation.ExpiresAt,
+	)
+	if isForeignKeyViolation(err) {
+		return ErrReferenceNotFound
+	} else if err != nil {
+		r.logger.Error("Failed to store impersonation", "error", err, "userID", impersonation.UserID)
+		return err
+	}
+
+	r.logger.Debug("Successfully stored impersonation", "jti", impersonation.JTI, "userID", impersonation.UserID)
+	return nil
+}
+
+// GetUserImpersonations returns the impersonations of the user, newest first.
+func (r *TokenRepository) GetUserImpersonations(ctx context.Context, userID string) ([]ImpersonationData, error) {
+	query := `
+		SELECT jti, actor, user_id, reason, scope, ip_address, user_agent, created_at, expires_at
+		FROM impersonation
+			WHERE user_id = $1::UUID
+		ORDER BY created_at DESC;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		r.logger.Error("Failed to get impersonations from db", "error", err, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	impersonations := []ImpersonationData{}
+	for rows.Next() {
+		var impersonation ImpersonationData
+		var ipAddress, userAgent sql.NullString
+		err := rows.Scan(
+			&impersonation.JTI,
+			&impersonation.Actor,
+			&impersonation.UserID,
+			&impersonation.Reason,
+			&impersonation.Scope,
+			&ipAddress,
+			&userAgent,
+			&impersonation.CreatedAt,
+			&impersonation.ExpiresAt,
+		)
+		if err != nil {
+			r.logger.Error("Failed to scan impersonation", "error", err)
+			return nil, err
+		}
+		impersonation.IPAddress = ipAddress.String
+		impersonation.UserAgent = userAgent.String
+		impersonations = append(impersonations, impersonation)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate impersonations", "error", err)
+		return nil, err
+	}
+
+	return impersonations, nil
+}
+
+// StoreDPoPProof records the jti of an accepted DPoP proof until it expires.
+// It returns ErrAlreadyExists for a replayed proof.
+func (r *TokenRepository) StoreDPoPProof(ctx context.Context, jkt, jti string, expiresAt time.Time) error {
+	query := `INSERT INTO dpop_proof (jkt, jti, expires_at) VALUES ($1, $2, $3);`
+
+	_, err := r.db.ExecContext(ctx, query, jkt, jti, expiresAt)
+	if isUniqueViolation(err) {
+		r.logger.Warn("DPoP proof replayed", "jkt", jkt, "jti", jti)
+		return ErrAlreadyExists
+	} else if err != nil {
+		r.logger.Error("Failed to store DPoP proof", "error", err, "jkt", jkt)
+		return err
+	}
+
+	// Expired proofs are rejected by their iat, drop them while we are here
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM dpop_proof WHERE expires_at < current_timestamp;`); err != nil {
+		r.logger.Warn("Failed to delete expired DPoP proofs", "error", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrReferenceNotFound means a row the new row refers to doesn't exist
+	ErrReferenceNotFound = errors.New("referenced row not found")
+)
+
+const (
+	// uniqueViolationCode is the PostgreSQL error code of unique constraint violations.
+	uniqueViolationCode = "23505"
+	// foreignKeyViolationCode is the PostgreSQL error code of foreign key violations.
+	foreignKeyViolationCode = "23503"
+)
+
+type UserData struct {
+	UserID       string
+	Username     sql.NullString
+	Email        sql.NullString
+	PasswordHash sql.NullString
+	CreatedAt    time.Time
+	// EmailVerifiedAt is null until the user follows the verification link
+	EmailVerifiedAt sql.NullTime
+}
+
+type ActionTokenData struct {
+	UserID    string
+	Purpose   string
+	Email     sql.NullString
+	ExpiresAt time.Time
+}
+
+type UserRepository struct {
+	db *sql.DB
+	// tokens revokes the sessions of a password reset in its transaction
+	tokens *TokenRepository
+	logger *slog.Logger
+}
+
+func NewUserRepository(db *sql.DB, logger *slog.Logger) *UserRepository {
+	return &UserRepository{db: db, tokens: NewTokenRepository(db, logger), logger: logger}
+}
+
+func (r *UserRepository) CreateUser(ctx context.Context, userID, username, email, passwordHash string) error {
+	query := `
+		INSERT INTO "user" (user_id, username, email, password_hash)
+		VALUES ($1::UUID, $2, $3, $4);
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, username, email, passwordHash)
+	if err != nil {
+		if isUniqueViolation(err) {
+			r.logger.Info("User already exists", "username", username, "email", email)
+			return ErrAlreadyExists
+		}
+		r.logger.Error("Failed to create user", "error", err, "userID", userID)
+		return err
+	}
+
+	r.logger.Debug("Successfully created user", "userID", userID, "username", username)
+	return nil
+}
+
+// GetUserByLogin finds the user by username or email, both are case insensitive.
+func (r *UserRepository) GetUserByLogin(ctx context.Context, login string) (UserData, error) {
+	query := `
+		SELECT user_id, username, email, password_hash, created_at, email_verified_at
+		FROM "user"
+			WHERE lower(username) = lower($1) OR lower(email) = lower($1);
+	`
+
+	return r.getUser(ctx, query, login)
+}
+
+func (r *UserRepository) GetUserByID(ctx context.Context, userID string) (UserData, error) {
+	query := `
+		SELECT user_id, username, email, password_hash, created_at, email_verified_at
+		FROM "user"
+			WHERE user_id = $1::UUID;
+	`
+
+	return r.getUser(ctx, query, userID)
+}
+
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, userID, passwordHash string) error {
+	query := `UPDATE "user" SET password_hash = $2 WHERE user_id = $1::UUID;`
+
+	_, err := r.db.ExecContext(ctx, query, userID, passwordHash)
+	if err != nil {
+		r.logger.Error("Failed to update password hash", "error", err, "userID", userID)
+		return err
+	}
+
+	r.logger.Debug("Successfully updated password hash", "userID", userID)
+	return nil
+}
+
+// GetUserIDByIdentity returns the local user linked to the subject of the
+// external provider, sql.ErrNoRows if there is none.
+func (r *UserRepository) GetUserIDByIdentity(ctx context.Context, provider, subject string) (string, error) {
+	query := `SELECT user_id FROM user_identity WHERE provider = $1 AND subject = $2;`
+
+	var userID string
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get user identity from db", "error", err, "provider", provider)
+		}
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// CreateUserWithIdentity creates a user without local credentials and links it
+// to the subject of the external provider. ErrAlreadyExists means the subject
+// has been linked already.
+func (r *UserRepository) CreateUserWithIdentity(ctx context.Context, userID, provider, subject string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin user identity transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `INSERT INTO "user" (user_id) VALUES ($1::UUID);`, userID); err != nil {
+		r.logger.Error("Failed to create user", "error", err, "userID", userID)
+		return err
+	}
+
+	identityQuery := `
+		INSERT INTO user_identity (provider, subject, user_id)
+		VALUES ($1, $2, $3::UUID);
+	`
+	if _, err = tx.ExecContext(ctx, identityQuery, provider, subject, userID); err != nil {
+		if isUniqueViolation(err) {
+			r.logger.Info("User identity already exists", "provider", provider, "subject", subject)
+			return ErrAlreadyExists
+		}
+		r.logger.Error("Failed to create user identity", "error", err, "userID", userID, "provider", provider)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit user identity transaction", "error", err, "userID", userID)
+		return err
+	}
+
+	r.logger.Debug("Successfully created user with identity", "userID", userID, "provider", provider)
+	return nil
+}
+
+// StoreActionToken stores a new token and deletes the older tokens of the user
+// with the same purpose, so only the latest mail works.
+func (r *UserRepository) StoreActionToken(ctx context.Context, tokenHash string, tokenData ActionTokenData) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin action token transaction", "error", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := `DELETE FROM user_action_token WHERE user_id = $1::UUID AND purpose = $2;`
+	if _, err = tx.ExecContext(ctx, deleteQuery, tokenData.UserID, tokenData.Purpose); err != nil {
+		r.logger.Error("Failed to delete old action tokens", "error", err, "userID", tokenData.UserID)
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO user_action_token (token_hash, user_id, purpose, email, expires_at)
+		VALUES ($1, $2::UUID, $3, $4, $5);
+	`
+	_, err = tx.ExecContext(ctx, insertQuery,
+		tokenHash, tokenData.UserID, tokenData.Purpose, tokenData.Email, tokenData.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store action token", "error", err, "userID", tokenData.UserID)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit action token transaction", "error", err, "userID", tokenData.UserID)
+		return err
+	}
+
+	r.logger.Debug("Successfully stored action token", "userID", tokenData.UserID, "purpose", tokenData.Purpose)
+	return nil
+}
+
+// ConsumeActionToken marks a live token as used and returns it. sql.ErrNoRows
+// means the token doesn't exist, has expired or was used already.
+func (r *UserRepository) ConsumeActionToken(ctx context.Context, tokenHash, purpose string) (ActionTokenData, error) {
+	return r.consumeActionToken(ctx, r.db, tokenHash, purpose)
+}
+
+func (r *UserRepository) consumeActionToken(
+	ctx context.Context, q queryer, tokenHash, purpose string,
+) (ActionTokenData, error) {
+	query := `
+		UPDATE user_action_token SET used_at = current_timestamp
+			WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > current_timestamp
+		RETURNING user_id, purpose, email, expires_at;
+	`
+
+	var tokenData ActionTokenData
+	err := q.QueryRowContext(ctx, query, tokenHash, purpose).Scan(
+		&tokenData.UserID,
+		&tokenData.Purpose,
+		&tokenData.Email,
+		&tokenData.ExpiresAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to consume action token", "error", err, "purpose", purpose)
+		}
+		return ActionTokenData{}, err
+	}
+
+	r.logger.Debug("Successfully consumed action token", "userID", tokenData.UserID, "purpose", purpose)
+	return tokenData, nil
+}
+
+// ResetPassword consumes the reset token and, in the same transaction, sets
+// the password hash of its user, deletes the user's refresh tokens and API
+// keys and blocks the access tokens issued with the refresh tokens for
+// accessTTL. Either all of it happens or nothing, so a failed reset leaves
+// the token usable and never a new password next to live sessions.
+// sql.ErrNoRows means the token doesn't exist, has expired or was used already.
+func (r *UserRepository) ResetPassword(
+	ctx context.Context, tokenHash, purpose, passwordHash string, accessTTL time.Duration,
+) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.logger.Error("Failed to begin password reset transaction", "error", err)
+		return "", err
+	}
+	defer tx.Rollback()
+
+	tokenData, err := r.consumeActionToken(ctx, tx, tokenHash, purpose)
+	if err != nil {
+		return "", err
+	}
+	userID := tokenData.UserID
+
+	// Also locks the user, sessions can't be stored until the commit
+	updateQuery := `UPDATE "user" SET password_hash = $2 WHERE user_id = $1::UUID;`
+	if _, err = tx.ExecContext(ctx, updateQuery, userID, passwordHash); err != nil {
+		r.logger.Error("Failed to update password hash", "error", err, "userID", userID)
+		return "", err
+	}
+
+	if err = r.tokens.RevokeTokensByUserID(ctx, tx, userID, accessTTL); err != nil {
+		return "", err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM api_key WHERE user_id = $1::UUID;`, userID); err != nil {
+		r.logger.Error("Failed to delete API keys", "error", err, "userID", userID)
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit password reset", "error", err, "userID", userID)
+		return "", err
+	}
+
+	r.logger.Debug("Successfully reset password", "userID", userID)
+	return userID, nil
+}
+
+// MarkEmailVerified reports false if the email of the user has changed since
+// the verification mail was sent.
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, userID, email string) (bool, error) {
+	query := `
+		UPDATE "user" SET email_verified_at = current_timestamp
+			WHERE user_id = $1::UUID AND lower(email) = lower($2);
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, email)
+	if err != nil {
+		r.logger.Error("Failed to mark email verified", "error", err, "userID", userID)
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (r *UserRepository) getUser(ctx context.Context, query string, args ...any) (UserData, error) {
+	var userData UserData
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&userData.UserID,
+		&userData.Username,
+		&userData.Email,
+		&userData.PasswordHash,
+		&userData.CreatedAt,
+		&userData.EmailVerifiedAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to get user from db", "error", err)
+		}
+		return UserData{}, err
+	}
+
+	return userData, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolationCode
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type WebAuthnCredentialData struct {
+	CredentialID    []byte
+	UserID          string
+	PublicKey       []byte
+	AttestationType string
+	AAGUID          []byte
+	SignCount       uint32
+	Transports      []string
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       time.Time
+	LastUsedAt      sql.NullTime
+}
+
+type WebAuthnSessionData struct {
+	Challenge   string
+	Ceremony    string
+	UserID      sql.NullString
+	SessionData []byte
+	ExpiresAt   time.Time
+}
+
+type WebAuthnRepository struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewWebAuthnRepository(db *sql.DB, logger *slog.Logger) *WebAuthnRepository {
+	return &WebAuthnRepository{db: db, logger: logger}
+}
+
+// StoreWebAuthnCredential returns ErrAlreadyExists if the credential is registered already.
+func (r *WebAuthnRepository) StoreWebAuthnCredential(ctx context.Context, credential WebAuthnCredentialData) error {
+	query := `
+		INSERT INTO webauthn_credential (
+			credential_id, user_id, public_key, attestation_type, aaguid,
+			sign_count, transports, backup_eligible, backup_state
+		)
+		VALUES ($1, $2::UUID, $3, $4, $5, $6, $7, $8, $9);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		credential.CredentialID,
+		credential.UserID,
+		credential.PublicKey,
+		credential.AttestationType,
+		credential.AAGUID,
+		int64(credential.SignCount),
+		pq.Array(credential.Transports),
+		credential.BackupEligible,
+		credential.BackupState,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			r.logger.Info("WebAuthn credential already registered", "userID", credential.UserID)
+			return ErrAlreadyExists
+		}
+		r.logger.Error("Failed to store WebAuthn credential", "error", err, "userID", credential.UserID)
+		return err
+	}
+
+	r.logger.Debug("Successfully stored WebAuthn credential", "userID", credential.UserID)
+	return nil
+}
+
+func (r *WebAuthnRepository) GetWebAuthnCredentials(ctx context.Context, userID string) ([]WebAuthnCredentialData, error) {
+	query := `
+		SELECT credential_id, user_id, public_key, attestation_type, aaguid,
+			sign_count, transports, backup_eligible, backup_state, created_at, last_used_at
+		FROM webauthn_credential
+			WHERE user_id = $1::UUID
+		ORDER BY created_at;
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		r.logger.Error("Failed to get WebAuthn credentials from db", "error", err, "userID", userID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []WebAuthnCredentialData
+	for rows.Next() {
+		var credential WebAuthnCredentialData
+		var signCount int64
+		if err = rows.Scan(
+			&credential.CredentialID,
+			&credential.UserID,
+			&credential.PublicKey,
+			&credential.AttestationType,
+			&credential.AAGUID,
+			&signCount,
+			pq.Array(&credential.Transports),
+			&credential.BackupEligible,
+			&credential.BackupState,
+			&credential.CreatedAt,
+			&credential.LastUsedAt,
+		); err != nil {
+			r.logger.Error("Failed to scan WebAuthn credential", "error", err, "userID", userID)
+			return nil, err
+		}
+		credential.SignCount = uint32(signCount)
+		credentials = append(credentials, credential)
+	}
+
+	if err = rows.Err(); err != nil {
+		r.logger.Error("Failed to iterate WebAuthn credentials", "error", err, "userID", userID)
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnCredentialUse stores the sign counter and backup state of the
+// last assertion.
+func (r *WebAuthnRepository) UpdateWebAuthnCredentialUse(
+	ctx context.Context, credentialID []byte, signCount uint32, backupState bool, usedAt time.Time,
+) error {
+	query := `
+		UPDATE webauthn_credential SET sign_count = $2, backup_state = $3, last_used_at = $4
+			WHERE credential_id = $1;
+	`
+
+	_, err := r.db.ExecContext(ctx, query, credentialID, int64(signCount), backupState, usedAt)
+	if err != nil {
+		r.logger.Error("Failed to update WebAuthn credential", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *WebAuthnRepository) StoreWebAuthnSession(ctx context.Context, session WebAuthnSessionData) error {
+	query := `
+		INSERT INTO webauthn_session (challenge, ceremony, user_id, session_data, expires_at)
+		VALUES ($1, $2, $3::UUID, $4, $5);
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		session.Challenge, session.Ceremony, session.UserID, session.SessionData, session.ExpiresAt,
+	)
+	if err != nil {
+		r.logger.Error("Failed to store WebAuthn session", "error", err, "ceremony", session.Ceremony)
+		return err
+	}
+
+	if _, err = r.db.ExecContext(ctx, `DELETE FROM webauthn_session WHERE expires_at < current_timestamp;`); err != nil {
+		r.logger.Warn("Failed to delete expired WebAuthn sessions", "error", err)
+	}
+
+	r.logger.Debug("Successfully stored WebAuthn session", "ceremony", session.Ceremony)
+	return nil
+}
+
+// ConsumeWebAuthnSession deletes and returns the session of the challenge, so
+// each challenge completes one ceremony. sql.ErrNoRows means there is none.
+func (r *WebAuthnRepository) ConsumeWebAuthnSession(
+	ctx context.Context, challenge, ceremony string,
+) (WebAuthnSessionData, error) {
+	query := `
+		DELETE FROM webauthn_session
+			WHERE challenge = $1 AND ceremony = $2
+		RETURNING challenge, ceremony, user_id, session_data, expires_at;
+	`
+
+	var session WebAuthnSessionData
+	err := r.db.QueryRowContext(ctx, query, challenge, ceremony).Scan(
+		&session.Challenge,
+		&session.Ceremony,
+		&session.UserID,
+		&session.SessionData,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			r.logger.Error("Failed to consume WebAuthn session", "error", err, "ceremony", ceremony)
+		}
+		return WebAuthnSessionData{}, err
+	}
+
+	return session, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrInvalidActionToken   = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email already verified")
+	ErrNoEmail              = errors.New("user has no email")
+)
+
+const (
+	actionTokenPasswordReset     = "password_reset"
+	actionTokenEmailVerification = "email_verification"
+
+	passwordResetTTL     = 30 * time.Minute
+	emailVerificationTTL = 24 * time.Hour
+	// mailSendTimeout bounds mails sent in the background
+	mailSendTimeout = 30 * time.Second
+)
+
+// RequestPasswordReset mails a reset link to the user with the email. Unknown
+// emails are ignored and the mail is sent in the background, so the caller
+// can't tell whether the email is registered.
+func (s *UserService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.repo.GetUserByLogin(ctx, email)
+	if err == sql.ErrNoRows || (err == nil && !strings.EqualFold(user.Email.String, email)) {
+		s.logger.Info("Password reset requested for unknown email")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, err := s.issueActionToken(ctx, user.UserID, actionTokenPasswordReset, sql.NullString{}, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	mail := Mail{
+		To:      user.Email.String,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your account.\n\n"+
+				"Follow the link to choose a new password, it is valid for %d minutes:\n%s\n\n"+
+				"If it wasn't you, ignore this mail, your password stays the same.\n",
+			int(passwordResetTTL.Minutes()), s.actionLink("reset-password", token),
+		),
+	}
+
+	go func() {
+		// Not derived from ctx, the request is over by the time the mail is sent
+		sendCtx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, mail); err != nil {
+			s.logger.Error("Failed to send password reset mail", "error", err, "userID", user.UserID)
+		}
+	}()
+
+	s.logger.Info("Password reset requested", "userID", user.UserID)
+	return nil
+}
+
+// ResetPassword sets a new password with the token of the reset mail and
+// returns the user id. All sessions and API keys of the user are revoked
+// with it, the access tokens of the sessions are blocked for accessTTL.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string, accessTTL time.Duration) (string, error) {
+	// Checked first, so a weak password doesn't burn the token
+	if err := s.validatePassword(password); err != nil {
+		return "", err
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.logger.Error("Failed to hash password", "error", err)
+		return "", err
+	}
+
+	userID, err := s.repo.ResetPassword(ctx, hashOpaqueToken(token), actionTokenPasswordReset, passwordHash, accessTTL)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidActionToken
+	} else if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("Password reset", "userID", userID)
+	return userID, nil
+}
+
+// RequestEmailVerification mails a verification link to the email of the user.
+func (s *UserService) RequestEmailVerification(ctx context.Context, userID string) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.Email.Valid {
+		return ErrNoEmail
+	}
+	if user.EmailVerifiedAt.Valid {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issueActionToken(ctx, userID, actionTokenEmailVerification, user.Email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	err = s.mailer.Send(ctx, Mail{
+		To:      user.Email.String,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Follow the link to verify your email, it is valid for %d hours:\n%s\n",
+			int(emailVerificationTTL.Hours()), s.actionLink("verify-email", token),
+		),
+	})
+	if err != nil {
+		s.logger.Error("Failed to send verification mail", "error", err, "userID", userID)
+		return err
+	}
+
+	s.logger.Info("Email verification requested", "userID", userID)
+	return nil
+}
+
+// VerifyEmail marks the email as verified with the token of the verification mail.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) error {
+	tokenData, err := s.repo.ConsumeActionToken(ctx, hashOpaqueToken(token), actionTokenEmailVerification)
+	if err == sql.ErrNoRows {
+		return ErrInvalidActionToken
+	} else if err != nil {
+		return err
+	}
+
+	verified, err := s.repo.MarkEmailVerified(ctx, tokenData.UserID, tokenData.Email.String)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		s.logger.Info("Email changed since the verification mail", "userID", tokenData.UserID)
+		return ErrInvalidActionToken
+	}
+
+	s.logger.Info("Email verified", "userID", tokenData.UserID)
+	return nil
+}
+
+func (s *UserService) issueActionToken(
+	ctx context.Context, userID, purpose string, email sql.NullString, ttl time.Duration,
+) (string, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.StoreActionToken(ctx, hashOpaqueToken(token), repository.ActionTokenData{
+		UserID:    userID,
+		Purpose:   purpose,
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *UserService) actionLink(path, token string) string {
+	return s.appURL + "/" + path + "?token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrInvalidAPIKey         = errors.New("invalid api key")
+	ErrAPIKeyExpired         = errors.New("api key has expired")
+	ErrAPIKeyNotFound        = errors.New("api key not found")
+	ErrInvalidAPIKeyMetadata = errors.New("invalid api key metadata")
+)
+
+// API keys look like bga_<prefix>_<secret>. The prefix is public and finds the
+// key, the database keeps the hash of the whole key.
+const (
+	apiKeyTag        = "bga_"
+	apiKeyPrefixSize = 6
+	apiKeyMaxNameLen = 255
+)
+
+// APIKeyOwner is either a user or a service account.
+type APIKeyOwner struct {
+	UserID   string
+	ClientID string
+}
+
+func (o APIKeyOwner) userID() sql.NullString {
+	return sql.NullString{String: o.UserID, Valid: o.UserID != ""}
+}
+
+func (o APIKeyOwner) clientID() sql.NullString {
+	return sql.NullString{String: o.ClientID, Valid: o.ClientID != ""}
+}
+
+// APIKey is a long-lived credential of a user or a service account, sent as
+// "Authorization: ApiKey <key>".
+type APIKey struct {
+	ID     string
+	Name   string
+	Prefix string
+	Owner  APIKeyOwner
+	// Scopes are the permissions of the key, bounded by what the owner has at
+	// the time of the request
+	Scopes []string
+	// ExpiresAt is zero for keys that never expire
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	LastUsedIP string
+	CreatedAt  time.Time
+}
+
+// APIKeyService manages API keys and authenticates requests made with them.
+type APIKeyService struct {
+	repo   *repository.APIKeyRepository
+	roles  *RoleService
+	oauth  *OAuthService
+	logger *slog.Logger
+}
+
+func NewAPIKeyService(
+	repo *repository.APIKeyRepository,
+	roles *RoleService,
+	oauth *OAuthService,
+	logger *slog.Logger,
+) *APIKeyService {
+	return &APIKeyService{repo: repo, roles: roles, oauth: oauth, logger: logger}
+}
+
+// CreateKey issues a key to the owner. Users may give the key their own
+// permissions, service accounts the scopes of the client. The key is returned
+// only here.
+func (s *APIKeyService) CreateKey(
+	ctx context.Context, owner APIKeyOwner, name string, scopes []string, expiresAt time.Time,
+) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > apiKeyMaxNameLen {
+		return APIKey{}, "", ErrInvalidAPIKeyMetadata
+	}
+	if !expiresAt.IsZero() && !expiresAt.After(time.Now()) {
+		return APIKey{}, "", ErrInvalidAPIKeyMetadata
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	allowedScopes, err := s.ownerScopes(ctx, owner)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(allowedScopes, scope) {
+			return APIKey{}, "", ErrInvalidAPIKeyMetadata
+		}
+	}
+
+	prefixBytes := make([]byte, apiKeyPrefixSize)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := generateOpaqueToken()
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+	rawKey := apiKeyTag + prefix + "_" + secret
+
+	key := APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    prefix,
+		Owner:     owner,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	keyData := repository.APIKeyData{
+		ID:       key.ID,
+		Prefix:   prefix,
+		KeyHash:  hashOpaqueToken(rawKey),
+		Name:     name,
+		UserID:   owner.userID(),
+		ClientID: owner.clientID(),
+		Scopes:   scopes,
+	}
+	if !expiresAt.IsZero() {
+		keyData.ExpiresAt = sql.NullTime{Time: expiresAt, Valid: true}
+	}
+	if err := s.repo.CreateAPIKey(ctx, keyData); err != nil {
+		return APIKey{}, "", err
+	}
+
+	s.logger.Info("API key created", "prefix", prefix, "user_id", owner.UserID, "client_id", owner.ClientID)
+	return key, rawKey, nil
+}
+
+func (s *APIKeyService) ListKeys(ctx context.Context, owner APIKeyOwner) ([]APIKey, error) {
+	keysData, err := s.repo.ListAPIKeys(ctx, owner.userID(), owner.clientID())
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]APIKey, 0, len(keysData))
+	for _, keyData := range keysData {
+		keys = append(keys, apiKeyFromData(keyData))
+	}
+	return keys, nil
+}
+
+// RevokeKey deletes the key of the owner.
+func (s *APIKeyService) RevokeKey(ctx context.Context, owner APIKeyOwner, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrAPIKeyNotFound
+	}
+
+	deleted, err := s.repo.DeleteAPIKey(ctx, id, owner.userID(), owner.clientID())
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAPIKeyNotFound
+	}
+
+	s.logger.Info("API key revoked", "id", id, "user_id", owner.UserID, "client_id", owner.ClientID)
+	return nil
+}
+
+// Authenticate checks the key and records its use. The claims carry the
+// scopes of the key the owner still has, roles are those of the user.
+func (s *APIKeyService) Authenticate(ctx context.Context, rawKey, ipAddress string) (*AccessTokenClaims, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(rawKey, apiKeyTag), "_")
+	if !strings.HasPrefix(rawKey, apiKeyTag) || !ok || len(prefix) != hex.EncodedLen(apiKeyPrefixSize) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	keyData, err := s.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashOpaqueToken(rawKey)), []byte(keyData.KeyHash)) != 1 {
+		s.logger.Info("API key secret mismatch", "prefix", prefix)
+		return nil, ErrInvalidAPIKey
+	}
+	if keyData.ExpiresAt.Valid && !keyData.ExpiresAt.Time.After(time.Now()) {
+		return nil, ErrAPIKeyExpired
+	}
+
+	key := apiKeyFromData(keyData)
+	claims := &AccessTokenClaims{
+		UserID:    key.Owner.UserID,
+		ExpiresAt: key.ExpiresAt,
+		IssuedAt:  key.CreatedAt,
+		ClientID:  key.Owner.ClientID,
+		Service:   key.Owner.ClientID != "",
+		APIKeyID:  key.ID,
+	}
+
+	var ownerScopes []string
+	if claims.Service {
+		ownerScopes, err = s.ownerScopes(ctx, key.Owner)
+	} else {
+		claims.Roles, ownerScopes, err = s.roles.UserGrants(ctx, key.Owner.UserID)
+		ownerScopes = append(ownerScopes, identityScopes...)
+	}
+	if errors.Is(err, ErrOAuthClientNotFound) || errors.Is(err, ErrInvalidAPIKeyMetadata) {
+		// The client is gone or is no longer a service account
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+	for _, scope := range key.Scopes {
+		if slices.Contains(ownerScopes, scope) {
+			claims.Permissions = append(claims.Permissions, scope)
+		}
+	}
+
+	// A failed write shouldn't fail the request
+	if err := s.repo.TouchAPIKey(ctx, key.ID, ipAddress); err != nil {
+		s.logger.Warn("Failed to record API key use", "prefix", prefix, "error", err)
+	}
+	return claims, nil
+}
+
+// ownerScopes returns the scopes the owner may give a key: the permissions of
+// the user with the OpenID Connect scopes, or the scopes of the service account.
+func (s *APIKeyService) ownerScopes(ctx context.Context, owner APIKeyOwner) ([]string, error) {
+	if owner.ClientID != "" {
+		client, err := s.oauth.Client(ctx, owner.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if !client.AllowsGrant(GrantTypeClientCredentials) {
+			// Only service accounts act on their own
+			return nil, ErrInvalidAPIKeyMetadata
+		}
+		return client.Scopes, nil
+	}
+
+	_, permissions, err := s.roles.UserGrants(ctx, owner.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return append(permissions, identityScopes...), nil
+}
+
+func apiKeyFromData(keyData repository.APIKeyData) APIKey {
+	return APIKey{
+		ID:     keyData.ID,
+		Name:   keyData.Name,
+		Prefix: keyData.Prefix,
+		Owner: APIKeyOwner{
+			UserID:   keyData.UserID.String,
+			ClientID: keyData.ClientID.String,
+		},
+		Scopes:     keyData.Scopes,
+		ExpiresAt:  keyData.ExpiresAt.Time,
+		LastUsedAt: keyData.LastUsedAt.Time,
+		LastUsedIP: keyData.LastUsedIP.String,
+		CreatedAt:  keyData.CreatedAt,
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -18,6 +19,11 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventPasswordReset     = "password_reset"
+)
+
 var (
 	ErrInvalidToken      = errors.New("invalid token")
 	ErrTokenRevoked      = errors.New("token revoked")
@@ -26,36 +32,143 @@ var (
 	ErrUserAgentMismatch = errors.New("user agent mismatch")
 	ErrNotPairsTokens    = errors.New("token not from one pair")
 	ErrTokenBlocked      = errors.New("token is blocked")
+	ErrTokenReused       = errors.New("refresh token reuse detected")
+	ErrInvalidIssuer     = errors.New("token issued by another issuer")
+	ErrInvalidAudience   = errors.New("token is not meant for this service")
+	ErrInsufficientScope = errors.New("token lacks a required scope")
+	ErrServiceToken      = errors.New("token of a service account has no user session")
 )
 
+// TokenSettings are the registered claims of issued access tokens.
+type TokenSettings struct {
+	// Issuer is the "iss" of every token, tokens of other issuers are rejected
+	Issuer string
+	// Audience is the default "aud": the service accepts only tokens meant for it
+	Audience string
+}
+
+// AccessTokenClaims are the verified claims of an access token.
+type AccessTokenClaims struct {
+	UserID    string
+	JTI       string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	Roles     []string
+	// Permissions are the space separated "scope" claim
+	Permissions []string
+	// ClientID is set for tokens issued to OAuth clients
+	ClientID string
+	// Service is set for client_credentials tokens of service accounts: they
+	// act for the client itself and have no UserID
+	Service        bool
+	Authentication Authentication
+	// APIKeyID is set for requests made with an API key instead of a token
+	APIKeyID string
+	// Audience restricts exchanged tokens to the services they were issued for
+	Audience []string
+	// Actor is set for tokens that act on behalf of the user: exchanged by a
+	// service or issued to an impersonating admin
+	Actor *Actor
+	// DPoPJKT is the thumbprint of the key of DPoP bound tokens, the "cnf"
+	// claim of RFC 9449, section 6.1
+	DPoPJKT string
+	// CertThumbprint is the thumbprint of the TLS client certificate of
+	// certificate-bound tokens (RFC 8705, section 3.1)
+	CertThumbprint string
+}
+
+// HasScopes reports whether the token grants every one of the scopes.
+func (c *AccessTokenClaims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Permissions, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// refreshTokenStore finds the stored refresh tokens a presented one is
+// checked against.
+type refreshTokenStore interface {
+	GetRefreshTokenByJTI(ctx context.Context, jti string) (repository.TokenData, error)
+	GetLegacyRefreshUserTokens(ctx context.Context, userID string) ([]repository.TokenData, error)
+}
+
+// dpopProofStore records the jti of DPoP proofs against replay.
+type dpopProofStore interface {
+	StoreDPoPProof(ctx context.Context, jkt, jti string, expiresAt time.Time) error
+}
+
 type AuthService struct {
 	repo                     repository.TokenRepository
+	refreshTokens            refreshTokenStore
+	dpopProofs               dpopProofStore
 	logger                   *slog.Logger
-	jwtSecret                string
+	keyRing                  *KeyRing
 	accessExpireTime         time.Duration
 	refreshExpireTime        time.Duration
 	notifyNewLoginWebhookUrl string
-	// TODO: думаю хорошей идеей сделать максимальное количество refresh токенов для юзера
+	sessionLimit             SessionLimit
+	authenticator            Authenticator
+	mfa                      *MFAService
+	roles                    *RoleService
+	tokens                   TokenSettings
 }
 
 func NewAuthService(
 	repo repository.TokenRepository,
 	logger *slog.Logger,
-	jwtSecret string,
+	keyRing *KeyRing,
 	accessExpireTime time.Duration,
 	refreshExpireTime time.Duration,
 	notifyNewLoginWebhookUrl string,
+	sessionLimit SessionLimit,
+	authenticator Authenticator,
+	mfa *MFAService,
+	roles *RoleService,
+	tokens TokenSettings,
 ) *AuthService {
 	return &AuthService{
 		repo:                     repo,
+		refreshTokens:            &repo,
+		dpopProofs:               &repo,
 		logger:                   logger,
-		jwtSecret:                jwtSecret,
+		keyRing:                  keyRing,
 		accessExpireTime:         accessExpireTime,
 		refreshExpireTime:        refreshExpireTime,
 		notifyNewLoginWebhookUrl: notifyNewLoginWebhookUrl,
+		sessionLimit:             sessionLimit,
+		authenticator:            authenticator,
+		mfa:                      mfa,
+		roles:                    roles,
+		tokens:                   tokens,
+	}
+}
+
+
+// JWKS returns the public keys that downstream services use to verify access tokens.
+// Retired keys stay in the set until tokens signed by them expire.
+// HMAC keys are never published.
+func (s *AuthService) JWKS() JSONWebKeySet {
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range s.keyRing.Keys() {
+		if jwk, ok := key.PublicJWK(); ok {
+			keySet.Keys = append(keySet.Keys, jwk)
+		}
 	}
+	return keySet
 }
 
+// RotateSigningKey promotes a new signing key. Tokens signed by the previous keys
+// stay valid until they expire, keys retired longer than that are deleted.
+func (s *AuthService) RotateSigningKey(ctx context.Context, algorithm string) (kid string, deletedKIDs []string, err error) {
+	key, deletedKIDs, err := s.keyRing.Rotate(ctx, algorithm)
+	if err != nil {
+		s.logger.Error("Failed to rotate signing key", "error", err, "algorithm", algorithm)
+		return "", nil, err
+	}
+	return key.KID, deletedKIDs, nil
+}
 
 func (s *AuthService) hashRefreshToken(token []byte) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword(token, bcrypt.DefaultCost)
@@ -66,16 +179,181 @@ func (s *AuthService) hashRefreshToken(token []byte) (string, error) {
 	return string(hash), nil
 }
 
-func (s *AuthService) GenerateTokens(ctx context.Context, userID, ipAddress, userAgent string) (accessToken, refreshToken string, err error) {
+const (
+	refreshSelectorSize = 16 // jti as raw UUID bytes
+	refreshVerifierSize = 32
+)
+
+// encodeRefreshToken packs the jti (selector) and the secret verifier into one
+// base64 string.
+func encodeRefreshToken(jti string, verifier []byte) (string, error) {
+	selector, err := uuid.Parse(jti)
+	if err != nil {
+		return "", err
+	}
+
+	refreshBytes := append(selector[:], verifier...)
+	return base64.RawStdEncoding.Strict().EncodeToString(refreshBytes), nil
+}
+
+// decodeRefreshToken splits the refresh token into its jti and verifier. Legacy
+// tokens are the verifier alone, jti is empty for them.
+func decodeRefreshToken(refreshToken string) (jti string, verifier []byte, err error) {
+	refreshBytes, err := base64.RawStdEncoding.Strict().DecodeString(refreshToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch len(refreshBytes) {
+	case refreshVerifierSize:
+		return "", refreshBytes, nil
+	case refreshSelectorSize + refreshVerifierSize:
+		selector, err := uuid.FromBytes(refreshBytes[:refreshSelectorSize])
+		if err != nil {
+			return "", nil, err
+		}
+		return selector.String(), refreshBytes[refreshSelectorSize:], nil
+	}
+
+	return "", nil, ErrInvalidToken
+}
+
+// Authentication methods of RFC 8176, put into the "amr" claim.
+const (
+	AuthMethodPassword = "pwd"
+	AuthMethodOTP      = "otp"
+	// AuthMethodHardwareKey is a passkey
+	AuthMethodHardwareKey = "hwk"
+	// AuthMethodEmail is a link or code sent by mail, not registered by RFC 8176
+	AuthMethodEmail = "email"
+	AuthMethodMFA   = "mfa"
+)
+
+// Authentication describes how and when the user logged in to a session.
+type Authentication struct {
+	Time    time.Time
+	Methods []string
+}
+
+// LoginResult holds either the token pair or, for users with MFA enabled, the
+// challenge that CompleteMFALogin takes together with the second factor.
+type LoginResult struct {
+	UserID       string
+	AccessToken  string
+	RefreshToken string
+	MFAChallenge *MFAChallenge
+}
+
+// Login verifies the credentials with the configured authenticators and starts
+// a session.
+func (s *AuthService) Login(
+	ctx context.Context, login, password, ipAddress, userAgent string, binding TokenBinding,
+) (LoginResult, error) {
+	userID, err := s.authenticator.Authenticate(ctx, login, password)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return s.StartSession(ctx, userID, AuthMethodPassword, ipAddress, userAgent, binding)
+}
+
+// StartSession issues a token pair to the user who passed the first login step
+// with authMethod, or an MFA challenge if the user has MFA enabled. The
+// binding holds the keys the client proved with the login, if any.
+func (s *AuthService) StartSession(
+	ctx context.Context, userID, authMethod, ipAddress, userAgent string, binding TokenBinding,
+) (LoginResult, error) {
+	accessToken, refreshToken, err := s.GenerateTokens(ctx, userID, authMethod, ipAddress, userAgent, binding)
+	if errors.Is(err, ErrMFARequired) {
+		challenge, err := s.mfa.CreateChallenge(ctx, userID, authMethod)
+		if err != nil {
+			return LoginResult{}, err
+		}
+
+		s.logger.Info("First factor accepted, waiting for second factor", "userID", userID, "ip_address", ipAddress)
+		return LoginResult{UserID: userID, MFAChallenge: &challenge}, nil
+	} else if err != nil {
+		return LoginResult{}, err
+	}
+
+	s.logger.Info("User logged in", "userID", userID, "ip_address", ipAddress)
+	return LoginResult{UserID: userID, AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// CompleteMFALogin checks the second factor of the challenged login and issues
+// the token pair, bound to the keys the client proved with this request.
+func (s *AuthService) CompleteMFALogin(
+	ctx context.Context, challengeToken, code, ipAddress, userAgent string, binding TokenBinding,
+) (accessToken, refreshToken string, err error) {
+	userID, firstMethod, err := s.mfa.CompleteChallenge(ctx, challengeToken, code)
+	if err != nil {
+		return "", "", err
+	}
+
+	authentication := Authentication{
+		Time:    time.Now(),
+		Methods: []string{firstMethod, AuthMethodOTP, AuthMethodMFA},
+	}
+	accessToken, refreshToken, err = s.generateTokens(ctx, userID, ipAddress, userAgent, authentication, nil, binding, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	s.logger.Info("User logged in with second factor", "userID", userID, "ip_address", ipAddress)
+	return accessToken, refreshToken, nil
+}
+
+// GenerateTokens starts a new session of the user who logged in with authMethod.
+// Users with MFA enabled get ErrMFARequired, their sessions are started by
+// CompleteMFALogin.
+func (s *AuthService) GenerateTokens(
+	ctx context.Context, userID, authMethod, ipAddress, userAgent string, binding TokenBinding,
+) (accessToken, refreshToken string, err error) {
+	mfaEnabled, err := s.mfa.Enabled(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if mfaEnabled {
+		return "", "", ErrMFARequired
+	}
+
+	authentication := Authentication{Time: time.Now(), Methods: []string{authMethod}}
+	return s.generateTokens(ctx, userID, ipAddress, userAgent, authentication, nil, binding, nil)
+}
+
+// clientGrant limits the tokens of an OAuth client session to the scope the
+// user granted to the client.
+type clientGrant struct {
+	ClientID string
+	Scope    []string
+}
+
+// generateTokens issues a token pair of a new session, or of the session of
+// the previous token, which then overrides authentication and grant. The
+// binding constrains both tokens to the keys of the client.
+func (s *AuthService) generateTokens(
+	ctx context.Context,
+	userID, ipAddress, userAgent string,
+	authentication Authentication,
+	grant *clientGrant,
+	binding TokenBinding,
+	previous *repository.TokenData,
+) (accessToken, refreshToken string, err error) {
 	var jti string = uuid.New().String()
+	familyID := jti
+	if previous != nil {
+		familyID = previous.FamilyID
+		authentication = Authentication{Time: previous.AuthenticatedAt, Methods: previous.AuthMethods}
+		if previous.ClientID.Valid {
+			grant = &clientGrant{ClientID: previous.ClientID.String, Scope: strings.Fields(previous.Scope.String)}
+		}
+	}
 
 	// TODO: можно поменять UserAgent на fingerprint браузера
-	// Add userID to the database (this function will not add userID if user already exists)
-	// Пометка: в более общем сервисе аутентификации я бы вынес добавление пользователя в методы регистрации.
-	// Также же сейчас таблица пользователей хранит только его id, но я все равно решил выделить отдельную
-	// таблицу с расчетом на то, что система аутентификации могла бы расшириться и добавились
-	// бы новые поля для пользователей.
-	err = s.repo.AddUser(ctx, userID)
+	// Users are created on registration, tokens are only issued for existing ones.
+
+	// Read on every issue, so role changes take effect on the next refresh
+	roles, permissions, err := s.roles.UserGrants(ctx, userID)
 	if err != nil {
 		return "", "", err
 	}
@@ -86,32 +364,74 @@ func (s *AuthService) GenerateTokens(ctx context.Context, userID, ipAddress, use
 		"jti": jti,
 		"exp": time.Now().Add(s.accessExpireTime).Unix(),
 		"iat": time.Now().Unix(),
+		"auth_time": authentication.Time.Unix(),
 	}
-	accessJWT := jwt.NewWithClaims(jwt.SigningMethodHS512, accessPayload)
-	accessToken, err = accessJWT.SignedString([]byte(s.jwtSecret))
+	if len(authentication.Methods) > 0 {
+		accessPayload["amr"] = authentication.Methods
+	}
+	if grant != nil {
+		// The client gets the granted scope the user still has permissions for
+		permissions = slices.DeleteFunc(slices.Clone(grant.Scope), func(scope string) bool {
+			return !slices.Contains(permissions, scope) && !IsIdentityScope(scope)
+		})
+		accessPayload["client_id"] = grant.ClientID
+	} else if len(roles) > 0 {
+		accessPayload["roles"] = roles
+	}
+	if len(permissions) > 0 {
+		accessPayload["scope"] = strings.Join(permissions, " ")
+	}
+	if confirmation := binding.confirmation(); confirmation != nil {
+		accessPayload["cnf"] = confirmation
+	}
+	accessToken, err = s.signAccessToken(ctx, accessPayload)
 	if err != nil {
-		s.logger.Error("Failed to sign access token", "error", err)
 		return "", "", err
 	}
 
-	// generate refresh token
-	refreshBytes := make([]byte, 32)
-	_, err = rand.Read(refreshBytes)
+	// generate refresh token: the jti selects the row, only the verifier is secret
+	verifier := make([]byte, refreshVerifierSize)
+	_, err = rand.Read(verifier)
 	if err != nil {
 		s.logger.Error("Failed to generate random bytes for refresh token", "error", err)
 		return "", "", err
 	}
 
-	refreshToken = base64.RawStdEncoding.Strict().EncodeToString(refreshBytes)
+	refreshToken, err = encodeRefreshToken(jti, verifier)
+	if err != nil {
+		s.logger.Error("Failed to encode refresh token", "error", err)
+		return "", "", err
+	}
 
-	tokenHash, err := s.hashRefreshToken(refreshBytes)
+	tokenHash, err := s.hashRefreshToken(verifier)
 	if err != nil {
 		return "", "", err
 	}
 
 	createdAt := time.Now()
 	expiresAt := createdAt.Add(s.refreshExpireTime)
-	err = s.repo.StoreRefreshToken(ctx, tokenHash, jti, userID, ipAddress, userAgent, createdAt, expiresAt)
+	var clientID, scope, certThumbprint sql.NullString
+	if grant != nil {
+		clientID = sql.NullString{String: grant.ClientID, Valid: true}
+		scope = sql.NullString{String: strings.Join(grant.Scope, " "), Valid: true}
+	}
+	if binding.CertBoundRefreshToken && binding.CertThumbprint != "" {
+		certThumbprint = sql.NullString{String: binding.CertThumbprint, Valid: true}
+	}
+	dpopJKT := sql.NullString{String: binding.DPoPJKT, Valid: binding.DPoPJKT != ""}
+	// Rotation replaces the session's token, only new sessions count against the limit
+	if previous == nil && s.sessionLimit.MaxSessions > 0 {
+		err = s.repo.StoreSessionRefreshToken(
+			ctx, s.makeRoomForSession, s.accessExpireTime,
+			tokenHash, jti, familyID, userID, ipAddress, userAgent, createdAt, expiresAt, authentication.Time,
+			authentication.Methods, clientID, scope, dpopJKT, certThumbprint,
+		)
+	} else {
+		err = s.repo.StoreRefreshToken(
+			ctx, tokenHash, jti, familyID, userID, ipAddress, userAgent, createdAt, expiresAt, authentication.Time,
+			authentication.Methods, clientID, scope, dpopJKT, certThumbprint,
+		)
+	}
 	if err != nil {
 		return "", "", err
 	}
@@ -121,8 +441,10 @@ func (s *AuthService) GenerateTokens(ctx context.Context, userID, ipAddress, use
 	return accessToken, refreshToken, err
 }
 
+// RefreshTokens rotates the token pair of the user's session. The binding
+// holds the keys the client proved with the request, if any.
 func (s *AuthService) RefreshTokens(
-	ctx context.Context, accessToken, refreshToken string,
+	ctx context.Context, accessToken, refreshToken string, binding TokenBinding,
 ) (newAccessToken, newRefreshToken string, err error) {
 	// Verify accessToken.
 	userID, accessJTI, _, err := s.VerifyAccessToken(ctx, accessToken)
@@ -131,23 +453,120 @@ func (s *AuthService) RefreshTokens(
 	}
 
 	// Verify refreshToken.
-	refreshJTI, oldTokenHash, err := s.VerifyRefreshToken(ctx, refreshToken, userID)
+	oldRefreshToken, err := s.VerifyRefreshToken(ctx, refreshToken, userID)
 	if err != nil {
 		return "", "", err
 	}
 
-	if accessJTI != refreshJTI {
+	if accessJTI != oldRefreshToken.JTI {
 		return "", "", ErrNotPairsTokens
 	}
 
-	// Delete old refresh token from database
-	err = s.repo.RevokeToken(ctx, oldTokenHash)
+	return s.rotateRefreshToken(ctx, oldRefreshToken, binding)
+}
+
+// RefreshSessionTokens refreshes a first-party session with the refresh token
+// alone, for browsers that keep it in an HttpOnly cookie and lose the access
+// token on reload. Sessions of OAuth clients are refreshed by the token endpoint.
+func (s *AuthService) RefreshSessionTokens(
+	ctx context.Context, refreshToken string, binding TokenBinding,
+) (newAccessToken, newRefreshToken string, err error) {
+	oldRefreshToken, err := s.VerifyRefreshToken(ctx, refreshToken, "")
 	if err != nil {
 		return "", "", err
 	}
 
+	if oldRefreshToken.ClientID.Valid {
+		s.logger.Info("Refresh token of an OAuth client presented as a session cookie", "jti", oldRefreshToken.JTI)
+		return "", "", ErrTokenNotFound
+	}
+
+	return s.rotateRefreshToken(ctx, oldRefreshToken, binding)
+}
+
+// ClientTokens are the tokens of an OAuth client session.
+type ClientTokens struct {
+	AccessToken  string
+	RefreshToken string
+	UserID       string
+	// Scope is the scope the user granted to the client
+	Scope          []string
+	Authentication Authentication
+}
+
+// RefreshClientTokens is the refresh_token grant of OAuth clients: they only
+// hold the refresh token, which must have been issued to the same client.
+func (s *AuthService) RefreshClientTokens(
+	ctx context.Context, clientID, refreshToken string, binding TokenBinding,
+) (ClientTokens, error) {
+	oldRefreshToken, err := s.VerifyRefreshToken(ctx, refreshToken, "")
+	if err != nil {
+		return ClientTokens{}, err
+	}
+
+	if oldRefreshToken.ClientID.String != clientID {
+		s.logger.Info("Refresh token presented by another client", "jti", oldRefreshToken.JTI, "client_id", clientID)
+		return ClientTokens{}, ErrTokenNotFound
+	}
+
+	accessToken, newRefreshToken, err := s.rotateRefreshToken(ctx, oldRefreshToken, binding)
+	if err != nil {
+		return ClientTokens{}, err
+	}
+
+	return ClientTokens{
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
+		UserID:       oldRefreshToken.UserID,
+		Scope:        strings.Fields(oldRefreshToken.Scope.String),
+		Authentication: Authentication{
+			Time:    oldRefreshToken.AuthenticatedAt,
+			Methods: oldRefreshToken.AuthMethods,
+		},
+	}, nil
+}
+
+// rotateRefreshToken replaces the verified refresh token with a new token pair
+// of the same session. A session bound to a DPoP key or a certificate is
+// rotated only with a proof of that key or over a connection with that
+// certificate, an unbound session sent with them gets bound to them.
+func (s *AuthService) rotateRefreshToken(
+	ctx context.Context, oldRefreshToken repository.TokenData, binding TokenBinding,
+) (newAccessToken, newRefreshToken string, err error) {
+	if oldRefreshToken.DPoPJKT.Valid && oldRefreshToken.DPoPJKT.String != binding.DPoPJKT {
+		s.logger.Warn("Bound refresh token presented without its DPoP key", "jti", oldRefreshToken.JTI)
+		return "", "", ErrDPoPKeyMismatch
+	}
+	if oldRefreshToken.CertThumbprint.Valid {
+		if oldRefreshToken.CertThumbprint.String != binding.CertThumbprint {
+			s.logger.Warn("Bound refresh token presented without its client certificate", "jti", oldRefreshToken.JTI)
+			return "", "", ErrCertificateMismatch
+		}
+		binding.CertBoundRefreshToken = true
+	}
+
+	// Keep the old refresh token as used until it expires, so its replay is detected
+	marked, err := s.repo.MarkRefreshTokenUsed(ctx, oldRefreshToken.JTI, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	if !marked {
+		// A concurrent request has rotated the same token
+		s.handleRefreshTokenReuse(ctx, oldRefreshToken)
+		return "", "", ErrTokenReused
+	}
+
 	// Generate new tokens.
-	newAccessToken, newRefreshToken, err = s.GenerateTokens(ctx, userID, ctx.Value("ipAddress").(string), ctx.Value("userAgent").(string))
+	newAccessToken, newRefreshToken, err = s.generateTokens(
+		ctx,
+		oldRefreshToken.UserID,
+		ctx.Value("ipAddress").(string),
+		ctx.Value("userAgent").(string),
+		Authentication{},
+		nil,
+		binding,
+		&oldRefreshToken,
+	)
 	if err != nil {
 		return "", "", err
 	}
@@ -155,119 +574,264 @@ func (s *AuthService) RefreshTokens(
 	return newAccessToken, newRefreshToken, nil
 }
 
-func (s *AuthService) VerifyAccessToken(ctx context.Context, accessToken string) (
+// IssueClientTokens starts a session of the OAuth client on behalf of the user.
+// The user has passed the login, including MFA, before authorizing the client,
+// the session keeps the authentication of that login.
+func (s *AuthService) IssueClientTokens(
+	ctx context.Context,
+	userID, clientID string,
+	scope []string,
+	authentication Authentication,
+	ipAddress, userAgent string,
+	binding TokenBinding,
+) (ClientTokens, error) {
+	grant := &clientGrant{ClientID: clientID, Scope: scope}
+	accessToken, refreshToken, err := s.generateTokens(
+		ctx, userID, ipAddress, userAgent, authentication, grant, binding, nil,
+	)
+	if err != nil {
+		return ClientTokens{}, err
+	}
+
+	s.logger.Info("Tokens issued to OAuth client", "userID", userID, "client_id", clientID, "ip_address", ipAddress)
+	return ClientTokens{
+		AccessToken:    accessToken,
+		RefreshToken:   refreshToken,
+		UserID:         userID,
+		Scope:          scope,
+		Authentication: authentication,
+	}, nil
+}
+
+// grantTypeClaimClientCredentials marks tokens of service accounts in the "gty" claim.
+const grantTypeClaimClientCredentials = "client-credentials"
+
+// IssueServiceToken issues an access token of the service account itself,
+// without a refresh token. A zero ttl means the default access token TTL, an
+// empty audience the audience of this service, the binding constrains the
+// token to the keys of the client.
+func (s *AuthService) IssueServiceToken(
+	ctx context.Context, clientID string, scope, audience []string, ttl time.Duration, binding TokenBinding,
+) (string, error) {
+	if err := checkAudience(audience); err != nil {
+		return "", err
+	}
+	if ttl == 0 {
+		ttl = s.accessExpireTime
+	}
+
+	now := time.Now()
+	accessPayload := jwt.MapClaims{
+		"sub":       clientID,
+		"client_id": clientID,
+		"gty":       grantTypeClaimClientCredentials,
+		"jti":       uuid.New().String(),
+		"exp":       now.Add(ttl).Unix(),
+		"iat":       now.Unix(),
+	}
+	if len(scope) > 0 {
+		accessPayload["scope"] = strings.Join(scope, " ")
+	}
+	if len(audience) > 0 {
+		accessPayload["aud"] = audience
+	}
+	if confirmation := binding.confirmation(); confirmation != nil {
+		accessPayload["cnf"] = confirmation
+	}
+
+	accessToken, err := s.signAccessToken(ctx, accessPayload)
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("Token issued to service account", "client_id", clientID, "scope", scope, "audience", audience)
+	return accessToken, nil
+}
+
+// signAccessToken signs the claims with the issuer of this service and, unless
+// they restrict it, the audience of this service.
+func (s *AuthService) signAccessToken(ctx context.Context, accessPayload jwt.MapClaims) (string, error) {
+	accessPayload["iss"] = s.tokens.Issuer
+	if _, ok := accessPayload["aud"]; !ok {
+		accessPayload["aud"] = s.tokens.Audience
+	}
+
+	signingKey, err := s.keyRing.ActiveKey(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get active signing key", "error", err)
+		return "", err
+	}
+	accessToken, err := signingKey.Sign(accessPayload)
+	if err != nil {
+		s.logger.Error("Failed to sign access token", "error", err)
+		return "", err
+	}
+	return accessToken, nil
+}
+
+// AccessTokenTTL is the lifetime of issued access tokens.
+func (s *AuthService) AccessTokenTTL() time.Duration {
+	return s.accessExpireTime
+}
+
+// RefreshTokenTTL is the lifetime of issued refresh tokens.
+func (s *AuthService) RefreshTokenTTL() time.Duration {
+	return s.refreshExpireTime
+}
+
+// VerifyAccessToken verifies the access token of a user session like
+// VerifyAccessTokenClaims and returns its subject, jti and expiration.
+// Client_credentials tokens have no user and fail with ErrServiceToken, use
+// VerifyAccessTokenClaims to accept them.
+func (s *AuthService) VerifyAccessToken(ctx context.Context, accessToken string, requiredScopes ...string) (
 	userID, jti string, revoke_at time.Time, err error,
 ) {
+	claims, err := s.VerifyAccessTokenClaims(ctx, accessToken, requiredScopes...)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
+	if claims.Service {
+		return "", "", time.Time{}, ErrServiceToken
+	}
+
+	return claims.UserID, claims.JTI, claims.ExpiresAt, nil
+}
+
+// VerifyAccessTokenClaims verifies the access token like ParseAccessToken and
+// that it is meant for this service: the configured audience is one of its
+// audiences and it grants every one of requiredScopes.
+func (s *AuthService) VerifyAccessTokenClaims(
+	ctx context.Context, accessToken string, requiredScopes ...string,
+) (*AccessTokenClaims, error) {
+	claims, err := s.ParseAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(claims.Audience, s.tokens.Audience) {
+		s.logger.Info("Access token of another audience", "jti", claims.JTI, "audience", claims.Audience)
+		return nil, ErrInvalidAudience
+	}
+	if !claims.HasScopes(requiredScopes...) {
+		return nil, ErrInsufficientScope
+	}
+
+	return claims, nil
+}
+
+// ParseAccessToken verifies the access token signature, expiration, issuer and
+// block list and returns its claims. Tokens of any audience are accepted, for
+// introspection.
+func (s *AuthService) ParseAccessToken(ctx context.Context, accessToken string) (*AccessTokenClaims, error) {
 	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		signingKey, err := s.keyRing.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != signingKey.Method.Alg() {
 			return nil, ErrInvalidToken
 		}
-		return []byte(s.jwtSecret), nil
+		return signingKey.verificationKey(), nil
 	})
 	if err != nil || !token.Valid {
 		s.logger.Info("Access token verification failed", "error", err)
-		return "", "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	payload, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
 		s.logger.Info("Invalid access token payload, not a MapClaims")
-		return "", "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	userID, ok = payload["sub"].(string)
+	// Tokens minted by other products sharing the signing key are not ours
+	if issuer, _ := payload.GetIssuer(); issuer != s.tokens.Issuer {
+		s.logger.Info("Access token of another issuer", "issuer", issuer)
+		return nil, ErrInvalidIssuer
+	}
+
+	var claims AccessTokenClaims
+	claims.UserID, ok = payload["sub"].(string)
 	if !ok {
 		s.logger.Info("Invalid 'sub' claim in access token")
-		return "", "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	jti, ok = payload["jti"].(string)
+	claims.JTI, ok = payload["jti"].(string)
 	if !ok {
 		s.logger.Info("Invalid 'jti' claim in access token")
-		return "", "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	expFloat, ok := payload["exp"].(float64)
 	if !ok {
 		s.logger.Info("Invalid 'exp' claim in access token, not a float64", "payload", payload)
-		return "", "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
-	revoke_at = time.Unix(int64(expFloat), 0)
-	if !ok {
-		s.logger.Info("Invalid 'exp' claim in access token", "payload", payload)
-		return "", "", time.Time{}, ErrInvalidToken
+	claims.ExpiresAt = time.Unix(int64(expFloat), 0)
+
+	if iatFloat, ok := payload["iat"].(float64); ok {
+		claims.IssuedAt = time.Unix(int64(iatFloat), 0)
 	}
 
-	isTokenBlocked, err := s.repo.IsTokenInBlackList(ctx, jti)
+	if roles, ok := payload["roles"].([]any); ok {
+		for _, role := range roles {
+			if roleStr, ok := role.(string); ok {
+				claims.Roles = append(claims.Roles, roleStr)
+			}
+		}
+	}
+	if scope, ok := payload["scope"].(string); ok {
+		claims.Permissions = strings.Fields(scope)
+	}
+	claims.ClientID, _ = payload["client_id"].(string)
+	if gty, _ := payload["gty"].(string); gty == grantTypeClaimClientCredentials {
+		// The subject is the client, not a user
+		claims.Service = true
+		claims.UserID = ""
+	}
+	claims.Audience, _ = payload.GetAudience()
+	claims.Actor = parseActor(payload["act"])
+	if confirmation, ok := payload["cnf"].(map[string]any); ok {
+		claims.DPoPJKT, _ = confirmation["jkt"].(string)
+		claims.CertThumbprint, _ = confirmation["x5t#S256"].(string)
+	}
+	if authTime, ok := payload["auth_time"].(float64); ok {
+		claims.Authentication.Time = time.Unix(int64(authTime), 0)
+	}
+	if authMethods, ok := payload["amr"].([]any); ok {
+		for _, authMethod := range authMethods {
+			if authMethodStr, ok := authMethod.(string); ok {
+				claims.Authentication.Methods = append(claims.Authentication.Methods, authMethodStr)
+			}
+		}
+	}
+
+	isTokenBlocked, err := s.repo.IsTokenInBlackList(ctx, claims.JTI)
 	if err != nil {
 		s.logger.Error("FAILED to read blocked tokens.", "payload", payload, "error", err)
-		return "", "", time.Time{}, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
 	if isTokenBlocked {
-		return "", "", time.Time{}, ErrTokenBlocked
+		return nil, ErrTokenBlocked
 	}
 
-	return userID, jti, revoke_at, err
+	return &claims, nil
 }
 
 func (s *AuthService) VerifyRefreshToken(
 	ctx context.Context, refreshToken, userID string,
-) (string, string, error) {
-	refreshBytes, err := base64.RawStdEncoding.Strict().DecodeString(refreshToken)
-	if err != nil {
-		s.logger.Info("Failed to decode refresh token", "error", err)
-		return "", "", ErrInvalidToken
-	}
-
-	var jti string
-	var tokenHash string
-	var refreshTokenData repository.TokenData
-	var refreshTokenDataArray []repository.TokenData
-
-	refreshTokenDataArray, repoErr := s.repo.GetRefreshUserTokens(ctx, userID)
+) (repository.TokenData, error) {
+	refreshTokenData, repoErr := s.findRefreshToken(ctx, refreshToken, userID)
 	if repoErr != nil {
-		if repoErr == sql.ErrNoRows {
-			s.logger.Info("Refresh token not found in db", "user", userID)
-			return "", "", ErrInvalidToken
-		}
-		s.logger.Info("Failed to get refresh token from db", "error", repoErr, "user", userID)
-		return "", "", repoErr
+		return repository.TokenData{}, repoErr
 	}
 
-	foundMatch := false
-	for _, token := range refreshTokenDataArray {
-		// Compare bcrypt hash from the provided refreshBytes with the stored hash for this token
-		compareErr := bcrypt.CompareHashAndPassword([]byte(token.TokenHash), refreshBytes)
-		if compareErr == nil {
-			// If match found, then break
-			refreshTokenData = token
-			jti = token.JTI
-			tokenHash = token.TokenHash
-			foundMatch = true
-			break
-		} else if compareErr == bcrypt.ErrMismatchedHashAndPassword {
-			s.logger.Debug(
-				"Candidate refresh token hash mismatch",
-				"token_hash", refreshTokenData.TokenHash,
-				"userID", token.UserID,
-			)
-		} else {
-			s.logger.Warn(
-				"Bcrypt comparison failed for a candidate token due to unexpected error",
-				"error", compareErr,
-				"token_hash", refreshTokenData.TokenHash,
-				"userID", token.UserID,
-			)
-		}
-	}
-
-	if !foundMatch {
-		s.logger.Info(
-			"No matching refresh token found for user in database after iterating all records",
-			"userID", userID,
-		)
-		return "", "", ErrTokenNotFound
+	if refreshTokenData.UsedAt.Valid {
+		s.handleRefreshTokenReuse(ctx, refreshTokenData)
+		return repository.TokenData{}, ErrTokenReused
 	}
 
 	if time.Now().After(refreshTokenData.ExpiresAt) {
@@ -283,23 +847,7 @@ func (s *AuthService) VerifyRefreshToken(
 				"token_hash", refreshTokenData.TokenHash,
 			)
 		}
-		return "", "", ErrTokenExpires
-	}
-
-	err = bcrypt.CompareHashAndPassword([]byte(refreshTokenData.TokenHash), refreshBytes)
-	if err != nil {
-		s.logger.Info(
-			"Refresh token hash mismatch",
-			"token_hash", refreshTokenData.TokenHash,
-			"userID", userID)
-		if repoErr = s.repo.RevokeToken(ctx, refreshTokenData.TokenHash); repoErr != nil {
-			s.logger.Error(
-				"Failed to revoke token after hash mismatch",
-				"error", repoErr,
-				"token_hash", refreshTokenData.TokenHash,
-			)
-		}
-		return "", "", ErrInvalidToken
+		return repository.TokenData{}, ErrTokenExpires
 	}
 
 	userAgent, ok := ctx.Value("userAgent").(string)
@@ -311,14 +859,14 @@ func (s *AuthService) VerifyRefreshToken(
 			"userAgentIn", userAgent,
 			"user_id", userID,
 		)
-		if repoErr = s.RevokeUsersRefreshTokens(ctx, userID); repoErr != nil {
+		if repoErr = s.RevokeUsersRefreshTokens(ctx, refreshTokenData.UserID); repoErr != nil {
 			s.logger.Error(
 				"Failed to revoke user tokens after user agent mismatch",
 				"error", repoErr,
-				"userID", userID,
+				"userID", refreshTokenData.UserID,
 			)
 		}
-		return "", "", ErrUserAgentMismatch
+		return repository.TokenData{}, ErrUserAgentMismatch
 	}
 
 	ipAddress, ok := ctx.Value("ipAddress").(string)
@@ -331,11 +879,124 @@ func (s *AuthService) VerifyRefreshToken(
 		)
 	}
 
-	return jti, tokenHash, nil
+	return refreshTokenData, nil
+}
+
+// handleRefreshTokenReuse revokes the whole rotation chain of a replayed refresh
+// token: either the legitimate client or an attacker holds a stolen copy, and we
+// can't tell which one, so both have to authenticate again.
+func (s *AuthService) handleRefreshTokenReuse(ctx context.Context, tokenData repository.TokenData) {
+	s.logger.Warn(
+		"Refresh token reuse detected, revoking token family",
+		"userID", tokenData.UserID,
+		"jti", tokenData.JTI,
+		"family_id", tokenData.FamilyID,
+	)
+
+	revokedCount, err := s.revokeTokenFamily(ctx, tokenData.FamilyID)
+	if err != nil {
+		s.logger.Error("Failed to revoke refresh token family", "error", err, "family_id", tokenData.FamilyID)
+	}
+
+	ipAddress, _ := ctx.Value("ipAddress").(string)
+	userAgent, _ := ctx.Value("userAgent").(string)
+	s.NotifySecurityEventWebhook(SecurityEventRefreshTokenReuse, tokenData.UserID, map[string]any{
+		"family_id":     tokenData.FamilyID,
+		"revoked_count": revokedCount,
+		"ip_address":    ipAddress,
+		"user_agent":    userAgent,
+	})
+}
+
+// findRefreshToken returns the stored token matching the refresh token. Tokens
+// with a selector are fetched by their jti, legacy tokens are looked up among the
+// user's live tokens, so they can only be found when userID is known. An empty
+// userID skips the owner check for tokens with a selector.
+func (s *AuthService) findRefreshToken(
+	ctx context.Context, refreshToken, userID string,
+) (repository.TokenData, error) {
+	jti, verifier, err := decodeRefreshToken(refreshToken)
+	if err != nil {
+		s.logger.Info("Failed to decode refresh token", "error", err)
+		return repository.TokenData{}, ErrInvalidToken
+	}
+
+	if jti == "" {
+		return s.findLegacyRefreshToken(ctx, verifier, userID)
+	}
+
+	tokenData, repoErr := s.refreshTokens.GetRefreshTokenByJTI(ctx, jti)
+	if repoErr == sql.ErrNoRows {
+		s.logger.Info("Refresh token not found in db", "jti", jti, "user", userID)
+		return repository.TokenData{}, ErrTokenNotFound
+	} else if repoErr != nil {
+		s.logger.Info("Failed to get refresh token from db", "error", repoErr, "jti", jti)
+		return repository.TokenData{}, repoErr
+	}
+
+	if userID != "" && tokenData.UserID != userID {
+		s.logger.Info("Refresh token belongs to another user", "jti", jti, "user", userID)
+		return repository.TokenData{}, ErrTokenNotFound
+	}
+
+	if err = bcrypt.CompareHashAndPassword([]byte(tokenData.TokenHash), verifier); err != nil {
+		s.logger.Info("Refresh token verifier mismatch", "jti", jti, "user", tokenData.UserID)
+		return repository.TokenData{}, ErrTokenNotFound
+	}
+
+	return tokenData, nil
+}
+
+// findLegacyRefreshToken looks up tokens issued before refresh tokens carried a
+// selector. It is only needed until the last of them expires.
+func (s *AuthService) findLegacyRefreshToken(
+	ctx context.Context, refreshBytes []byte, userID string,
+) (repository.TokenData, error) {
+	if userID == "" {
+		s.logger.Info("Legacy refresh token can't be found without user")
+		return repository.TokenData{}, ErrTokenNotFound
+	}
+
+	refreshTokenDataArray, repoErr := s.refreshTokens.GetLegacyRefreshUserTokens(ctx, userID)
+	if repoErr != nil {
+		if repoErr == sql.ErrNoRows {
+			s.logger.Info("Refresh token not found in db", "user", userID)
+			return repository.TokenData{}, ErrInvalidToken
+		}
+		s.logger.Info("Failed to get refresh token from db", "error", repoErr, "user", userID)
+		return repository.TokenData{}, repoErr
+	}
+
+	for _, token := range refreshTokenDataArray {
+		// Compare bcrypt hash from the provided refreshBytes with the stored hash for this token
+		compareErr := bcrypt.CompareHashAndPassword([]byte(token.TokenHash), refreshBytes)
+		if compareErr == nil {
+			return token, nil
+		} else if compareErr == bcrypt.ErrMismatchedHashAndPassword {
+			s.logger.Debug(
+				"Candidate refresh token hash mismatch",
+				"token_hash", token.TokenHash,
+				"userID", token.UserID,
+			)
+		} else {
+			s.logger.Warn(
+				"Bcrypt comparison failed for a candidate token due to unexpected error",
+				"error", compareErr,
+				"token_hash", token.TokenHash,
+				"userID", token.UserID,
+			)
+		}
+	}
+
+	s.logger.Info(
+		"No matching refresh token found for user in database after iterating all records",
+		"userID", userID,
+	)
+	return repository.TokenData{}, ErrTokenNotFound
 }
 
 func (s *AuthService) RevokeUsersRefreshTokens(ctx context.Context, userID string) error {
-	err := s.repo.RevokeTokensByUserID(ctx, userID)
+	err := s.repo.RevokeTokensByUserID(ctx, nil, userID, s.accessExpireTime)
 	if err != nil {
 		s.logger.Error("failed to revoke user's refresh tokens", "error", err, "userID", userID)
 		return err
@@ -356,6 +1017,13 @@ func (s *AuthService) LoggoutUser(ctx context.Context, accessToken string) error
 		return err
 	}
 
+	// Revoke the paired refresh token, so the session can't be refreshed after logout
+	err = s.revokeRefreshTokenByJTI(ctx, jti)
+	if err != nil {
+		s.logger.Info("User logout FAILED.", "user_id", ctx.Value("user_id"), "error", err)
+		return err
+	}
+
 	return nil
 }
 
@@ -377,13 +1045,30 @@ func (s *AuthService) BlockToken(ctx context.Context, jti string, revoke_at time
 
 func (s *AuthService) NotifyNewLoginWebhook(userID, newIPAddress, oldIPAddress string, timestamp time.Time) {
 	s.logger.Info("Check")
+	s.sendWebhook(userID, map[string]any{
+		"user_id":    userID,
+		"old_ip_address": oldIPAddress,
+		"new_ip_address": newIPAddress,
+		"timestamp":  timestamp.Format(time.RFC3339),
+	})
+}
+
+// NotifySecurityEventWebhook reports a security event of the user to the notification webhook.
+func (s *AuthService) NotifySecurityEventWebhook(event, userID string, details map[string]any) {
+	payload := map[string]any{
+		"event":     event,
+		"user_id":   userID,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}
+	for key, value := range details {
+		payload[key] = value
+	}
+
+	s.sendWebhook(userID, payload)
+}
+
+func (s *AuthService) sendWebhook(userID string, payload map[string]any) {
 	go func() {
-		payload := map[string]any{
-			"user_id":    userID,
-			"old_ip_address": oldIPAddress,
-			"new_ip_address": newIPAddress,
-			"timestamp":  timestamp.Format(time.RFC3339),
-		}
 		body, err := json.Marshal(payload)
 		if err != nil {
 			s.logger.Error("Failed to marshal webhook payload", "error", err, "userID", userID)
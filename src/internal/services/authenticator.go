@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// Authenticator verifies user credentials against a credential store.
+type Authenticator interface {
+	// Name identifies the store in logs and configuration.
+	Name() string
+	// Authenticate returns the local user id of the login. Unknown logins and
+	// wrong passwords are reported as ErrInvalidCredentials.
+	Authenticate(ctx context.Context, login, password string) (string, error)
+}
+
+// LocalAuthenticator checks passwords stored in the "user" table.
+type LocalAuthenticator struct {
+	users *UserService
+}
+
+func NewLocalAuthenticator(users *UserService) *LocalAuthenticator {
+	return &LocalAuthenticator{users: users}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, login, password string) (string, error) {
+	return a.users.VerifyCredentials(ctx, login, password)
+}
+
+// AuthenticatorChain asks its authenticators in order and accepts the first
+// one that knows the credentials.
+type AuthenticatorChain struct {
+	authenticators []Authenticator
+	logger         *slog.Logger
+}
+
+func NewAuthenticatorChain(logger *slog.Logger, authenticators ...Authenticator) *AuthenticatorChain {
+	return &AuthenticatorChain{authenticators: authenticators, logger: logger}
+}
+
+func (c *AuthenticatorChain) Name() string {
+	return "chain"
+}
+
+// Authenticate returns ErrInvalidCredentials only if every authenticator rejected
+// the credentials. When some of them failed, the failure is returned instead,
+// so an unavailable store isn't reported as a wrong password.
+func (c *AuthenticatorChain) Authenticate(ctx context.Context, login, password string) (string, error) {
+	var lastErr error
+	for _, authenticator := range c.authenticators {
+		userID, err := authenticator.Authenticate(ctx, login, password)
+		if err == nil {
+			c.logger.Debug("User authenticated", "authenticator", authenticator.Name(), "userID", userID)
+			return userID, nil
+		}
+
+		if !errors.Is(err, ErrInvalidCredentials) {
+			c.logger.Error("Authenticator failed", "authenticator", authenticator.Name(), "error", err)
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		return "", lastErr
+	}
+	return "", ErrInvalidCredentials
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+// ErrDeviceCodeNotFound means the user code is unknown, expired or decided already.
+var ErrDeviceCodeNotFound = errors.New("device code not found")
+
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+	// deviceSlowDownStep is added to the interval of a device that polls too often
+	deviceSlowDownStep = 5 * time.Second
+	userCodeLength     = 8
+	// userCodeAlphabet has no vowels and look-alike characters (RFC 8628, section 6.1)
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+// DeviceAuthorization is the response of the device authorization endpoint
+// (RFC 8628, section 3.2).
+type DeviceAuthorization struct {
+	DeviceCode string
+	// UserCode is formatted for reading, like WDJB-MJHT
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+}
+
+// DeviceRequest is what a device asks the user to approve.
+type DeviceRequest struct {
+	ClientID   string
+	ClientName string
+	Scope      []string
+}
+
+// AuthorizeDevice starts the device flow of the client. The device shows the
+// user code and polls the token endpoint with the device code while the user
+// approves the request on the verification page. Only the device with the
+// userAgent of this request may poll.
+func (s *OAuthService) AuthorizeDevice(
+	ctx context.Context, client OAuthClient, scope, userAgent string,
+) (DeviceAuthorization, error) {
+	if !client.AllowsGrant(GrantTypeDeviceCode) {
+		return DeviceAuthorization{}, newOAuthError(OAuthErrorUnauthorizedClient, "client may not use the device authorization grant")
+	}
+	if err := s.checkRequestedScope(ctx, client, scope); err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	deviceCode, err := generateOpaqueToken()
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	// User codes are short, retry the rare collision with a live one
+	var userCode string
+	for attempt := 0; ; attempt++ {
+		if userCode, err = generateUserCode(); err != nil {
+			return DeviceAuthorization{}, err
+		}
+
+		err = s.repo.StoreDeviceCode(ctx, repository.DeviceCodeData{
+			DeviceCodeHash: hashOpaqueToken(deviceCode),
+			UserCode:       userCode,
+			ClientID:       client.ClientID,
+			Scope:          strings.Join(strings.Fields(scope), " "),
+			Interval:       int(devicePollInterval.Seconds()),
+			ExpiresAt:      time.Now().Add(deviceCodeTTL),
+			UserAgent:      userAgent,
+		})
+		if !errors.Is(err, repository.ErrAlreadyExists) || attempt == 2 {
+			break
+		}
+	}
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+
+	formattedUserCode := userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+	s.logger.Info("Device code issued", "client_id", client.ClientID)
+	return DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                formattedUserCode,
+		VerificationURI:         s.settings.DeviceVerificationURL,
+		VerificationURIComplete: s.settings.DeviceVerificationURL + "?" + url.Values{"user_code": {formattedUserCode}}.Encode(),
+		ExpiresIn:               deviceCodeTTL,
+		Interval:                devicePollInterval,
+	}, nil
+}
+
+// DeviceRequest returns the pending request of the user code for the
+// verification page.
+func (s *OAuthService) DeviceRequest(ctx context.Context, userCode string) (DeviceRequest, error) {
+	codeData, err := s.repo.GetPendingDeviceCode(ctx, normalizeUserCode(userCode))
+	if err == sql.ErrNoRows {
+		return DeviceRequest{}, ErrDeviceCodeNotFound
+	} else if err != nil {
+		return DeviceRequest{}, err
+	}
+
+	client, err := s.Client(ctx, codeData.ClientID)
+	if errors.Is(err, ErrOAuthClientNotFound) {
+		return DeviceRequest{}, ErrDeviceCodeNotFound
+	} else if err != nil {
+		return DeviceRequest{}, err
+	}
+
+	return DeviceRequest{
+		ClientID:   client.ClientID,
+		ClientName: client.Name,
+		Scope:      strings.Fields(codeData.Scope),
+	}, nil
+}
+
+// DecideDeviceRequest approves or denies the request of the user code on
+// behalf of the logged in user. Like Authorize, the approval carries the
+// requested scope the user has permissions for and the authentication of the
+// user's session.
+func (s *OAuthService) DecideDeviceRequest(
+	ctx context.Context, userID string, authentication Authentication, userCode string, approve bool,
+) error {
+	userCode = normalizeUserCode(userCode)
+	codeData, err := s.repo.GetPendingDeviceCode(ctx, userCode)
+	if err == sql.ErrNoRows {
+		return ErrDeviceCodeNotFound
+	} else if err != nil {
+		return err
+	}
+
+	decision := repository.DeviceCodeData{
+		UserCode:    userCode,
+		Status:      repository.DeviceCodeDenied,
+		UserID:      sql.NullString{String: userID, Valid: true},
+		Scope:       codeData.Scope,
+		AuthTime:    sql.NullTime{Time: authentication.Time, Valid: !authentication.Time.IsZero()},
+		AuthMethods: authentication.Methods,
+	}
+	if approve {
+		scope, err := s.grantableScope(ctx, userID, codeData.Scope)
+		if err != nil {
+			return err
+		}
+		decision.Status = repository.DeviceCodeApproved
+		decision.Scope = strings.Join(scope, " ")
+	}
+
+	decided, err := s.repo.DecideDeviceCode(ctx, decision)
+	if err != nil {
+		return err
+	}
+	if !decided {
+		return ErrDeviceCodeNotFound
+	}
+
+	s.logger.Info("Device request decided", "userID", userID, "client_id", codeData.ClientID, "status", decision.Status)
+	return nil
+}
+
+// PollDeviceCode is the device_code grant of the token endpoint. Until the
+// user decides it returns authorization_pending, or slow_down to a device
+// that polls more often than its interval, which then grows. A device code
+// leaked to another device is useless there: polls with another userAgent
+// than the device authorization request are rejected.
+func (s *OAuthService) PollDeviceCode(
+	ctx context.Context, client OAuthClient, deviceCode, userAgent string,
+) (AuthorizationGrant, error) {
+	if !client.AllowsGrant(GrantTypeDeviceCode) {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorUnauthorizedClient, "client may not use the device authorization grant")
+	}
+	if deviceCode == "" {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidRequest, "device_code is required")
+	}
+
+	deviceCodeHash := hashOpaqueToken(deviceCode)
+	codeData, err := s.repo.GetDeviceCode(ctx, deviceCodeHash)
+	if err == sql.ErrNoRows {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "device code is invalid")
+	} else if err != nil {
+		return AuthorizationGrant{}, err
+	}
+	if codeData.ClientID != client.ClientID {
+		s.logger.Warn("Device code presented by another client", "client_id", client.ClientID, "code_client_id", codeData.ClientID)
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "device code was issued to another client")
+	}
+	if codeData.UserAgent != userAgent {
+		s.logger.Warn(
+			"Device code polled from another user agent",
+			"client_id", client.ClientID,
+			"userAgent", codeData.UserAgent,
+			"newUserAgent", userAgent,
+		)
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "device code was issued to another device")
+	}
+
+	now := time.Now()
+	if !now.Before(codeData.ExpiresAt) {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorExpiredToken, "device code has expired")
+	}
+
+	switch codeData.Status {
+	case repository.DeviceCodeDenied:
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorAccessDenied, "the user denied the request")
+	case repository.DeviceCodeUsed:
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "device code was used already")
+	case repository.DeviceCodePending:
+		interval := time.Duration(codeData.Interval) * time.Second
+		slowDown := codeData.LastPolledAt.Valid && now.Sub(codeData.LastPolledAt.Time) < interval
+		if slowDown {
+			interval += deviceSlowDownStep
+		}
+		if err := s.repo.MarkDeviceCodePolled(ctx, deviceCodeHash, now, int(interval.Seconds())); err != nil {
+			return AuthorizationGrant{}, err
+		}
+
+		if slowDown {
+			return AuthorizationGrant{}, newOAuthError(OAuthErrorSlowDown, "poll at most every "+interval.String())
+		}
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorAuthorizationPending, "the user hasn't approved the request yet")
+	}
+
+	codeData, err = s.repo.ConsumeDeviceCode(ctx, deviceCodeHash)
+	if err == sql.ErrNoRows {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "device code was used already")
+	} else if err != nil {
+		return AuthorizationGrant{}, err
+	}
+
+	return AuthorizationGrant{
+		UserID: codeData.UserID.String,
+		Scope:  strings.Fields(codeData.Scope),
+		Authentication: Authentication{
+			Time:    codeData.AuthTime.Time,
+			Methods: codeData.AuthMethods,
+		},
+	}, nil
+}
+
+func generateUserCode() (string, error) {
+	alphabetSize := big.NewInt(int64(len(userCodeAlphabet)))
+	userCode := make([]byte, userCodeLength)
+	for i := range userCode {
+		index, err := rand.Int(rand.Reader, alphabetSize)
+		if err != nil {
+			return "", err
+		}
+		userCode[i] = userCodeAlphabet[index.Int64()]
+	}
+	return string(userCode), nil
+}
+
+// normalizeUserCode accepts the code the way users type it: in any case, with
+// or without the dash and spaces.
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrInvalidDPoPProof  = errors.New("invalid DPoP proof")
+	ErrDPoPProofReplayed = errors.New("DPoP proof replayed")
+	ErrDPoPKeyMismatch   = errors.New("DPoP proof key does not match the token")
+)
+
+const (
+	// dpopProofLifetime is how long after its iat a proof is accepted
+	dpopProofLifetime = 5 * time.Minute
+	// dpopClockSkew tolerates clients whose clocks run ahead
+	dpopClockSkew  = time.Minute
+	maxDPoPJTILen  = 255
+	minDPoPRSABits = 2048
+)
+
+// DPoPSigningAlgorithms are the algorithms of accepted DPoP proofs, symmetric
+// ones can't prove possession of a key.
+var DPoPSigningAlgorithms = []string{
+	"ES256", "ES384", "ES512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "EdDSA",
+}
+
+// DPoPRequest is the request a DPoP proof (RFC 9449) is presented with.
+type DPoPRequest struct {
+	Proof  string
+	Method string
+	// Path is resolved against the issuer, the public URL of this service
+	Path string
+	// AccessToken is set when the proof accompanies an access token, which
+	// the proof then has to name in the "ath" claim
+	AccessToken string
+}
+
+// VerifyDPoPProof checks the proof signature, its key, method, URL, freshness
+// and access token hash, records its jti against replay and returns the
+// thumbprint of its key, the "jkt" tokens are bound to.
+func (s *AuthService) VerifyDPoPProof(ctx context.Context, req DPoPRequest) (string, error) {
+	var jkt string
+	token, err := jwt.Parse(req.Proof, func(token *jwt.Token) (any, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, ErrInvalidDPoPProof
+		}
+		jwk, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		publicKey, thumbprint, err := parseDPoPKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		jkt = thumbprint
+		return publicKey, nil
+	}, jwt.WithValidMethods(DPoPSigningAlgorithms))
+	if err != nil || !token.Valid {
+		s.logger.Info("DPoP proof verification failed", "error", err)
+		return "", ErrInvalidDPoPProof
+	}
+
+	payload, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", ErrInvalidDPoPProof
+	}
+	jti, _ := payload["jti"].(string)
+	if jti == "" || len(jti) > maxDPoPJTILen {
+		s.logger.Info("Invalid 'jti' claim in DPoP proof")
+		return "", ErrInvalidDPoPProof
+	}
+	if htm, _ := payload["htm"].(string); htm != req.Method {
+		s.logger.Info("DPoP proof of another method", "htm", htm, "method", req.Method)
+		return "", ErrInvalidDPoPProof
+	}
+	if htu, _ := payload["htu"].(string); !sameRequestURL(htu, s.tokens.Issuer+req.Path) {
+		s.logger.Info("DPoP proof of another URL", "htu", htu, "path", req.Path)
+		return "", ErrInvalidDPoPProof
+	}
+
+	issuedAt, err := payload.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		s.logger.Info("Invalid 'iat' claim in DPoP proof")
+		return "", ErrInvalidDPoPProof
+	}
+	now := time.Now()
+	if issuedAt.Before(now.Add(-dpopProofLifetime)) || issuedAt.After(now.Add(dpopClockSkew)) {
+		s.logger.Info("DPoP proof is not fresh", "iat", issuedAt.Time)
+		return "", ErrInvalidDPoPProof
+	}
+
+	if req.AccessToken != "" {
+		accessTokenHash := sha256.Sum256([]byte(req.AccessToken))
+		if ath, _ := payload["ath"].(string); ath != encodeBase64URL(accessTokenHash[:]) {
+			s.logger.Info("DPoP proof of another access token")
+			return "", ErrInvalidDPoPProof
+		}
+	}
+
+	err = s.dpopProofs.StoreDPoPProof(ctx, jkt, jti, issuedAt.Add(dpopProofLifetime))
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return "", ErrDPoPProofReplayed
+	} else if err != nil {
+		return "", err
+	}
+
+	return jkt, nil
+}
+
+// parseDPoPKey reads the public key of the proof header and computes its JWK
+// SHA-256 thumbprint (RFC 7638) from the required members in lexicographic
+// order.
+func parseDPoPKey(jwk map[string]any) (publicKey any, thumbprint string, err error) {
+	if _, ok := jwk["d"]; ok {
+		// A private key must never be sent
+		return nil, "", ErrInvalidDPoPProof
+	}
+
+	member := func(name string) ([]byte, string, bool) {
+		value, _ := jwk[name].(string)
+		decoded, err := base64.RawURLEncoding.Strict().DecodeString(value)
+		return decoded, value, err == nil && len(decoded) > 0
+	}
+
+	kty, _ := jwk["kty"].(string)
+	crv, _ := jwk["crv"].(string)
+	var canonical string
+	switch kty {
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, "", ErrInvalidDPoPProof
+		}
+		x, xValue, okX := member("x")
+		y, yValue, okY := member("y")
+		size := (curve.Params().BitSize + 7) / 8
+		if !okX || !okY || len(x) != size || len(y) != size {
+			return nil, "", ErrInvalidDPoPProof
+		}
+		// Rejects points that are not on the curve
+		if _, err := ecdhCurve.NewPublicKey(slices.Concat([]byte{4}, x, y)); err != nil {
+			return nil, "", ErrInvalidDPoPProof
+		}
+		publicKey = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		canonical = `{"crv":"` + crv + `","kty":"EC","x":"` + xValue + `","y":"` + yValue + `"}`
+	case "RSA":
+		n, nValue, okN := member("n")
+		e, eValue, okE := member("e")
+		if !okN || !okE || len(e) > 4 {
+			return nil, "", ErrInvalidDPoPProof
+		}
+		rsaKey := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if rsaKey.N.BitLen() < minDPoPRSABits || rsaKey.E < 3 || rsaKey.E%2 == 0 {
+			return nil, "", ErrInvalidDPoPProof
+		}
+		publicKey = rsaKey
+		canonical = `{"e":"` + eValue + `","kty":"RSA","n":"` + nValue + `"}`
+	case "OKP":
+		x, xValue, okX := member("x")
+		if crv != "Ed25519" || !okX || len(x) != ed25519.PublicKeySize {
+			return nil, "", ErrInvalidDPoPProof
+		}
+		publicKey = ed25519.PublicKey(x)
+		canonical = `{"crv":"Ed25519","kty":"OKP","x":"` + xValue + `"}`
+	default:
+		return nil, "", ErrInvalidDPoPProof
+	}
+
+	digest := sha256.Sum256([]byte(canonical))
+	return publicKey, encodeBase64URL(digest[:]), nil
+}
+
+// sameRequestURL compares the htu of a proof with the request URL, ignoring
+// the query, the fragment and the case of the scheme and host (RFC 9449,
+// section 4.3).
+func sameRequestURL(htu, requestURL string) bool {
+	proofURL, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	expectedURL, err := url.Parse(requestURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(proofURL.Scheme, expectedURL.Scheme) &&
+		strings.EqualFold(proofURL.Host, expectedURL.Host) &&
+		proofURL.EscapedPath() == expectedURL.EscapedPath()
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+const dpopTestIssuer = "https://auth.example.com"
+
+// dpopProofTable is an in-memory dpopProofStore.
+type dpopProofTable map[string]bool
+
+func (s dpopProofTable) StoreDPoPProof(_ context.Context, jkt, jti string, _ time.Time) error {
+	if s[jkt+" "+jti] {
+		return repository.ErrAlreadyExists
+	}
+	s[jkt+" "+jti] = true
+	return nil
+}
+
+func newTestDPoPService() *AuthService {
+	return &AuthService{
+		dpopProofs: dpopProofTable{},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		tokens:     TokenSettings{Issuer: dpopTestIssuer},
+	}
+}
+
+func mustGenerateECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+// ecJWK returns the public JWK of the P-256 key.
+func ecJWK(key *ecdsa.PrivateKey) map[string]any {
+	return map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   encodeBase64URL(key.X.FillBytes(make([]byte, 32))),
+		"y":   encodeBase64URL(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// dpopClaims are the claims of a proof of a token request.
+func dpopClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti": uuid.NewString(),
+		"htm": "POST",
+		"htu": dpopTestIssuer + "/oauth/token",
+		"iat": time.Now().Unix(),
+	}
+}
+
+func signDPoPProof(t *testing.T, key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = ecJWK(key)
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return proof
+}
+
+func TestParseDPoPKey(t *testing.T) {
+	t.Run("RFC 7638 thumbprint", func(t *testing.T) {
+		// RFC 7638, section 3.1
+		jwk := map[string]any{
+			"kty": "RSA",
+			"n": "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W" +
+				"-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt" +
+				"-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+			"e":   "AQAB",
+			"alg": "RS256",
+			"kid": "2011-04-29",
+		}
+		_, thumbprint, err := parseDPoPKey(jwk)
+		if err != nil {
+			t.Fatalf("parseDPoPKey: %v", err)
+		}
+		if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; thumbprint != want {
+			t.Errorf("thumbprint = %s, want %s", thumbprint, want)
+		}
+	})
+
+	ecKey := mustGenerateECKey(t)
+	weakRSAKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	withMember := func(name string, value any) map[string]any {
+		jwk := ecJWK(ecKey)
+		jwk[name] = value
+		return jwk
+	}
+	offCurveY := new(big.Int).Add(ecKey.Y, big.NewInt(1))
+
+	for name, jwk := range map[string]map[string]any{
+		"private key":     withMember("d", encodeBase64URL(ecKey.D.FillBytes(make([]byte, 32)))),
+		"point off curve": withMember("y", encodeBase64URL(offCurveY.FillBytes(make([]byte, 32)))),
+		"short x":         withMember("x", encodeBase64URL(ecKey.X.Bytes()[:16])),
+		"padded x":        withMember("x", base64.URLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32)))),
+		"other curve":     withMember("crv", "secp256k1"),
+		"weak RSA key": {
+			"kty": "RSA",
+			"n":   encodeBase64URL(weakRSAKey.N.Bytes()),
+			"e":   "AQAB",
+		},
+		"symmetric key": {"kty": "oct", "k": "c2VjcmV0"},
+		"no key type":   {"x": "AAAA"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := parseDPoPKey(jwk); !errors.Is(err, ErrInvalidDPoPProof) {
+				t.Errorf("err = %v, want ErrInvalidDPoPProof", err)
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key := mustGenerateECKey(t)
+	_, wantJKT, err := parseDPoPKey(ecJWK(key))
+	if err != nil {
+		t.Fatalf("parseDPoPKey: %v", err)
+	}
+
+	const accessToken = "access-token"
+	accessTokenHash := sha256.Sum256([]byte(accessToken))
+	tokenRequest := DPoPRequest{Method: "POST", Path: "/oauth/token"}
+
+	withClaim := func(name string, value any) string {
+		claims := dpopClaims()
+		claims[name] = value
+		return signDPoPProof(t, key, claims)
+	}
+	withoutClaim := func(name string) string {
+		claims := dpopClaims()
+		delete(claims, name)
+		return signDPoPProof(t, key, claims)
+	}
+	withHeader := func(name string, value any) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, dpopClaims())
+		token.Header["typ"] = "dpop+jwt"
+		token.Header["jwk"] = ecJWK(key)
+		token.Header[name] = value
+		proof, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return proof
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodNone, dpopClaims())
+	unsigned.Header["typ"] = "dpop+jwt"
+	unsigned.Header["jwk"] = ecJWK(key)
+	algNone, err := unsigned.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	// Signed with the x coordinate of the key as an HMAC secret, the way an
+	// algorithm confusion attack would
+	symmetric := jwt.NewWithClaims(jwt.SigningMethodHS256, dpopClaims())
+	symmetric.Header["typ"] = "dpop+jwt"
+	symmetric.Header["jwk"] = ecJWK(key)
+	hs256, err := symmetric.SignedString(key.X.Bytes())
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		proof   string
+		request DPoPRequest
+		wantErr error
+	}{
+		{name: "valid proof", proof: signDPoPProof(t, key, dpopClaims()), request: tokenRequest},
+		{name: "htu with query", proof: withClaim("htu", dpopTestIssuer+"/oauth/token?state=1"), request: tokenRequest},
+		{name: "htu with other case host", proof: withClaim("htu", "https://AUTH.example.com/oauth/token"), request: tokenRequest},
+		{
+			name:    "access token hash",
+			proof:   withClaim("ath", encodeBase64URL(accessTokenHash[:])),
+			request: DPoPRequest{Method: "POST", Path: "/oauth/token", AccessToken: accessToken},
+		},
+		{name: "wrong htm", proof: withClaim("htm", "GET"), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "wrong htu path", proof: withClaim("htu", dpopTestIssuer+"/oauth/revoke"), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "wrong htu host", proof: withClaim("htu", "https://evil.example.com/oauth/token"), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{
+			name:    "wrong ath",
+			proof:   withClaim("ath", encodeBase64URL(make([]byte, sha256.Size))),
+			request: DPoPRequest{Method: "POST", Path: "/oauth/token", AccessToken: accessToken},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{
+			name:    "missing ath",
+			proof:   signDPoPProof(t, key, dpopClaims()),
+			request: DPoPRequest{Method: "POST", Path: "/oauth/token", AccessToken: accessToken},
+			wantErr: ErrInvalidDPoPProof,
+		},
+		{name: "stale iat", proof: withClaim("iat", time.Now().Add(-dpopProofLifetime-time.Minute).Unix()), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "future iat", proof: withClaim("iat", time.Now().Add(dpopClockSkew+time.Minute).Unix()), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "missing iat", proof: withoutClaim("iat"), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "missing jti", proof: withoutClaim("jti"), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "wrong typ", proof: withHeader("typ", "JWT"), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "key of another signer", proof: withHeader("jwk", ecJWK(mustGenerateECKey(t))), request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "alg none", proof: algNone, request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+		{name: "HS256", proof: hs256, request: tokenRequest, wantErr: ErrInvalidDPoPProof},
+	}
+
+	service := newTestDPoPService()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.request.Proof = tc.proof
+			jkt, err := service.VerifyDPoPProof(context.Background(), tc.request)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("err = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyDPoPProof: %v", err)
+			}
+			if jkt != wantJKT {
+				t.Errorf("jkt = %s, want %s", jkt, wantJKT)
+			}
+		})
+	}
+
+	t.Run("replayed proof", func(t *testing.T) {
+		request := tokenRequest
+		request.Proof = signDPoPProof(t, key, dpopClaims())
+		if _, err := service.VerifyDPoPProof(context.Background(), request); err != nil {
+			t.Fatalf("VerifyDPoPProof: %v", err)
+		}
+		if _, err := service.VerifyDPoPProof(context.Background(), request); !errors.Is(err, ErrDPoPProofReplayed) {
+			t.Errorf("err = %v, want ErrDPoPProofReplayed", err)
+		}
+	})
+}
+
+func TestSameRequestURL(t *testing.T) {
+	const requestURL = "https://auth.example.com/oauth/token"
+
+	for htu, want := range map[string]bool{
+		"https://auth.example.com/oauth/token":          true,
+		"HTTPS://Auth.Example.com/oauth/token":          true,
+		"https://auth.example.com/oauth/token?a=b":      true,
+		"https://auth.example.com/oauth/token#fragment": true,
+		"https://auth.example.com/oauth/token/":         false,
+		"https://auth.example.com/OAuth/token":          false,
+		"http://auth.example.com/oauth/token":           false,
+		"https://auth.example.com:8443/oauth/token":     false,
+		"https://auth.example.com.evil.com/oauth/token": false,
+		"/oauth/token": false,
+		"":             false,
+	} {
+		if got := sameRequestURL(htu, requestURL); got != want {
+			t.Errorf("sameRequestURL(%q) = %v, want %v", htu, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrInvalidEmailLoginCode = errors.New("invalid or expired email login code")
+	ErrEmailLoginRateLimited = errors.New("too many email login requests")
+)
+
+const (
+	emailLoginCodeDigits      = 6
+	emailLoginCodeMaxAttempts = 5
+)
+
+// EmailLoginSettings configure EmailLoginService.
+type EmailLoginSettings struct {
+	CodeTTL time.Duration
+	// RateLimit is the number of codes an address may request per RateWindow
+	RateLimit  int
+	RateWindow time.Duration
+	// AppURL is the base of the login links
+	AppURL string
+}
+
+// EmailLoginService logs users in without a password: a mail carries a link
+// and a short code, either of them works once and only in the browser that
+// requested it.
+type EmailLoginService struct {
+	settings EmailLoginSettings
+	repo     *repository.EmailLoginRepository
+	users    *UserService
+	mailer   MailSender
+	box      *SecretBox
+	logger   *slog.Logger
+}
+
+func NewEmailLoginService(
+	settings EmailLoginSettings,
+	repo *repository.EmailLoginRepository,
+	users *UserService,
+	mailer MailSender,
+	box *SecretBox,
+	logger *slog.Logger,
+) *EmailLoginService {
+	settings.AppURL = strings.TrimRight(settings.AppURL, "/")
+	return &EmailLoginService{
+		settings: settings,
+		repo:     repo,
+		users:    users,
+		mailer:   mailer,
+		box:      box,
+		logger:   logger,
+	}
+}
+
+// RequestLogin mails a login link and code to the user with the email. Requests
+// for unknown emails are recorded but nothing is sent, and the mail is sent in
+// the background, so the caller can't tell whether the email is registered.
+func (s *EmailLoginService) RequestLogin(ctx context.Context, email, userAgent string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	requestCount, err := s.repo.CountEmailLoginCodesSince(ctx, email, time.Now().Add(-s.settings.RateWindow))
+	if err != nil {
+		return err
+	}
+	if requestCount >= s.settings.RateLimit {
+		s.logger.Info("Email login rate limited", "request_count", requestCount)
+		return ErrEmailLoginRateLimited
+	}
+
+	userID, err := s.users.UserIDByEmail(ctx, email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+
+	linkToken, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+	code, err := generateEmailLoginCode()
+	if err != nil {
+		return err
+	}
+
+	codeData := repository.EmailLoginCodeData{
+		ChallengeID:   uuid.New().String(),
+		Email:         email,
+		UserID:        sql.NullString{String: userID, Valid: userID != ""},
+		LinkTokenHash: hashOpaqueToken(linkToken),
+		UserAgent:     userAgent,
+		ExpiresAt:     time.Now().Add(s.settings.CodeTTL),
+	}
+	codeData.CodeHash = s.codeHash(codeData.ChallengeID, code)
+
+	pruneBefore := time.Now().Add(-max(s.settings.RateWindow, s.settings.CodeTTL))
+	if err = s.repo.StoreEmailLoginCode(ctx, codeData, pruneBefore); err != nil {
+		return err
+	}
+
+	if userID == "" {
+		s.logger.Info("Email login requested for unknown email")
+		return nil
+	}
+
+	mail := Mail{
+		To:      email,
+		Subject: "Your login code",
+		Body: fmt.Sprintf(
+			"Your login code is %s\n\n"+
+				"Or follow the link to log in:\n%s\n\n"+
+				"The code and the link are valid for %d minutes and only in the browser you requested them from.\n"+
+				"If it wasn't you, ignore this mail.\n",
+			code, s.settings.AppURL+"/login/email?token="+url.QueryEscape(linkToken), int(s.settings.CodeTTL.Minutes()),
+		),
+	}
+
+	go func() {
+		// Not derived from ctx, the request is over by the time the mail is sent
+		sendCtx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := s.mailer.Send(sendCtx, mail); err != nil {
+			s.logger.Error("Failed to send email login mail", "error", err, "userID", userID)
+		}
+	}()
+
+	s.logger.Info("Email login requested", "userID", userID)
+	return nil
+}
+
+// LoginWithLink consumes the token of the login link and returns the user id.
+func (s *EmailLoginService) LoginWithLink(ctx context.Context, linkToken, userAgent string) (string, error) {
+	codeData, err := s.repo.GetEmailLoginCodeByLink(ctx, hashOpaqueToken(linkToken))
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidEmailLoginCode
+	} else if err != nil {
+		return "", err
+	}
+
+	return s.consume(ctx, codeData, userAgent)
+}
+
+// LoginWithCode checks the code mailed to the address and returns the user id.
+// A code allows a few attempts, each is counted before the code is checked.
+func (s *EmailLoginService) LoginWithCode(ctx context.Context, email, code, userAgent string) (string, error) {
+	codeData, err := s.repo.ReserveEmailLoginCodeAttempt(
+		ctx, strings.ToLower(strings.TrimSpace(email)), emailLoginCodeMaxAttempts,
+	)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidEmailLoginCode
+	} else if err != nil {
+		return "", err
+	}
+
+	if !hmac.Equal([]byte(s.codeHash(codeData.ChallengeID, strings.TrimSpace(code))), []byte(codeData.CodeHash)) {
+		s.logger.Info("Wrong email login code", "challenge_id", codeData.ChallengeID, "attempt", codeData.Attempts)
+		return "", ErrInvalidEmailLoginCode
+	}
+
+	return s.consume(ctx, codeData, userAgent)
+}
+
+func (s *EmailLoginService) consume(
+	ctx context.Context, codeData repository.EmailLoginCodeData, userAgent string,
+) (string, error) {
+	if !codeData.UserID.Valid {
+		return "", ErrInvalidEmailLoginCode
+	}
+	if codeData.UserAgent != userAgent {
+		s.logger.Warn(
+			"Email login code used from another user agent",
+			"userID", codeData.UserID.String,
+			"userAgent", codeData.UserAgent,
+			"newUserAgent", userAgent,
+		)
+		return "", ErrUserAgentMismatch
+	}
+
+	consumed, err := s.repo.ConsumeEmailLoginCode(ctx, codeData.ChallengeID)
+	if err != nil {
+		return "", err
+	}
+	if !consumed {
+		return "", ErrInvalidEmailLoginCode
+	}
+
+	s.logger.Info("Email login verified", "userID", codeData.UserID.String)
+	return codeData.UserID.String, nil
+}
+
+// codeHash binds the code to its challenge. The code is short, so it is keyed
+// with the server secret rather than hashed plainly.
+func (s *EmailLoginService) codeHash(challengeID, code string) string {
+	return s.box.Digest("email-login:" + challengeID + ":" + code)
+}
+
+// generateEmailLoginCode returns a uniformly random code of emailLoginCodeDigits digits.
+func generateEmailLoginCode() (string, error) {
+	upperBound := big.NewInt(1)
+	for range emailLoginCodeDigits {
+		upperBound.Mul(upperBound, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, upperBound)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", emailLoginCodeDigits, n), nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// TokenIntrospection is the state of a token as defined by RFC 7662.
+// Only Active is meaningful for inactive tokens.
+type TokenIntrospection struct {
+	Active    bool
+	TokenType string
+	UserID    string
+	JTI       string
+	Scope     string
+	ClientID  string
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	// Issuer and Audience are set for access tokens
+	Issuer   string
+	Audience []string
+	// Actor is set for exchanged and impersonation tokens
+	Actor *Actor
+	// DPoPJKT is set for access and refresh tokens bound to a DPoP key
+	DPoPJKT string
+	// CertThumbprint is set for access and refresh tokens bound to a TLS
+	// client certificate
+	CertThumbprint string
+}
+
+// IntrospectToken reports whether the access or refresh token is active. The hint
+// only decides which token type is tried first.
+func (s *AuthService) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (TokenIntrospection, error) {
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		introspection, err := s.introspectRefreshToken(ctx, token)
+		if err != nil || introspection.Active {
+			return introspection, err
+		}
+		return s.introspectAccessToken(ctx, token), nil
+	}
+
+	if introspection := s.introspectAccessToken(ctx, token); introspection.Active {
+		return introspection, nil
+	}
+	return s.introspectRefreshToken(ctx, token)
+}
+
+func (s *AuthService) introspectAccessToken(ctx context.Context, token string) TokenIntrospection {
+	claims, err := s.ParseAccessToken(ctx, token)
+	if err != nil {
+		s.logger.Debug("Introspected access token is not active", "error", err)
+		return TokenIntrospection{Active: false}
+	}
+
+	return TokenIntrospection{
+		Active:         true,
+		TokenType:      TokenTypeHintAccessToken,
+		UserID:         claims.UserID,
+		JTI:            claims.JTI,
+		Scope:          strings.Join(claims.Permissions, " "),
+		ClientID:       claims.ClientID,
+		ExpiresAt:      claims.ExpiresAt,
+		IssuedAt:       claims.IssuedAt,
+		Issuer:         s.tokens.Issuer,
+		Audience:       claims.Audience,
+		Actor:          claims.Actor,
+		DPoPJKT:        claims.DPoPJKT,
+		CertThumbprint: claims.CertThumbprint,
+	}
+}
+
+// introspectRefreshToken looks the refresh token up by its selector. Legacy
+// tokens have no selector and are reported inactive.
+func (s *AuthService) introspectRefreshToken(ctx context.Context, token string) (TokenIntrospection, error) {
+	tokenData, err := s.findRefreshToken(ctx, token, "")
+	if errors.Is(err, ErrTokenNotFound) || errors.Is(err, ErrInvalidToken) {
+		s.logger.Debug("Introspected refresh token is not found", "error", err)
+		return TokenIntrospection{Active: false}, nil
+	} else if err != nil {
+		return TokenIntrospection{}, err
+	}
+
+	if tokenData.UsedAt.Valid || time.Now().After(tokenData.ExpiresAt) {
+		s.logger.Debug("Introspected refresh token is used or expired", "jti", tokenData.JTI)
+		return TokenIntrospection{Active: false}, nil
+	}
+
+	return TokenIntrospection{
+		Active:         true,
+		TokenType:      TokenTypeHintRefreshToken,
+		UserID:         tokenData.UserID,
+		JTI:            tokenData.JTI,
+		Scope:          tokenData.Scope.String,
+		ClientID:       tokenData.ClientID.String,
+		ExpiresAt:      tokenData.ExpiresAt,
+		IssuedAt:       tokenData.CreatedAt,
+		DPoPJKT:        tokenData.DPoPJKT.String,
+		CertThumbprint: tokenData.CertThumbprint.String,
+	}, nil
+}
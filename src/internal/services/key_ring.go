@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrUnknownKeyID = errors.New("unknown signing key id")
+	ErrNoActiveKey  = errors.New("no active signing key")
+)
+
+const (
+	// keyRingReloadInterval is how long the ring trusts its in-memory copy before
+	// rereading keys promoted by other instances.
+	keyRingReloadInterval = time.Minute
+	// keyRingMissReloadInterval limits rereads caused by tokens with unknown kid.
+	keyRingMissReloadInterval = 10 * time.Second
+)
+
+// KeyRing holds the active signing key and the retired keys that still verify
+// tokens issued before the last rotation. Key material is stored sealed by box.
+type KeyRing struct {
+	repo         *repository.TokenRepository
+	logger       *slog.Logger
+	box          *SecretBox
+	seedKey      *SigningKey
+	verifyWindow time.Duration
+
+	mu       sync.RWMutex
+	active   *SigningKey
+	keys     map[string]*SigningKey
+	loadedAt time.Time
+}
+
+// NewKeyRing creates a key ring. The seed key is stored on the first start, when
+// no keys exist yet. Retired keys keep verifying tokens for verifyWindow, which
+// should be the max access token TTL.
+func NewKeyRing(
+	repo *repository.TokenRepository,
+	logger *slog.Logger,
+	box *SecretBox,
+	seedKey *SigningKey,
+	verifyWindow time.Duration,
+) *KeyRing {
+	return &KeyRing{
+		repo:         repo,
+		logger:       logger,
+		box:          box,
+		seedKey:      seedKey,
+		verifyWindow: verifyWindow,
+		keys:         map[string]*SigningKey{},
+	}
+}
+
+// Load reads the keys from the database.
+func (r *KeyRing) Load(ctx context.Context) error {
+	keysData, err := r.repo.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(keysData) == 0 {
+		r.logger.Info("Key ring is empty, storing seed signing key", "kid", r.seedKey.KID)
+		if err = r.storeActiveKey(ctx, r.seedKey); err != nil {
+			// Another instance may have seeded the ring at the same time
+			r.logger.Warn("Failed to store seed signing key", "error", err, "kid", r.seedKey.KID)
+		}
+		if keysData, err = r.repo.GetSigningKeys(ctx); err != nil {
+			return err
+		}
+	}
+
+	var active *SigningKey
+	keys := make(map[string]*SigningKey, len(keysData))
+	for _, keyData := range keysData {
+		if keyData.RetiredAt.Valid && time.Since(keyData.RetiredAt.Time) > r.retiredKeyLifetime() {
+			continue
+		}
+
+		material, err := r.openKeyMaterial(ctx, keyData)
+		if err != nil {
+			r.logger.Error("Failed to decrypt signing key", "error", err, "kid", keyData.KID)
+			continue
+		}
+
+		var key *SigningKey
+		if isHMACAlgorithm(keyData.Algorithm) {
+			key, err = NewSigningKey(keyData.KID, keyData.Algorithm, material, nil)
+		} else {
+			key, err = NewSigningKey(keyData.KID, keyData.Algorithm, "", []byte(material))
+		}
+		if err != nil {
+			r.logger.Error("Failed to parse signing key", "error", err, "kid", keyData.KID)
+			continue
+		}
+		key.CreatedAt = keyData.CreatedAt
+		if keyData.RetiredAt.Valid {
+			key.RetiredAt = keyData.RetiredAt.Time
+		} else if active == nil {
+			active = key
+		}
+		keys[key.KID] = key
+	}
+
+	if active == nil {
+		return ErrNoActiveKey
+	}
+
+	r.mu.Lock()
+	r.active = active
+	r.keys = keys
+	r.loadedAt = time.Now()
+	r.mu.Unlock()
+
+	r.logger.Debug("Key ring loaded", "active_kid", active.KID, "count", len(keys))
+	return nil
+}
+
+// ActiveKey returns the key that signs new tokens.
+func (r *KeyRing) ActiveKey(ctx context.Context) (*SigningKey, error) {
+	if r.loadedBefore(keyRingReloadInterval) {
+		if err := r.Load(ctx); err != nil {
+			r.logger.Warn("Failed to reload key ring, using cached keys", "error", err)
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.active == nil {
+		return nil, ErrNoActiveKey
+	}
+	return r.active, nil
+}
+
+// Key returns the key with the kid. Tokens issued before kid headers were
+// introduced have no kid and are checked against the seed key.
+func (r *KeyRing) Key(ctx context.Context, kid string) (*SigningKey, error) {
+	if kid == "" {
+		kid = r.seedKey.KID
+	}
+
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+
+	// The key may have been promoted by another instance
+	if r.loadedBefore(keyRingMissReloadInterval) {
+		if err := r.Load(ctx); err != nil {
+			r.logger.Warn("Failed to reload key ring", "error", err)
+		}
+		if key, ok := r.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnknownKeyID
+}
+
+// Keys returns every key that still verifies tokens, the active key first.
+func (r *KeyRing) Keys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Rotate promotes a freshly generated key and deletes the retired keys whose
+// verification window has passed. An empty algorithm keeps the current one.
+func (r *KeyRing) Rotate(ctx context.Context, algorithm string) (*SigningKey, []string, error) {
+	if algorithm == "" {
+		active, err := r.ActiveKey(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		algorithm = active.Method.Alg()
+	}
+
+	key, err := GenerateSigningKey(uuid.New().String(), algorithm)
+	if err != nil {
+		return nil, nil, err
+	}
+	key.CreatedAt = time.Now()
+
+	if err = r.storeActiveKey(ctx, key); err != nil {
+		return nil, nil, err
+	}
+
+	deletedKIDs, err := r.repo.DeleteSigningKeysRetiredBefore(ctx, time.Now().Add(-r.retiredKeyLifetime()))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = r.Load(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	r.logger.Info("Signing key rotated", "kid", key.KID, "algorithm", algorithm, "deleted_kids", deletedKIDs)
+	return key, deletedKIDs, nil
+}
+
+func (r *KeyRing) storeActiveKey(ctx context.Context, key *SigningKey) error {
+	createdAt := key.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	sealedMaterial, err := r.box.Seal([]byte(key.material))
+	if err != nil {
+		return err
+	}
+
+	return r.repo.StoreActiveSigningKey(ctx, repository.SigningKeyData{
+		KID:         key.KID,
+		Algorithm:   key.Method.Alg(),
+		KeyMaterial: sealedMaterial,
+		Encrypted:   true,
+		CreatedAt:   createdAt,
+	})
+}
+
+// openKeyMaterial decrypts the key material. Keys stored in plaintext before
+// encryption was introduced are sealed in place.
+func (r *KeyRing) openKeyMaterial(ctx context.Context, keyData repository.SigningKeyData) (string, error) {
+	if keyData.Encrypted {
+		material, err := r.box.Open(keyData.KeyMaterial)
+		return string(material), err
+	}
+
+	sealedMaterial, err := r.box.Seal([]byte(keyData.KeyMaterial))
+	if err == nil {
+		err = r.repo.EncryptSigningKey(ctx, keyData.KID, sealedMaterial)
+	}
+	if err != nil {
+		r.logger.Warn("Failed to encrypt plaintext signing key", "error", err, "kid", keyData.KID)
+	}
+	return keyData.KeyMaterial, nil
+}
+
+// retiredKeyLifetime also covers instances that keep signing with a retired key
+// until their next reload.
+func (r *KeyRing) retiredKeyLifetime() time.Duration {
+	return r.verifyWindow + keyRingReloadInterval
+}
+
+func (r *KeyRing) lookup(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+func (r *KeyRing) loadedBefore(interval time.Duration) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return time.Since(r.loadedAt) > interval
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPSettings configure the search and bind of LDAPAuthenticator.
+type LDAPSettings struct {
+	URL      string
+	StartTLS bool
+	// BindDN and BindPassword of the service account that searches users,
+	// anonymous search is used when BindDN is empty
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter with the "{login}" placeholder, e.g. (|(uid={login})(mail={login}))
+	UserFilter string
+	// SubjectAttribute holds the stable id of the entry that is linked to the local user
+	SubjectAttribute string
+	Timeout          time.Duration
+}
+
+// ldapConnection is the part of *ldap.Conn the authenticator uses.
+type ldapConnection interface {
+	Bind(username, password string) error
+	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// externalUserResolver links entries of external stores to local users.
+type externalUserResolver interface {
+	ResolveExternalUser(ctx context.Context, provider, subject string) (string, error)
+}
+
+// LDAPAuthenticator finds the entry of the login with a service account and
+// checks the password by binding as that entry. Users are created locally on
+// their first login.
+type LDAPAuthenticator struct {
+	settings LDAPSettings
+	users    externalUserResolver
+	logger   *slog.Logger
+	dial     func() (ldapConnection, error)
+}
+
+func NewLDAPAuthenticator(settings LDAPSettings, users *UserService, logger *slog.Logger) *LDAPAuthenticator {
+	a := &LDAPAuthenticator{settings: settings, users: users, logger: logger}
+	a.dial = a.dialURL
+	return a
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, login, password string) (string, error) {
+	// An empty password is an unauthenticated bind, which servers accept for any DN
+	if login == "" || password == "" || len(password) > maxPasswordLength {
+		return "", ErrInvalidCredentials
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if a.settings.BindDN != "" {
+		if err = conn.Bind(a.settings.BindDN, a.settings.BindPassword); err != nil {
+			return "", err
+		}
+	}
+
+	filter := strings.ReplaceAll(a.settings.UserFilter, "{login}", ldap.EscapeFilter(login))
+	// Two entries are enough to tell that the login is ambiguous
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.settings.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.settings.Timeout.Seconds()), false,
+		filter,
+		[]string{a.settings.SubjectAttribute},
+		nil,
+	))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		a.logger.Warn("LDAP login matches several entries", "login", login)
+		return "", ErrInvalidCredentials
+	} else if err != nil {
+		return "", err
+	}
+	if len(result.Entries) != 1 {
+		a.logger.Info("LDAP login failed, unknown user", "login", login, "entries", len(result.Entries))
+		return "", ErrInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+	subject := entry.GetAttributeValue(a.settings.SubjectAttribute)
+	if subject == "" {
+		a.logger.Error("LDAP entry has no subject attribute", "dn", entry.DN, "attribute", a.settings.SubjectAttribute)
+		return "", ErrInvalidCredentials
+	}
+
+	if err = conn.Bind(entry.DN, password); ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		a.logger.Info("LDAP login failed, wrong password", "dn", entry.DN)
+		return "", ErrInvalidCredentials
+	} else if err != nil {
+		return "", err
+	}
+
+	return a.users.ResolveExternalUser(ctx, a.Name(), subject)
+}
+
+func (a *LDAPAuthenticator) dialURL() (ldapConnection, error) {
+	conn, err := ldap.DialURL(a.settings.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.settings.Timeout}))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(a.settings.Timeout)
+
+	if a.settings.StartTLS {
+		serverURL, err := url.Parse(a.settings.URL)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err = conn.StartTLS(&tls.Config{ServerName: serverURL.Hostname(), MinVersion: tls.VersionTLS12}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+
+	return conn, nil
+}
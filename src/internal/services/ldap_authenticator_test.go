@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapEntry is an entry of the in-process directory.
+type ldapEntry struct {
+	dn       string
+	uid      string
+	password string
+	subject  string
+}
+
+// ldapStandIn is an in-process directory that answers the binds and searches
+// of LDAPAuthenticator like a server would.
+type ldapStandIn struct {
+	serviceDN       string
+	servicePassword string
+	entries         []ldapEntry
+	closed          bool
+}
+
+func (d *ldapStandIn) Bind(username, password string) error {
+	if username == d.serviceDN && password == d.servicePassword {
+		return nil
+	}
+	for _, entry := range d.entries {
+		if entry.dn == username && entry.password == password {
+			return nil
+		}
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *ldapStandIn) Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		if searchRequest.Filter != "(uid="+ldap.EscapeFilter(entry.uid)+")" {
+			continue
+		}
+		result.Entries = append(result.Entries, ldap.NewEntry(entry.dn, map[string][]string{
+			"entryUUID": {entry.subject},
+		}))
+	}
+	if searchRequest.SizeLimit > 0 && len(result.Entries) > searchRequest.SizeLimit {
+		return nil, ldap.NewError(ldap.LDAPResultSizeLimitExceeded, errors.New("size limit exceeded"))
+	}
+	return result, nil
+}
+
+func (d *ldapStandIn) Close() error {
+	d.closed = true
+	return nil
+}
+
+// subjectResolver maps subjects to user ids without a database.
+type subjectResolver map[string]string
+
+func (r subjectResolver) ResolveExternalUser(_ context.Context, provider, subject string) (string, error) {
+	if provider != "ldap" {
+		return "", errors.New("unexpected provider " + provider)
+	}
+	return r[subject], nil
+}
+
+func newTestLDAPAuthenticator(directory *ldapStandIn) *LDAPAuthenticator {
+	authenticator := NewLDAPAuthenticator(LDAPSettings{
+		URL:              "ldap://directory.test",
+		BindDN:           "cn=search,dc=example,dc=com",
+		BindPassword:     "search-secret",
+		BaseDN:           "ou=people,dc=example,dc=com",
+		UserFilter:       "(uid={login})",
+		SubjectAttribute: "entryUUID",
+		Timeout:          time.Second,
+	}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	authenticator.users = subjectResolver{"7c0e1f5a-2b4d-4c1e-9f3a-5d6b7c8d9e0f": "user-1"}
+	authenticator.dial = func() (ldapConnection, error) {
+		return directory, nil
+	}
+	return authenticator
+}
+
+func TestLDAPAuthenticator(t *testing.T) {
+	directory := &ldapStandIn{
+		serviceDN:       "cn=search,dc=example,dc=com",
+		servicePassword: "search-secret",
+		entries: []ldapEntry{{
+			dn:       "uid=jdoe,ou=people,dc=example,dc=com",
+			uid:      "jdoe",
+			password: "correct horse battery staple",
+			subject:  "7c0e1f5a-2b4d-4c1e-9f3a-5d6b7c8d9e0f",
+		}},
+	}
+	authenticator := newTestLDAPAuthenticator(directory)
+
+	t.Run("bind succeeds", func(t *testing.T) {
+		userID, err := authenticator.Authenticate(context.Background(), "jdoe", "correct horse battery staple")
+		if err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		if userID != "user-1" {
+			t.Errorf("userID = %q, want user-1", userID)
+		}
+		if !directory.closed {
+			t.Error("connection was not closed")
+		}
+	})
+
+	for name, credentials := range map[string][2]string{
+		"wrong password":  {"jdoe", "wrong"},
+		"unknown login":   {"jsmith", "correct horse battery staple"},
+		"empty password":  {"jdoe", ""},
+		"filter injected": {"*", "correct horse battery staple"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := authenticator.Authenticate(context.Background(), credentials[0], credentials[1])
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("err = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+
+	t.Run("service account rejected", func(t *testing.T) {
+		misconfigured := newTestLDAPAuthenticator(directory)
+		misconfigured.settings.BindPassword = "stale"
+		_, err := misconfigured.Authenticate(context.Background(), "jdoe", "correct horse battery staple")
+		if err == nil || errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("err = %v, want a failure of the store", err)
+		}
+	})
+}
+
+func TestLDAPAuthenticatorUnreachableServer(t *testing.T) {
+	// A port that was just free refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	authenticator := NewLDAPAuthenticator(LDAPSettings{
+		URL:              "ldap://" + address,
+		BaseDN:           "dc=example,dc=com",
+		UserFilter:       "(uid={login})",
+		SubjectAttribute: "entryUUID",
+		Timeout:          time.Second,
+	}, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	_, err = authenticator.Authenticate(context.Background(), "jdoe", "correct horse battery staple")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("err = %v, want a connection error", err)
+	}
+
+	// The chain reports the outage instead of a wrong password
+	chain := NewAuthenticatorChain(slog.New(slog.NewTextHandler(io.Discard, nil)), authenticator)
+	if _, err = chain.Authenticate(context.Background(), "jdoe", "pw"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("chain err = %v, want a connection error", err)
+	}
+}
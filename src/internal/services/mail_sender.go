@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Mail is a plain text message.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// MailSender delivers outbound mail.
+type MailSender interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// SMTPSettings configure SMTPMailSender.
+type SMTPSettings struct {
+	Host string
+	Port int
+	// Username and Password enable PLAIN auth, which is only sent over TLS
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+// SMTPMailSender sends mail through an SMTP relay, upgrading the connection
+// with STARTTLS when the server offers it.
+type SMTPMailSender struct {
+	settings SMTPSettings
+}
+
+func NewSMTPMailSender(settings SMTPSettings) *SMTPMailSender {
+	return &SMTPMailSender{settings: settings}
+}
+
+func (s *SMTPMailSender) Send(ctx context.Context, mail Mail) error {
+	address := net.JoinHostPort(s.settings.Host, fmt.Sprint(s.settings.Port))
+	dialer := net.Dialer{Timeout: s.settings.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	if err = conn.SetDeadline(time.Now().Add(s.settings.Timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, s.settings.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.settings.Host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if s.settings.Username != "" {
+		// smtp.PlainAuth refuses to send the password over a plain connection
+		if err = client.Auth(smtp.PlainAuth("", s.settings.Username, s.settings.Password, s.settings.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(s.settings.From); err != nil {
+		return err
+	}
+	if err = client.Rcpt(mail.To); err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(formatMail(s.settings.From, mail)); err != nil {
+		writer.Close()
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// FileMailSender writes every message to an .eml file in a directory, for
+// development without a mail server.
+type FileMailSender struct {
+	dir    string
+	from   string
+	logger *slog.Logger
+}
+
+func NewFileMailSender(dir, from string, logger *slog.Logger) (*FileMailSender, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileMailSender{dir: dir, from: from, logger: logger}, nil
+}
+
+func (s *FileMailSender) Send(ctx context.Context, mail Mail) error {
+	name := fmt.Sprintf("%s_%s.eml", time.Now().UTC().Format("20060102T150405"), uuid.New().String())
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, formatMail(s.from, mail), 0o600); err != nil {
+		return err
+	}
+
+	s.logger.Info("Mail written to file", "path", path, "to", mail.To, "subject", mail.Subject)
+	return nil
+}
+
+// MemoryMailSender keeps sent messages in memory, for tests.
+type MemoryMailSender struct {
+	mu   sync.Mutex
+	sent []Mail
+}
+
+func NewMemoryMailSender() *MemoryMailSender {
+	return &MemoryMailSender{}
+}
+
+func (s *MemoryMailSender) Send(ctx context.Context, mail Mail) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, mail)
+	return nil
+}
+
+// Sent returns the messages sent so far.
+func (s *MemoryMailSender) Sent() []Mail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mail(nil), s.sent...)
+}
+
+func formatMail(from string, mail Mail) []byte {
+	var message strings.Builder
+	message.WriteString("From: " + from + "\r\n")
+	message.WriteString("To: " + mail.To + "\r\n")
+	message.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", mail.Subject) + "\r\n")
+	message.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(strings.ReplaceAll(mail.Body, "\n", "\r\n"))
+	return []byte(message.String())
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrMFARequired         = errors.New("multi-factor authentication required")
+	ErrMFAAlreadyEnabled   = errors.New("multi-factor authentication already enabled")
+	ErrMFANotEnrolled      = errors.New("multi-factor authentication not enrolled")
+	ErrInvalidMFACode      = errors.New("invalid multi-factor authentication code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired multi-factor authentication challenge")
+	ErrMFALocked           = errors.New("too many wrong multi-factor authentication codes")
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	// mfaMaxAttempts limits the codes of a user across challenges, a new
+	// challenge only takes the password
+	mfaMaxAttempts = 10
+	mfaLockout     = 15 * time.Minute
+
+	recoveryCodeCount = 10
+	// recoveryCodeAlphabet leaves out characters that are easy to confuse
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+// MFAChallenge is issued by the first login step to users with MFA enabled.
+type MFAChallenge struct {
+	Token     string
+	ExpiresAt time.Time
+}
+
+// MFAService manages TOTP second factors and their recovery codes.
+type MFAService struct {
+	repo   *repository.MFARepository
+	logger *slog.Logger
+	box    *SecretBox
+	issuer string
+}
+
+func NewMFAService(repo *repository.MFARepository, logger *slog.Logger, box *SecretBox, issuer string) *MFAService {
+	return &MFAService{repo: repo, logger: logger, box: box, issuer: issuer}
+}
+
+// Enabled reports whether the user has a confirmed TOTP.
+func (s *MFAService) Enabled(ctx context.Context, userID string) (bool, error) {
+	totpData, err := s.repo.GetTOTP(ctx, userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return totpData.ConfirmedAt.Valid, nil
+}
+
+// EnrollTOTP generates a secret that takes effect once confirmed with a code.
+// It returns the base32 secret and the otpauth:// URI.
+func (s *MFAService) EnrollTOTP(ctx context.Context, userID, accountName string) (string, string, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	secretEncrypted, err := s.box.Seal(secret)
+	if err != nil {
+		s.logger.Error("Failed to encrypt TOTP secret", "error", err)
+		return "", "", err
+	}
+
+	err = s.repo.StorePendingTOTP(ctx, userID, secretEncrypted)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return "", "", ErrMFAAlreadyEnabled
+	} else if err != nil {
+		return "", "", err
+	}
+
+	s.logger.Info("TOTP enrollment started", "userID", userID)
+	return totpSecretEncoding.EncodeToString(secret), totpURI(s.issuer, accountName, secret), nil
+}
+
+// ConfirmTOTP enables the pending secret if the code matches and returns new
+// recovery codes. The codes are stored hashed and can't be shown again.
+func (s *MFAService) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	totpData, err := s.repo.GetTOTP(ctx, userID)
+	if err == sql.ErrNoRows {
+		return nil, ErrMFANotEnrolled
+	} else if err != nil {
+		return nil, err
+	}
+	if totpData.ConfirmedAt.Valid {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	step, err := s.matchCode(totpData, code)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]string, recoveryCodeCount)
+	codeHashes := make([]string, recoveryCodeCount)
+	for i := range recoveryCodes {
+		if recoveryCodes[i], err = generateRecoveryCode(); err != nil {
+			return nil, err
+		}
+		codeHashes[i] = s.box.Digest(normalizeRecoveryCode(recoveryCodes[i]))
+	}
+
+	confirmed, err := s.repo.ConfirmTOTP(ctx, userID, step, codeHashes)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		// Confirmed by a concurrent request
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	s.logger.Info("TOTP enabled", "userID", userID)
+	return recoveryCodes, nil
+}
+
+// VerifyCode accepts a TOTP code or an unused recovery code. Every code is
+// accepted only once. After mfaMaxAttempts codes without an accepted one the
+// user is locked out for mfaLockout with ErrMFALocked.
+func (s *MFAService) VerifyCode(ctx context.Context, userID, code string) error {
+	totpData, err := s.repo.GetTOTP(ctx, userID)
+	if err == sql.ErrNoRows {
+		return ErrMFANotEnrolled
+	} else if err != nil {
+		return err
+	}
+	if !totpData.ConfirmedAt.Valid {
+		return ErrMFANotEnrolled
+	}
+
+	reserved, err := s.repo.ReserveMFAAttempt(ctx, userID, mfaMaxAttempts, mfaLockout)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		s.logger.Warn("MFA locked out", "userID", userID)
+		return ErrMFALocked
+	}
+
+	if err = s.checkCode(ctx, totpData, code); err != nil {
+		return err
+	}
+
+	return s.repo.ClearMFAAttempts(ctx, userID)
+}
+
+// checkCode accepts a TOTP code or an unused recovery code of the enrolled user.
+func (s *MFAService) checkCode(ctx context.Context, totpData repository.TOTPData, code string) error {
+	userID := totpData.UserID
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, err := s.matchCode(totpData, code)
+		if err != nil {
+			return err
+		}
+
+		used, err := s.repo.UseTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			s.logger.Warn("TOTP code replayed", "userID", userID)
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	used, err := s.repo.UseRecoveryCode(ctx, userID, s.box.Digest(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+
+	s.logger.Info("Recovery code used", "userID", userID)
+	return nil
+}
+
+// CreateChallenge issues the token that proves the first login step done with
+// authMethod.
+func (s *MFAService) CreateChallenge(ctx context.Context, userID, authMethod string) (MFAChallenge, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return MFAChallenge{}, err
+	}
+
+	challenge := MFAChallenge{Token: token, ExpiresAt: time.Now().Add(mfaChallengeTTL)}
+	if err = s.repo.StoreMFAChallenge(ctx, hashOpaqueToken(challenge.Token), userID, authMethod, challenge.ExpiresAt); err != nil {
+		return MFAChallenge{}, err
+	}
+
+	return challenge, nil
+}
+
+// CompleteChallenge checks the code of the challenged user and consumes the
+// challenge. It returns the user and the method of the first login step. A
+// challenge allows a few attempts, each is counted before the code is checked.
+func (s *MFAService) CompleteChallenge(ctx context.Context, challengeToken, code string) (userID, authMethod string, err error) {
+	challengeHash := hashOpaqueToken(challengeToken)
+	challengeData, err := s.repo.ReserveMFAChallengeAttempt(ctx, challengeHash, mfaChallengeMaxAttempts)
+	if err == sql.ErrNoRows {
+		return "", "", ErrInvalidMFAChallenge
+	} else if err != nil {
+		return "", "", err
+	}
+
+	if err = s.VerifyCode(ctx, challengeData.UserID, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.logger.Info("Wrong MFA code", "userID", challengeData.UserID, "attempt", challengeData.Attempts)
+		}
+		return "", "", err
+	}
+
+	consumed, err := s.repo.ConsumeMFAChallenge(ctx, challengeHash)
+	if err != nil {
+		return "", "", err
+	}
+	if !consumed {
+		return "", "", ErrInvalidMFAChallenge
+	}
+
+	return challengeData.UserID, challengeData.AuthMethod, nil
+}
+
+func (s *MFAService) matchCode(totpData repository.TOTPData, code string) (int64, error) {
+	secret, err := s.box.Open(totpData.SecretEncrypted)
+	if err != nil {
+		s.logger.Error("Failed to decrypt TOTP secret", "error", err, "userID", totpData.UserID)
+		return 0, err
+	}
+
+	step, ok := matchTOTPCode(secret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return 0, ErrInvalidMFACode
+	}
+	return step, nil
+}
+
+// generateRecoveryCode returns a code like "abcde-fgh23".
+func generateRecoveryCode() (string, error) {
+	randomBytes := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, 0, recoveryCodeLength+1)
+	for i, b := range randomBytes {
+		if i == recoveryCodeLength/2 {
+			code = append(code, '-')
+		}
+		// 256 isn't a multiple of the alphabet size, the bias is negligible for one-time codes
+		code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
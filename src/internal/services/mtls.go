@@ -0,0 +1,103 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+var ErrCertificateMismatch = errors.New("client certificate does not match the token")
+
+// Certificate attributes tls_client_auth clients are identified by, named
+// after their client metadata (RFC 8705, section 2.1.2).
+const (
+	TLSClientAuthSubjectDN = "tls_client_auth_subject_dn"
+	TLSClientAuthSANDNS    = "tls_client_auth_san_dns"
+	TLSClientAuthSANURI    = "tls_client_auth_san_uri"
+	TLSClientAuthSANIP     = "tls_client_auth_san_ip"
+	TLSClientAuthSANEmail  = "tls_client_auth_san_email"
+)
+
+var tlsClientAuthAttributes = []string{
+	TLSClientAuthSubjectDN, TLSClientAuthSANDNS, TLSClientAuthSANURI, TLSClientAuthSANIP, TLSClientAuthSANEmail,
+}
+
+// CertificateSubject is what the certificate of a tls_client_auth client must
+// contain: the subject DN or one of its subject alternative names.
+type CertificateSubject struct {
+	Attribute string
+	// Value of the subject DN is in the RFC 4514 form, like CN=billing,O=Example
+	Value string
+}
+
+func (s CertificateSubject) valid() bool {
+	switch s.Attribute {
+	case TLSClientAuthSANIP:
+		return net.ParseIP(s.Value) != nil
+	case TLSClientAuthSANURI:
+		parsedURL, err := url.Parse(s.Value)
+		return err == nil && parsedURL.IsAbs()
+	}
+	return slices.Contains(tlsClientAuthAttributes, s.Attribute) && strings.TrimSpace(s.Value) != ""
+}
+
+// Matches reports whether the certificate has the attribute value.
+func (s CertificateSubject) Matches(certificate *x509.Certificate) bool {
+	switch s.Attribute {
+	case TLSClientAuthSubjectDN:
+		return certificate.Subject.String() == s.Value
+	case TLSClientAuthSANDNS:
+		return slices.ContainsFunc(certificate.DNSNames, func(name string) bool {
+			return strings.EqualFold(name, s.Value)
+		})
+	case TLSClientAuthSANURI:
+		return slices.ContainsFunc(certificate.URIs, func(uri *url.URL) bool {
+			return uri.String() == s.Value
+		})
+	case TLSClientAuthSANIP:
+		ip := net.ParseIP(s.Value)
+		return ip != nil && slices.ContainsFunc(certificate.IPAddresses, ip.Equal)
+	case TLSClientAuthSANEmail:
+		return slices.Contains(certificate.EmailAddresses, s.Value)
+	}
+	return false
+}
+
+// CertificateThumbprint is the SHA-256 thumbprint of the certificate, the
+// "x5t#S256" tokens are bound to (RFC 8705, section 3.1).
+func CertificateThumbprint(certificate *x509.Certificate) string {
+	digest := sha256.Sum256(certificate.Raw)
+	return encodeBase64URL(digest[:])
+}
+
+// TokenBinding names the keys issued tokens are sender-constrained to, empty
+// fields leave them unbound.
+type TokenBinding struct {
+	// DPoPJKT is the thumbprint of the DPoP key of the client (RFC 9449)
+	DPoPJKT string
+	// CertThumbprint is the thumbprint of the TLS client certificate (RFC 8705)
+	CertThumbprint string
+	// CertBoundRefreshToken binds refresh tokens to the certificate too. Public
+	// clients need it, refresh tokens of confidential clients are bound to
+	// their authentication instead (RFC 8705, section 4).
+	CertBoundRefreshToken bool
+}
+
+// confirmation is the "cnf" claim of bound access tokens, nil for unbound ones.
+func (b TokenBinding) confirmation() map[string]any {
+	confirmation := map[string]any{}
+	if b.DPoPJKT != "" {
+		confirmation["jkt"] = b.DPoPJKT
+	}
+	if b.CertThumbprint != "" {
+		confirmation["x5t#S256"] = b.CertThumbprint
+	}
+	if len(confirmation) == 0 {
+		return nil
+	}
+	return confirmation
+}
@@ -0,0 +1,581 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+// Errors of the authorization endpoint that must not be sent to the redirect URI.
+var (
+	ErrUnknownOAuthClient    = errors.New("unknown oauth client")
+	ErrInvalidRedirectURI    = errors.New("redirect uri is not registered for the client")
+	ErrOAuthClientNotFound   = errors.New("oauth client not found")
+	ErrInvalidClientMetadata = errors.New("invalid client metadata")
+)
+
+// Error codes of RFC 6749, sections 4.1.2.1 and 5.2.
+const (
+	OAuthErrorInvalidRequest          = "invalid_request"
+	OAuthErrorInvalidClient           = "invalid_client"
+	OAuthErrorInvalidGrant            = "invalid_grant"
+	OAuthErrorUnauthorizedClient      = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthErrorUnsupportedResponseType = "unsupported_response_type"
+	OAuthErrorInvalidScope            = "invalid_scope"
+	OAuthErrorAccessDenied            = "access_denied"
+	// Errors of device polling, RFC 8628, section 3.5
+	OAuthErrorAuthorizationPending = "authorization_pending"
+	OAuthErrorSlowDown             = "slow_down"
+	OAuthErrorExpiredToken         = "expired_token"
+	// OAuthErrorInvalidTarget rejects the audience of a token exchange, RFC 8693, section 2.2.2
+	OAuthErrorInvalidTarget = "invalid_target"
+	// OAuthErrorInvalidDPoPProof rejects a missing or invalid DPoP proof, RFC 9449, section 5
+	OAuthErrorInvalidDPoPProof = "invalid_dpop_proof"
+)
+
+// Grant types of the token endpoint.
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	// GrantTypeClientCredentials makes the client a service account
+	GrantTypeClientCredentials = "client_credentials"
+	// GrantTypeDeviceCode logs in devices without a browser (RFC 8628)
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+	// GrantTypeTokenExchange lets a service act on behalf of the user of a token (RFC 8693)
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+const (
+	authorizationCodeTTL = time.Minute
+	pkceMethodS256       = "S256"
+	minClientTokenTTL    = time.Minute
+)
+
+var (
+	grantTypes = []string{
+		GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials, GrantTypeDeviceCode,
+		GrantTypeTokenExchange,
+	}
+	defaultGrantTypes = []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken}
+)
+
+// pkceValuePattern is the syntax of code verifiers and S256 challenges (RFC 7636, section 4.1).
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// OAuthError is an error response defined by RFC 6749.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthClient is a registered application. Confidential clients authenticate
+// with a secret or a TLS client certificate, public clients (SPAs, mobile
+// apps) can't keep one and rely on PKCE alone.
+type OAuthClient struct {
+	ClientID     string
+	Name         string
+	Confidential bool
+	RedirectURIs []string
+	// Scopes are the scopes the client may request
+	Scopes     []string
+	GrantTypes []string
+	// AccessTokenTTL is the lifetime of client_credentials tokens, zero for the
+	// default access token TTL
+	AccessTokenTTL time.Duration
+	// TLSClientAuth is set for confidential clients that authenticate with a
+	// TLS client certificate instead of a secret (tls_client_auth, RFC 8705)
+	TLSClientAuth *CertificateSubject
+	CreatedAt     time.Time
+}
+
+// AllowsGrant reports whether the client may use the grant type.
+func (c OAuthClient) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AuthorizationRequest holds the parameters of the authorization endpoint.
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is the OpenID Connect nonce, returned in the ID token
+	Nonce string
+}
+
+// AuthorizationGrant is what the user granted with an authorization code.
+type AuthorizationGrant struct {
+	UserID         string
+	Scope          []string
+	Nonce          string
+	Authentication Authentication
+}
+
+// OAuthSettings configure OAuthService.
+type OAuthSettings struct {
+	// LoginURL is the first-party page that logs the user in and approves
+	// authorization requests
+	LoginURL string
+	// Issuer is the public URL of the service, the "iss" claim of ID tokens
+	Issuer     string
+	IDTokenTTL time.Duration
+	// MaxClientTokenTTL bounds the access token TTL of service accounts
+	MaxClientTokenTTL time.Duration
+	// DeviceVerificationURL is the page where users approve device codes
+	DeviceVerificationURL string
+	// MutualTLS is set when the server verifies TLS client certificates
+	MutualTLS bool
+}
+
+// OAuthService is the authorization server and OpenID provider: client
+// registrations, the authorization code flow with PKCE, ID tokens and user
+// info. Access and refresh tokens are issued by AuthService.
+type OAuthService struct {
+	settings OAuthSettings
+	repo     *repository.OAuthRepository
+	roles    *RoleService
+	users    *UserService
+	keyRing  *KeyRing
+	logger   *slog.Logger
+}
+
+func NewOAuthService(
+	settings OAuthSettings,
+	repo *repository.OAuthRepository,
+	roles *RoleService,
+	users *UserService,
+	keyRing *KeyRing,
+	logger *slog.Logger,
+) *OAuthService {
+	return &OAuthService{settings: settings, repo: repo, roles: roles, users: users, keyRing: keyRing, logger: logger}
+}
+
+// LoginURL is the page the authorization endpoint sends users to.
+func (s *OAuthService) LoginURL() string {
+	return s.settings.LoginURL
+}
+
+// RegisterClient stores a new client. The secret of confidential clients is
+// returned only here, the database keeps its hash.
+func (s *OAuthService) RegisterClient(ctx context.Context, client OAuthClient) (OAuthClient, string, error) {
+	client.Name = strings.TrimSpace(client.Name)
+	if client.Name == "" {
+		return OAuthClient{}, "", ErrInvalidClientMetadata
+	}
+	if client.GrantTypes == nil {
+		client.GrantTypes = defaultGrantTypes
+	}
+	for _, grantType := range client.GrantTypes {
+		if !slices.Contains(grantTypes, grantType) {
+			return OAuthClient{}, "", ErrInvalidClientMetadata
+		}
+	}
+	if client.AllowsGrant(GrantTypeAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return OAuthClient{}, "", ErrInvalidClientMetadata
+	}
+	// Only a secret authenticates a service account or a service exchanging tokens
+	if (client.AllowsGrant(GrantTypeClientCredentials) || client.AllowsGrant(GrantTypeTokenExchange)) &&
+		!client.Confidential {
+		return OAuthClient{}, "", ErrInvalidClientMetadata
+	}
+	if client.TLSClientAuth != nil && (!client.Confidential || !client.TLSClientAuth.valid()) {
+		return OAuthClient{}, "", ErrInvalidClientMetadata
+	}
+	if client.AccessTokenTTL != 0 &&
+		(client.AccessTokenTTL < minClientTokenTTL || client.AccessTokenTTL > s.settings.MaxClientTokenTTL) {
+		return OAuthClient{}, "", ErrInvalidClientMetadata
+	}
+	for _, redirectURI := range client.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			return OAuthClient{}, "", ErrInvalidClientMetadata
+		}
+	}
+	for _, scope := range client.Scopes {
+		if !permissionPattern.MatchString(scope) {
+			return OAuthClient{}, "", ErrInvalidClientMetadata
+		}
+	}
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+	if client.RedirectURIs == nil {
+		client.RedirectURIs = []string{}
+	}
+
+	client.ClientID = uuid.New().String()
+	clientData := repository.OAuthClientData{
+		ClientID:     client.ClientID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		GrantTypes:   client.GrantTypes,
+	}
+	if client.AccessTokenTTL != 0 {
+		clientData.AccessTokenTTL = sql.NullInt64{Int64: int64(client.AccessTokenTTL.Seconds()), Valid: true}
+	}
+
+	var secret string
+	if client.TLSClientAuth != nil {
+		clientData.TLSClientAuthAttribute = sql.NullString{String: client.TLSClientAuth.Attribute, Valid: true}
+		clientData.TLSClientAuthValue = sql.NullString{String: client.TLSClientAuth.Value, Valid: true}
+	} else if client.Confidential {
+		var err error
+		if secret, err = generateOpaqueToken(); err != nil {
+			return OAuthClient{}, "", err
+		}
+		clientData.ClientSecretHash = sql.NullString{String: hashOpaqueToken(secret), Valid: true}
+	}
+
+	if err := s.repo.CreateClient(ctx, clientData); err != nil {
+		return OAuthClient{}, "", err
+	}
+
+	s.logger.Info("OAuth client registered", "client_id", client.ClientID, "name", client.Name)
+	client.CreatedAt = time.Now()
+	return client, secret, nil
+}
+
+func (s *OAuthService) ListClients(ctx context.Context) ([]OAuthClient, error) {
+	clientsData, err := s.repo.ListClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := make([]OAuthClient, 0, len(clientsData))
+	for _, clientData := range clientsData {
+		clients = append(clients, oauthClientFromData(clientData))
+	}
+	return clients, nil
+}
+
+// Client returns the client, ErrOAuthClientNotFound if it doesn't exist.
+func (s *OAuthService) Client(ctx context.Context, clientID string) (OAuthClient, error) {
+	clientData, err := s.repo.GetClient(ctx, clientID)
+	if err == sql.ErrNoRows {
+		return OAuthClient{}, ErrOAuthClientNotFound
+	} else if err != nil {
+		return OAuthClient{}, err
+	}
+	return oauthClientFromData(clientData), nil
+}
+
+// DeleteClient deletes the client and ends its sessions.
+func (s *OAuthService) DeleteClient(ctx context.Context, clientID string) error {
+	deleted, err := s.repo.DeleteClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrOAuthClientNotFound
+	}
+
+	s.logger.Info("OAuth client deleted", "client_id", clientID)
+	return nil
+}
+
+// AuthenticateClient checks the credentials sent to the token endpoint. Public
+// clients send only their id, tls_client_auth clients their id over a
+// connection with their certificate, verified by the server.
+func (s *OAuthService) AuthenticateClient(
+	ctx context.Context, clientID, clientSecret string, certificate *x509.Certificate,
+) (OAuthClient, error) {
+	if clientID == "" {
+		return OAuthClient{}, newOAuthError(OAuthErrorInvalidClient, "client authentication failed")
+	}
+
+	clientData, err := s.repo.GetClient(ctx, clientID)
+	if err == sql.ErrNoRows {
+		return OAuthClient{}, newOAuthError(OAuthErrorInvalidClient, "client authentication failed")
+	} else if err != nil {
+		return OAuthClient{}, err
+	}
+
+	if clientData.TLSClientAuthAttribute.Valid {
+		subject := CertificateSubject{
+			Attribute: clientData.TLSClientAuthAttribute.String,
+			Value:     clientData.TLSClientAuthValue.String,
+		}
+		if clientSecret != "" {
+			return OAuthClient{}, newOAuthError(OAuthErrorInvalidClient, "client authenticates with a certificate")
+		}
+		if certificate == nil || !subject.Matches(certificate) {
+			s.logger.Info("OAuth client certificate mismatch", "client_id", clientID)
+			return OAuthClient{}, newOAuthError(OAuthErrorInvalidClient, "client authentication failed")
+		}
+	} else if clientData.ClientSecretHash.Valid {
+		secretHash := hashOpaqueToken(clientSecret)
+		if subtle.ConstantTimeCompare([]byte(secretHash), []byte(clientData.ClientSecretHash.String)) != 1 {
+			s.logger.Info("OAuth client secret mismatch", "client_id", clientID)
+			return OAuthClient{}, newOAuthError(OAuthErrorInvalidClient, "client authentication failed")
+		}
+	} else if clientSecret != "" {
+		return OAuthClient{}, newOAuthError(OAuthErrorInvalidClient, "public clients have no secret")
+	}
+
+	return oauthClientFromData(clientData), nil
+}
+
+// ValidateAuthorizationRequest checks the parameters of the authorization
+// endpoint and fills in the redirect URI when the client has only one.
+// ErrUnknownOAuthClient and ErrInvalidRedirectURI must be shown to the user,
+// an *OAuthError is sent to the redirect URI.
+func (s *OAuthService) ValidateAuthorizationRequest(ctx context.Context, req *AuthorizationRequest) (OAuthClient, error) {
+	clientData, err := s.repo.GetClient(ctx, req.ClientID)
+	if err == sql.ErrNoRows {
+		return OAuthClient{}, ErrUnknownOAuthClient
+	} else if err != nil {
+		return OAuthClient{}, err
+	}
+	client := oauthClientFromData(clientData)
+
+	redirectURI, ok := resolveRedirectURI(client.RedirectURIs, req.RedirectURI)
+	if !ok {
+		return OAuthClient{}, ErrInvalidRedirectURI
+	}
+	req.RedirectURI = redirectURI
+
+	if !client.AllowsGrant(GrantTypeAuthorizationCode) {
+		return OAuthClient{}, newOAuthError(OAuthErrorUnauthorizedClient, "client may not use the authorization code grant")
+	}
+	if req.ResponseType != "code" {
+		return OAuthClient{}, newOAuthError(OAuthErrorUnsupportedResponseType, "only response_type=code is supported")
+	}
+	if req.CodeChallenge == "" {
+		return OAuthClient{}, newOAuthError(OAuthErrorInvalidRequest, "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != pkceMethodS256 {
+		return OAuthClient{}, newOAuthError(OAuthErrorInvalidRequest, "code_challenge_method must be S256")
+	}
+	if !pkceValuePattern.MatchString(req.CodeChallenge) {
+		return OAuthClient{}, newOAuthError(OAuthErrorInvalidRequest, "code_challenge is malformed")
+	}
+	if err := s.checkRequestedScope(ctx, client, req.Scope); err != nil {
+		return OAuthClient{}, err
+	}
+
+	return client, nil
+}
+
+// checkRequestedScope accepts scopes of the client and OpenID Connect scopes.
+// The openid scope needs a signing key clients can verify ID tokens with.
+func (s *OAuthService) checkRequestedScope(ctx context.Context, client OAuthClient, scope string) error {
+	for _, requested := range strings.Fields(scope) {
+		if !slices.Contains(client.Scopes, requested) && !IsIdentityScope(requested) {
+			return newOAuthError(OAuthErrorInvalidScope, "scope "+requested+" is not allowed for the client")
+		}
+	}
+	if slices.Contains(strings.Fields(scope), ScopeOpenID) {
+		signingKey, err := s.keyRing.ActiveKey(ctx)
+		if err != nil {
+			return err
+		}
+		if isHMACAlgorithm(signingKey.Method.Alg()) {
+			return newOAuthError(OAuthErrorInvalidScope, "ID tokens need an asymmetric signing key")
+		}
+	}
+	return nil
+}
+
+// Authorize issues an authorization code to the client on behalf of the
+// logged in user. The code carries the requested scope the user has
+// permissions for and the authentication of the user's session.
+func (s *OAuthService) Authorize(
+	ctx context.Context, userID string, authentication Authentication, req *AuthorizationRequest,
+) (string, error) {
+	// Checked before the redirect URI of a single URI client is filled in
+	redirectURIRequested := req.RedirectURI != ""
+	client, err := s.ValidateAuthorizationRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	scope, err := s.grantableScope(ctx, userID, req.Scope)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.StoreAuthorizationCode(ctx, repository.AuthorizationCodeData{
+		CodeHash:             hashOpaqueToken(code),
+		ClientID:             client.ClientID,
+		UserID:               userID,
+		RedirectURI:          req.RedirectURI,
+		RedirectURIRequested: redirectURIRequested,
+		Scope:                strings.Join(scope, " "),
+		CodeChallenge:        req.CodeChallenge,
+		ExpiresAt:            time.Now().Add(authorizationCodeTTL),
+		Nonce:                sql.NullString{String: req.Nonce, Valid: req.Nonce != ""},
+		AuthTime:             authentication.Time,
+		AuthMethods:          authentication.Methods,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("Authorization code issued", "userID", userID, "client_id", client.ClientID, "scope", scope)
+	return code, nil
+}
+
+// grantableScope narrows the requested scope to the permissions of the user
+// and OpenID Connect scopes.
+func (s *OAuthService) grantableScope(ctx context.Context, userID, scope string) ([]string, error) {
+	_, permissions, err := s.roles.UserGrants(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(strings.Fields(scope), func(scope string) bool {
+		return !slices.Contains(permissions, scope) && !IsIdentityScope(scope)
+	}), nil
+}
+
+// ExchangeAuthorizationCode consumes the code of the authenticated client and
+// returns what the user granted with it.
+func (s *OAuthService) ExchangeAuthorizationCode(
+	ctx context.Context, client OAuthClient, code, redirectURI, codeVerifier string,
+) (AuthorizationGrant, error) {
+	if code == "" || codeVerifier == "" {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidRequest, "code and code_verifier are required")
+	}
+
+	codeData, err := s.repo.ConsumeAuthorizationCode(ctx, hashOpaqueToken(code))
+	if err == sql.ErrNoRows {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "authorization code is invalid, expired or used")
+	} else if err != nil {
+		return AuthorizationGrant{}, err
+	}
+
+	if codeData.ClientID != client.ClientID {
+		s.logger.Warn("Authorization code presented by another client", "client_id", client.ClientID, "code_client_id", codeData.ClientID)
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "authorization code was issued to another client")
+	}
+	// redirect_uri must repeat the one of the authorization request and may
+	// be left out only if that request had none (RFC 6749, section 4.1.3)
+	if (redirectURI != "" || codeData.RedirectURIRequested) && redirectURI != codeData.RedirectURI {
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !verifyPKCE(codeVerifier, codeData.CodeChallenge) {
+		s.logger.Info("PKCE verification failed", "client_id", client.ClientID, "userID", codeData.UserID)
+		return AuthorizationGrant{}, newOAuthError(OAuthErrorInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	return AuthorizationGrant{
+		UserID: codeData.UserID,
+		Scope:  strings.Fields(codeData.Scope),
+		Nonce:  codeData.Nonce.String,
+		Authentication: Authentication{
+			Time:    codeData.AuthTime,
+			Methods: codeData.AuthMethods,
+		},
+	}, nil
+}
+
+// ClientCredentialsScope checks the client_credentials request of a service
+// account and returns the scope of its token: the requested scope or, if none
+// is requested, every scope of the client.
+func (s *OAuthService) ClientCredentialsScope(client OAuthClient, scope string) ([]string, error) {
+	if !client.AllowsGrant(GrantTypeClientCredentials) {
+		return nil, newOAuthError(OAuthErrorUnauthorizedClient, "client may not use the client credentials grant")
+	}
+
+	requestedScope := strings.Fields(scope)
+	if len(requestedScope) == 0 {
+		return client.Scopes, nil
+	}
+	for _, requested := range requestedScope {
+		if !slices.Contains(client.Scopes, requested) {
+			return nil, newOAuthError(OAuthErrorInvalidScope, "scope "+requested+" is not allowed for the client")
+		}
+	}
+	return requestedScope, nil
+}
+
+// verifyPKCE checks the verifier against an S256 challenge (RFC 7636, section 4.6).
+func verifyPKCE(codeVerifier, codeChallenge string) bool {
+	if !pkceValuePattern.MatchString(codeVerifier) {
+		return false
+	}
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
+
+// resolveRedirectURI returns the registered URI the request redirects to: the
+// requested one on an exact match, no prefixes or wildcards, or the only
+// registered URI if none is requested.
+func resolveRedirectURI(registered []string, requested string) (string, bool) {
+	if requested == "" && len(registered) == 1 {
+		return registered[0], true
+	}
+	return requested, slices.Contains(registered, requested)
+}
+
+// isValidRedirectURI accepts https URIs, http only on loopback and private-use
+// schemes of native apps like com.example.app:/callback (RFC 8252, section 7).
+func isValidRedirectURI(redirectURI string) bool {
+	parsedURI, err := url.Parse(redirectURI)
+	if err != nil || !parsedURI.IsAbs() || parsedURI.Fragment != "" {
+		return false
+	}
+
+	switch parsedURI.Scheme {
+	case "https":
+		return parsedURI.Host != ""
+	case "http":
+		switch parsedURI.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return true
+		}
+		return false
+	default:
+		return strings.Contains(parsedURI.Scheme, ".")
+	}
+}
+
+func oauthClientFromData(clientData repository.OAuthClientData) OAuthClient {
+	client := OAuthClient{
+		ClientID:       clientData.ClientID,
+		Name:           clientData.Name,
+		Confidential:   clientData.ClientSecretHash.Valid || clientData.TLSClientAuthAttribute.Valid,
+		RedirectURIs:   clientData.RedirectURIs,
+		Scopes:         clientData.Scopes,
+		GrantTypes:     clientData.GrantTypes,
+		AccessTokenTTL: time.Duration(clientData.AccessTokenTTL.Int64) * time.Second,
+		CreatedAt:      clientData.CreatedAt,
+	}
+	if clientData.TLSClientAuthAttribute.Valid {
+		client.TLSClientAuth = &CertificateSubject{
+			Attribute: clientData.TLSClientAuthAttribute.String,
+			Value:     clientData.TLSClientAuthValue.String,
+		}
+	}
+	return client
+}
@@ -0,0 +1,71 @@
+package services
+
+import "testing"
+
+func TestVerifyPKCE(t *testing.T) {
+	// RFC 7636, appendix B
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name          string
+		codeVerifier  string
+		codeChallenge string
+		want          bool
+	}{
+		{name: "RFC 7636 example", codeVerifier: verifier, codeChallenge: challenge, want: true},
+		{name: "other verifier", codeVerifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXl", codeChallenge: challenge},
+		{name: "plain method", codeVerifier: verifier, codeChallenge: verifier},
+		{name: "padded challenge", codeVerifier: verifier, codeChallenge: challenge + "="},
+		{name: "short verifier", codeVerifier: verifier[:42], codeChallenge: challenge},
+		{name: "verifier with invalid characters", codeVerifier: verifier[:42] + "+", codeChallenge: challenge},
+		{name: "empty challenge", codeVerifier: verifier},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := verifyPKCE(tc.codeVerifier, tc.codeChallenge); got != tc.want {
+				t.Errorf("verifyPKCE = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveRedirectURI(t *testing.T) {
+	registered := []string{"https://app.example.com/callback", "com.example.app:/oauth"}
+
+	tests := []struct {
+		name       string
+		registered []string
+		requested  string
+		want       string
+		wantOK     bool
+	}{
+		{name: "exact match", registered: registered, requested: "https://app.example.com/callback",
+			want: "https://app.example.com/callback", wantOK: true},
+		{name: "private-use scheme", registered: registered, requested: "com.example.app:/oauth",
+			want: "com.example.app:/oauth", wantOK: true},
+		{name: "only registered URI", registered: registered[:1], requested: "",
+			want: "https://app.example.com/callback", wantOK: true},
+		{name: "none requested of several", registered: registered, requested: ""},
+		{name: "other host", registered: registered, requested: "https://evil.example.com/callback"},
+		{name: "prefix of registered", registered: registered, requested: "https://app.example.com/call"},
+		{name: "extended path", registered: registered, requested: "https://app.example.com/callback/evil"},
+		{name: "added query", registered: registered, requested: "https://app.example.com/callback?next=evil"},
+		{name: "host suffix", registered: registered, requested: "https://app.example.com.evil.com/callback"},
+		{name: "trailing slash", registered: registered, requested: "https://app.example.com/callback/"},
+		{name: "other case", registered: registered, requested: "https://APP.example.com/callback"},
+		{name: "http instead of https", registered: registered, requested: "http://app.example.com/callback"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := resolveRedirectURI(tc.registered, tc.requested)
+			if ok != tc.wantOK || (ok && got != tc.want) {
+				t.Errorf("resolveRedirectURI(%q) = %q, %v, want %q, %v", tc.requested, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
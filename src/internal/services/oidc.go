@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OpenID Connect scopes. They give the client the identity of the user rather
+// than access to resources, so they are granted without a permission.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// Authentication context classes of the "acr" claim.
+const (
+	ACRSingleFactor = "1"
+	ACRMultiFactor  = "2"
+)
+
+var identityScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail}
+
+// IsIdentityScope reports whether the scope is an OpenID Connect scope.
+func IsIdentityScope(scope string) bool {
+	return slices.Contains(identityScopes, scope)
+}
+
+// ACR is the authentication context class of the login.
+func (a Authentication) ACR() string {
+	if slices.Contains(a.Methods, AuthMethodMFA) {
+		return ACRMultiFactor
+	}
+	return ACRSingleFactor
+}
+
+// OpenIDConfiguration is the document served on /.well-known/openid-configuration
+// (OpenID Connect Discovery 1.0, section 3).
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer" example:"http://localhost:8000"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint" example:"http://localhost:8000/oauth/authorize"`
+	TokenEndpoint                     string   `json:"token_endpoint" example:"http://localhost:8000/oauth/token"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint" example:"http://localhost:8000/oauth/device_authorization"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint" example:"http://localhost:8000/userinfo"`
+	JWKSURI                           string   `json:"jwks_uri" example:"http://localhost:8000/.well-known/jwks.json"`
+	ScopesSupported                   []string `json:"scopes_supported" example:"openid,profile,email"`
+	ResponseTypesSupported            []string `json:"response_types_supported" example:"code"`
+	GrantTypesSupported               []string `json:"grant_types_supported" example:"authorization_code,refresh_token,client_credentials,urn:ietf:params:oauth:grant-type:device_code"`
+	SubjectTypesSupported             []string `json:"subject_types_supported" example:"public"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported" example:"RS256"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported" example:"client_secret_basic,client_secret_post,none"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported" example:"S256"`
+	ClaimsSupported                   []string `json:"claims_supported" example:"sub,email,email_verified,preferred_username"`
+	ACRValuesSupported                []string `json:"acr_values_supported" example:"1,2"`
+	DPoPSigningAlgValuesSupported     []string `json:"dpop_signing_alg_values_supported" example:"ES256,RS256,EdDSA"`
+	// TLSClientCertificateBoundAccessTokens is set when tokens are bound to client certificates (RFC 8705, section 3.3)
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty" example:"true"`
+}
+
+// UserInfo holds the claims of the user the granted scope allows.
+type UserInfo struct {
+	Subject string
+	// Username is set for the profile scope
+	Username string
+	// Email and EmailVerified are set for the email scope
+	Email         string
+	EmailVerified *bool
+}
+
+// OpenIDConfiguration describes the provider. ID tokens are signed with the
+// active signing key.
+func (s *OAuthService) OpenIDConfiguration(ctx context.Context) (OpenIDConfiguration, error) {
+	signingKey, err := s.keyRing.ActiveKey(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get active signing key", "error", err)
+		return OpenIDConfiguration{}, err
+	}
+
+	authMethods := []string{"client_secret_basic", "client_secret_post", "none"}
+	if s.settings.MutualTLS {
+		authMethods = append(authMethods, "tls_client_auth")
+	}
+
+	issuer := strings.TrimSuffix(s.settings.Issuer, "/")
+	return OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   identityScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingKey.Method.Alg()},
+		TokenEndpointAuthMethodsSupported: authMethods,
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "acr", "azp",
+			"preferred_username", "email", "email_verified",
+		},
+		ACRValuesSupported:                    []string{ACRSingleFactor, ACRMultiFactor},
+		DPoPSigningAlgValuesSupported:         DPoPSigningAlgorithms,
+		TLSClientCertificateBoundAccessTokens: s.settings.MutualTLS,
+	}, nil
+}
+
+// IDToken issues the ID token of the client session (OpenID Connect Core 1.0,
+// section 2). The nonce is empty for refreshed sessions.
+func (s *OAuthService) IDToken(ctx context.Context, clientID string, tokens ClientTokens, nonce string) (string, error) {
+	signingKey, err := s.keyRing.ActiveKey(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get active signing key", "error", err)
+		return "", err
+	}
+	if isHMACAlgorithm(signingKey.Method.Alg()) {
+		// Clients can't verify tokens signed with our secret
+		return "", ErrUnsupportedAlgorithm
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       strings.TrimSuffix(s.settings.Issuer, "/"),
+		"sub":       tokens.UserID,
+		"aud":       clientID,
+		"azp":       clientID,
+		"exp":       now.Add(s.settings.IDTokenTTL).Unix(),
+		"iat":       now.Unix(),
+		"auth_time": tokens.Authentication.Time.Unix(),
+		"acr":       tokens.Authentication.ACR(),
+	}
+	if len(tokens.Authentication.Methods) > 0 {
+		claims["amr"] = tokens.Authentication.Methods
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	idToken, err := signingKey.Sign(claims)
+	if err != nil {
+		s.logger.Error("Failed to sign ID token", "error", err)
+		return "", err
+	}
+	return idToken, nil
+}
+
+// UserInfo returns the claims of the user for an access token with the scope.
+func (s *OAuthService) UserInfo(ctx context.Context, userID string, scope []string) (UserInfo, error) {
+	profile, err := s.users.Profile(ctx, userID)
+	if err != nil {
+		return UserInfo{}, err
+	}
+
+	userInfo := UserInfo{Subject: profile.UserID}
+	if slices.Contains(scope, ScopeProfile) {
+		userInfo.Username = profile.Username
+	}
+	if slices.Contains(scope, ScopeEmail) && profile.Email != "" {
+		userInfo.Email = profile.Email
+		userInfo.EmailVerified = &profile.EmailVerified
+	}
+	return userInfo, nil
+}
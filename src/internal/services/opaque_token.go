@@ -0,0 +1,27 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// opaqueTokenSize is the entropy of single-use tokens sent to users.
+const opaqueTokenSize = 32
+
+// generateOpaqueToken returns a random base64url token.
+func generateOpaqueToken() (string, error) {
+	tokenBytes := make([]byte, opaqueTokenSize)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// hashOpaqueToken hashes the token before it touches the database. The token is
+// random enough for a plain SHA-256.
+func hashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// refreshTokenTable is an in-memory refreshTokenStore.
+type refreshTokenTable struct {
+	tokens []repository.TokenData
+}
+
+func (s *refreshTokenTable) GetRefreshTokenByJTI(_ context.Context, jti string) (repository.TokenData, error) {
+	for _, token := range s.tokens {
+		if token.JTI == jti {
+			return token, nil
+		}
+	}
+	return repository.TokenData{}, sql.ErrNoRows
+}
+
+func (s *refreshTokenTable) GetLegacyRefreshUserTokens(_ context.Context, userID string) ([]repository.TokenData, error) {
+	var tokens []repository.TokenData
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// storedRefreshToken returns the row the verifier is stored as.
+func storedRefreshToken(t *testing.T, jti, userID string, verifier []byte) repository.TokenData {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword(verifier, bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword: %v", err)
+	}
+	return repository.TokenData{JTI: jti, UserID: userID, TokenHash: string(hash)}
+}
+
+func TestFindRefreshToken(t *testing.T) {
+	const (
+		jti       = "0f8fad5b-d9cb-469f-a165-70867728950e"
+		legacyJTI = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+		userID    = "user-1"
+	)
+	verifier := bytes.Repeat([]byte{0x42}, refreshVerifierSize)
+	legacyVerifier := bytes.Repeat([]byte{0x17}, refreshVerifierSize)
+
+	service := &AuthService{
+		refreshTokens: &refreshTokenTable{tokens: []repository.TokenData{
+			storedRefreshToken(t, jti, userID, verifier),
+			storedRefreshToken(t, legacyJTI, userID, legacyVerifier),
+		}},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	refreshToken, err := encodeRefreshToken(jti, verifier)
+	if err != nil {
+		t.Fatalf("encodeRefreshToken: %v", err)
+	}
+	wrongVerifier, err := encodeRefreshToken(jti, bytes.Repeat([]byte{0x43}, refreshVerifierSize))
+	if err != nil {
+		t.Fatalf("encodeRefreshToken: %v", err)
+	}
+	unknownSelector, err := encodeRefreshToken("9b2c3a44-1d2e-4f5a-8b6c-7d8e9f0a1b2c", verifier)
+	if err != nil {
+		t.Fatalf("encodeRefreshToken: %v", err)
+	}
+	legacyToken := base64.RawStdEncoding.EncodeToString(legacyVerifier)
+
+	corrupted := []byte(refreshToken)
+	corrupted[len(corrupted)/2] = '*'
+
+	tests := []struct {
+		name         string
+		refreshToken string
+		userID       string
+		wantJTI      string
+		wantErr      error
+	}{
+		{name: "selector and verifier", refreshToken: refreshToken, userID: userID, wantJTI: jti},
+		{name: "selector without user", refreshToken: refreshToken, wantJTI: jti},
+		{name: "legacy token", refreshToken: legacyToken, userID: userID, wantJTI: legacyJTI},
+		{name: "legacy token without user", refreshToken: legacyToken, wantErr: ErrTokenNotFound},
+		{name: "wrong verifier", refreshToken: wrongVerifier, userID: userID, wantErr: ErrTokenNotFound},
+		{name: "unknown selector", refreshToken: unknownSelector, userID: userID, wantErr: ErrTokenNotFound},
+		{name: "another user", refreshToken: refreshToken, userID: "user-2", wantErr: ErrTokenNotFound},
+		{name: "truncated", refreshToken: refreshToken[:len(refreshToken)-4], userID: userID, wantErr: ErrInvalidToken},
+		{name: "corrupted", refreshToken: string(corrupted), userID: userID, wantErr: ErrInvalidToken},
+		{name: "padded", refreshToken: base64.StdEncoding.EncodeToString(legacyVerifier), userID: userID, wantErr: ErrInvalidToken},
+		{name: "empty", refreshToken: "", userID: userID, wantErr: ErrInvalidToken},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenData, err := service.findRefreshToken(context.Background(), tc.refreshToken, tc.userID)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Errorf("err = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findRefreshToken: %v", err)
+			}
+			if tokenData.JTI != tc.wantJTI {
+				t.Errorf("jti = %q, want %q", tokenData.JTI, tc.wantJTI)
+			}
+		})
+	}
+}
+
+func TestDecodeRefreshToken(t *testing.T) {
+	const jti = "0f8fad5b-d9cb-469f-a165-70867728950e"
+	verifier := bytes.Repeat([]byte{0x42}, refreshVerifierSize)
+
+	refreshToken, err := encodeRefreshToken(jti, verifier)
+	if err != nil {
+		t.Fatalf("encodeRefreshToken: %v", err)
+	}
+
+	decodedJTI, decodedVerifier, err := decodeRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("decodeRefreshToken: %v", err)
+	}
+	if decodedJTI != jti {
+		t.Errorf("jti = %q, want %q", decodedJTI, jti)
+	}
+	if !bytes.Equal(decodedVerifier, verifier) {
+		t.Errorf("verifier = %x, want %x", decodedVerifier, verifier)
+	}
+
+	decodedJTI, decodedVerifier, err = decodeRefreshToken(base64.RawStdEncoding.EncodeToString(verifier))
+	if err != nil {
+		t.Fatalf("decodeRefreshToken legacy: %v", err)
+	}
+	if decodedJTI != "" || !bytes.Equal(decodedVerifier, verifier) {
+		t.Errorf("legacy = %q %x, want empty jti and the verifier", decodedJTI, decodedVerifier)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+// RevokeTokenPair revokes the access or refresh token issued to the client
+// together with the other half of its pair (RFC 7009). First-party tokens are
+// revoked with an empty clientID. The hint only decides which token type is
+// tried first. Unknown, expired or already revoked tokens and tokens of other
+// clients are not an error, they are left as they are (RFC 7009, section 2.2).
+func (s *AuthService) RevokeTokenPair(ctx context.Context, clientID, token, tokenTypeHint string) error {
+	if tokenTypeHint == TokenTypeHintRefreshToken {
+		revoked, err := s.revokeRefreshTokenPair(ctx, clientID, token)
+		if err != nil || revoked {
+			return err
+		}
+		_, err = s.revokeAccessTokenPair(ctx, clientID, token)
+		return err
+	}
+
+	revoked, err := s.revokeAccessTokenPair(ctx, clientID, token)
+	if err != nil || revoked {
+		return err
+	}
+	_, err = s.revokeRefreshTokenPair(ctx, clientID, token)
+	return err
+}
+
+func (s *AuthService) revokeAccessTokenPair(ctx context.Context, clientID, accessToken string) (bool, error) {
+	claims, err := s.ParseAccessToken(ctx, accessToken)
+	if err != nil {
+		s.logger.Debug("Revoked token is not an active access token", "error", err)
+		return false, nil
+	}
+	if claims.ClientID != clientID {
+		s.logger.Warn("Attempt to revoke access token of another client", "client_id", clientID, "jti", claims.JTI)
+		return false, nil
+	}
+
+	if err = s.BlockToken(ctx, claims.JTI, claims.ExpiresAt); err != nil {
+		return false, err
+	}
+	if err = s.revokeRefreshTokenByJTI(ctx, claims.JTI); err != nil {
+		return false, err
+	}
+
+	s.logger.Info("Access token pair revoked", "userID", claims.UserID, "client_id", clientID, "jti", claims.JTI)
+	return true, nil
+}
+
+func (s *AuthService) revokeRefreshTokenPair(ctx context.Context, clientID, refreshToken string) (bool, error) {
+	tokenData, err := s.findRefreshToken(ctx, refreshToken, "")
+	if errors.Is(err, ErrTokenNotFound) || errors.Is(err, ErrInvalidToken) {
+		s.logger.Debug("Revoked token is not a refresh token", "client_id", clientID)
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if tokenData.ClientID.String != clientID {
+		s.logger.Warn("Attempt to revoke refresh token of another client", "client_id", clientID, "jti", tokenData.JTI)
+		return false, nil
+	}
+	if tokenData.UsedAt.Valid {
+		s.logger.Debug("Revoked refresh token is already used", "client_id", clientID, "jti", tokenData.JTI)
+		return false, nil
+	}
+
+	if err = s.repo.RevokeToken(ctx, tokenData.TokenHash); err != nil {
+		return false, err
+	}
+
+	// The paired access token shares the jti and was issued together with the refresh token
+	accessExpiresAt := tokenData.CreatedAt.Add(s.accessExpireTime)
+	if accessExpiresAt.After(time.Now()) {
+		if err = s.BlockToken(ctx, tokenData.JTI, accessExpiresAt); err != nil {
+			return false, err
+		}
+	}
+
+	s.logger.Info("Refresh token pair revoked", "userID", tokenData.UserID, "client_id", clientID, "jti", tokenData.JTI)
+	return true, nil
+}
+
+func (s *AuthService) revokeRefreshTokenByJTI(ctx context.Context, jti string) error {
+	tokenData, err := s.repo.GetRefreshTokenByJTI(ctx, jti)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return s.repo.RevokeToken(ctx, tokenData.TokenHash)
+}
+
+// revokeTokenFamily deletes every refresh token of the session and blocks the access
+// tokens issued with them.
+func (s *AuthService) revokeTokenFamily(ctx context.Context, familyID string) (int, error) {
+	revokedTokens, err := s.repo.RevokeTokenFamily(ctx, familyID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = s.blockAccessTokensOf(ctx, revokedTokens); err != nil {
+		return 0, err
+	}
+	return len(revokedTokens), nil
+}
+
+// blockAccessTokensOf blocks the access tokens issued together with the revoked
+// refresh tokens that are not expired yet. They share the jti.
+func (s *AuthService) blockAccessTokensOf(ctx context.Context, revokedTokens []repository.TokenData) error {
+	for _, revokedToken := range revokedTokens {
+		accessExpiresAt := revokedToken.CreatedAt.Add(s.accessExpireTime)
+		if accessExpiresAt.Before(time.Now()) {
+			continue
+		}
+		if err := s.BlockToken(ctx, revokedToken.JTI, accessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
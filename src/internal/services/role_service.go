@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleNotAssigned   = errors.New("role not assigned")
+	ErrInvalidRole       = errors.New("invalid role name")
+	ErrInvalidPermission = errors.New("invalid permission name")
+)
+
+var (
+	rolePattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+	// permissionPattern keeps permissions valid scope tokens: no spaces or quotes
+	permissionPattern = regexp.MustCompile(`^[a-z][a-z0-9_.:-]{0,127}$`)
+)
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// RoleService manages roles, their permissions and the roles of users. The
+// roles and permissions of a user are put into the access tokens, so changes
+// reach the user on the next token refresh.
+type RoleService struct {
+	repo   *repository.RoleRepository
+	logger *slog.Logger
+}
+
+func NewRoleService(repo *repository.RoleRepository, logger *slog.Logger) *RoleService {
+	return &RoleService{repo: repo, logger: logger}
+}
+
+func (s *RoleService) ListRoles(ctx context.Context) ([]Role, error) {
+	rolesData, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make([]Role, 0, len(rolesData))
+	for _, roleData := range rolesData {
+		roles = append(roles, Role(roleData))
+	}
+	return roles, nil
+}
+
+// PutRole creates the role or replaces its description and permissions.
+func (s *RoleService) PutRole(ctx context.Context, role Role) error {
+	if !rolePattern.MatchString(role.Name) {
+		return ErrInvalidRole
+	}
+	for _, permission := range role.Permissions {
+		if !permissionPattern.MatchString(permission) {
+			return ErrInvalidPermission
+		}
+	}
+
+	permissions := slices.Clone(role.Permissions)
+	slices.Sort(permissions)
+	role.Permissions = slices.Compact(permissions)
+
+	if err := s.repo.PutRole(ctx, repository.RoleData(role)); err != nil {
+		return err
+	}
+
+	s.logger.Info("Role stored", "role", role.Name, "permissions", role.Permissions)
+	return nil
+}
+
+func (s *RoleService) DeleteRole(ctx context.Context, name string) error {
+	deleted, err := s.repo.DeleteRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrRoleNotFound
+	}
+
+	s.logger.Info("Role deleted", "role", name)
+	return nil
+}
+
+func (s *RoleService) UserRoles(ctx context.Context, userID string) ([]string, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+	return s.repo.GetUserRoles(ctx, userID)
+}
+
+// UserGrants returns the roles of the user and the permissions they grant.
+func (s *RoleService) UserGrants(ctx context.Context, userID string) (roles, permissions []string, err error) {
+	return s.repo.GetUserGrants(ctx, userID)
+}
+
+// AssignRole gives the role to the user, assigning it twice is not an error.
+func (s *RoleService) AssignRole(ctx context.Context, userID, role string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	assigned, err := s.repo.AssignUserRole(ctx, userID, role)
+	if errors.Is(err, repository.ErrReferenceNotFound) {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+	if !assigned {
+		return ErrRoleNotFound
+	}
+
+	s.logger.Info("Role assigned", "userID", userID, "role", role)
+	return nil
+}
+
+func (s *RoleService) UnassignRole(ctx context.Context, userID, role string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	unassigned, err := s.repo.UnassignUserRole(ctx, userID, role)
+	if err != nil {
+		return err
+	}
+	if !unassigned {
+		return ErrRoleNotAssigned
+	}
+
+	s.logger.Info("Role unassigned", "userID", userID, "role", role)
+	return nil
+}
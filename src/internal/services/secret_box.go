@@ -0,0 +1,77 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+)
+
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// SecretBox encrypts secrets stored in the database with AES-256-GCM and makes
+// keyed digests of values that are looked up but never decrypted.
+type SecretBox struct {
+	aead      cipher.AEAD
+	digestKey []byte
+}
+
+// NewSecretBox derives the encryption and digest keys from a 32 byte master key.
+func NewSecretBox(masterKey []byte) (*SecretBox, error) {
+	if len(masterKey) != 32 {
+		return nil, errors.New("secret box key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(deriveKey(masterKey, "encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead, digestKey: deriveKey(masterKey, "digest")}, nil
+}
+
+// Seal returns base64(nonce || ciphertext).
+func (b *SecretBox) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func (b *SecretBox) Open(sealed string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
+
+// Digest returns the hex HMAC-SHA256 of the value. Without the key a leaked
+// digest can't be brute forced offline.
+func (b *SecretBox) Digest(value string) string {
+	mac := hmac.New(sha256.New, b.digestKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func deriveKey(masterKey []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, masterKey)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
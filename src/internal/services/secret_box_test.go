@@ -0,0 +1,70 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newTestSecretBox(t *testing.T, keyByte byte) *SecretBox {
+	t.Helper()
+	box, err := NewSecretBox(bytes.Repeat([]byte{keyByte}, 32))
+	if err != nil {
+		t.Fatalf("NewSecretBox: %v", err)
+	}
+	return box
+}
+
+func TestSecretBox(t *testing.T) {
+	box := newTestSecretBox(t, 0x01)
+	plaintext := []byte("12345678901234567890")
+
+	sealed, err := box.Seal(plaintext)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		opened, err := box.Open(sealed)
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		if !bytes.Equal(opened, plaintext) {
+			t.Errorf("Open = %q, want %q", opened, plaintext)
+		}
+	})
+
+	t.Run("fresh nonce", func(t *testing.T) {
+		resealed, err := box.Seal(plaintext)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		if resealed == sealed {
+			t.Error("sealing twice gave the same ciphertext")
+		}
+	})
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		t.Fatalf("sealed value isn't base64: %v", err)
+	}
+	tampered := bytes.Clone(data)
+	tampered[len(tampered)-1] ^= 0x01
+
+	for name, tc := range map[string]struct {
+		box    *SecretBox
+		sealed string
+	}{
+		"tampered":   {box: box, sealed: base64.StdEncoding.EncodeToString(tampered)},
+		"truncated":  {box: box, sealed: base64.StdEncoding.EncodeToString(data[:8])},
+		"not base64": {box: box, sealed: "not base64!"},
+		"other key":  {box: newTestSecretBox(t, 0x02), sealed: sealed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tc.box.Open(tc.sealed); !errors.Is(err, ErrInvalidCiphertext) {
+				t.Errorf("err = %v, want ErrInvalidCiphertext", err)
+			}
+		})
+	}
+}
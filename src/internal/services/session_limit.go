@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var ErrSessionLimitReached = errors.New("maximum number of sessions reached")
+
+const (
+	// SessionEvictionReject rejects new logins while the user is at the limit.
+	SessionEvictionReject = "reject"
+	// SessionEvictionOldest logs out the sessions that started first.
+	SessionEvictionOldest = "evict_oldest"
+	// SessionEvictionLeastRecentlyUsed logs out the sessions refreshed longest ago.
+	SessionEvictionLeastRecentlyUsed = "evict_lru"
+)
+
+// SessionLimit caps the number of concurrent sessions (refresh token families) of a user.
+type SessionLimit struct {
+	// MaxSessions is the cap, zero means unlimited
+	MaxSessions    int
+	EvictionPolicy string
+}
+
+// NewSessionLimit validates the eviction policy.
+func NewSessionLimit(maxSessions int, evictionPolicy string) (SessionLimit, error) {
+	switch evictionPolicy {
+	case SessionEvictionReject, SessionEvictionOldest, SessionEvictionLeastRecentlyUsed:
+	default:
+		return SessionLimit{}, fmt.Errorf("unknown session eviction policy: %s", evictionPolicy)
+	}
+	if maxSessions < 0 {
+		return SessionLimit{}, fmt.Errorf("negative session limit: %d", maxSessions)
+	}
+
+	return SessionLimit{MaxSessions: maxSessions, EvictionPolicy: evictionPolicy}, nil
+}
+
+// makeRoomForSession picks the live sessions of the user to evict, so one more
+// session fits the limit, or rejects the login according to the eviction policy.
+// It runs in the transaction that stores the new session.
+func (s *AuthService) makeRoomForSession(sessions []repository.TokenData) ([]repository.TokenData, error) {
+	excess := len(sessions) - s.sessionLimit.MaxSessions + 1
+	if excess <= 0 {
+		return nil, nil
+	}
+
+	if s.sessionLimit.EvictionPolicy == SessionEvictionReject {
+		s.logger.Info("Login rejected, session limit reached", "userID", sessions[0].UserID, "sessions", len(sessions))
+		return nil, ErrSessionLimitReached
+	}
+
+	// The current token of a session was issued by its last refresh
+	sort.Slice(sessions, func(i, j int) bool {
+		if s.sessionLimit.EvictionPolicy == SessionEvictionLeastRecentlyUsed {
+			return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+		}
+		return sessions[i].AuthenticatedAt.Before(sessions[j].AuthenticatedAt)
+	})
+
+	for _, session := range sessions[:excess] {
+		s.logger.Info(
+			"Session evicted",
+			"userID", session.UserID,
+			"family_id", session.FamilyID,
+			"policy", s.sessionLimit.EvictionPolicy,
+		)
+	}
+	return sessions[:excess], nil
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is a live login of the user: the current refresh token of a token family.
+type Session struct {
+	ID              string
+	IPAddress       string
+	UserAgent       string
+	Device          DeviceInfo
+	AuthenticatedAt time.Time
+	LastUsedAt      time.Time
+	ExpiresAt       time.Time
+	Current         bool
+}
+
+// ListSessions returns the live sessions of the user. The session the access
+// token with currentJTI belongs to is marked as current.
+func (s *AuthService) ListSessions(ctx context.Context, userID, currentJTI string) ([]Session, error) {
+	tokens, err := s.repo.GetActiveUserSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentSessionID, err := s.sessionIDOf(ctx, currentJTI)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, Session{
+			ID:              token.FamilyID,
+			IPAddress:       token.IPAddress,
+			UserAgent:       token.UserAgent,
+			Device:          ParseUserAgent(token.UserAgent),
+			AuthenticatedAt: token.AuthenticatedAt,
+			LastUsedAt:      token.CreatedAt,
+			ExpiresAt:       token.ExpiresAt,
+			Current:         token.FamilyID == currentSessionID,
+		})
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession logs the user out of one session.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	revokedTokens, err := s.repo.RevokeUserTokenFamily(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if len(revokedTokens) == 0 {
+		return ErrSessionNotFound
+	}
+
+	if err = s.blockAccessTokensOf(ctx, revokedTokens); err != nil {
+		return err
+	}
+
+	s.logger.Info("Session revoked", "userID", userID, "session_id", sessionID)
+	return nil
+}
+
+// RevokeSessions logs the user out of every session except the one the access
+// token with exceptJTI belongs to. An empty exceptJTI revokes all of them.
+func (s *AuthService) RevokeSessions(ctx context.Context, userID, exceptJTI string) (int, error) {
+	tokens, err := s.repo.GetActiveUserSessions(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	keptSessionID, err := s.sessionIDOf(ctx, exceptJTI)
+	if err != nil {
+		return 0, err
+	}
+
+	revokedCount := 0
+	for _, token := range tokens {
+		if token.FamilyID == keptSessionID {
+			continue
+		}
+		if _, err = s.revokeTokenFamily(ctx, token.FamilyID); err != nil {
+			return revokedCount, err
+		}
+		revokedCount++
+	}
+
+	s.logger.Info("Sessions revoked", "userID", userID, "revoked_count", revokedCount, "kept_session_id", keptSessionID)
+	return revokedCount, nil
+}
+
+// sessionIDOf returns the session (token family) the access token with the jti
+// was issued for, or an empty string when its refresh token is gone.
+func (s *AuthService) sessionIDOf(ctx context.Context, jti string) (string, error) {
+	if jti == "" {
+		return "", nil
+	}
+
+	tokenData, err := s.repo.GetRefreshTokenByJTI(ctx, jti)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return tokenData.FamilyID, nil
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrInvalidSigningKey    = errors.New("invalid signing key")
+)
+
+// JSONWebKey is a public key in the JWK format (RFC 7517).
+type JSONWebKey struct {
+	Kty string `json:"kty" example:"RSA"`
+	Use string `json:"use" example:"sig"`
+	Alg string `json:"alg" example:"RS256"`
+	Kid string `json:"kid,omitempty" example:"b7f0c7d2-7c4e-4a57-9d7e-2a8f1c6e3f10"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty" example:"AQAB"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet is the document served on /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// SigningKey holds the key material used to sign and verify access tokens.
+type SigningKey struct {
+	KID       string
+	Method    jwt.SigningMethod
+	CreatedAt time.Time
+	RetiredAt time.Time
+	material  string
+	signKey   any
+	verifyKey any
+}
+
+// NewSigningKey builds a signing key for the algorithm. HMAC algorithms use the
+// shared secret, asymmetric ones the PEM encoded private key.
+func NewSigningKey(kid, algorithm, secret string, privateKeyPEM []byte) (*SigningKey, error) {
+	key, err := parseSigningKey(algorithm, secret, privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	key.KID = kid
+	key.material = secret
+	if privateKeyPEM != nil {
+		key.material = string(privateKeyPEM)
+	}
+	return key, nil
+}
+
+// GenerateSigningKey creates a key with fresh random material for the algorithm.
+func GenerateSigningKey(kid, algorithm string) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil || method == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	var privateKey any
+	var err error
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		secret := make([]byte, 64)
+		if _, err = rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewSigningKey(kid, algorithm, base64.RawStdEncoding.EncodeToString(secret), nil)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case *jwt.SigningMethodECDSA:
+		curves := map[int]elliptic.Curve{256: elliptic.P256(), 384: elliptic.P384(), 521: elliptic.P521()}
+		privateKey, err = ecdsa.GenerateKey(curves[m.CurveBits], rand.Reader)
+	case *jwt.SigningMethodEd25519:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	return NewSigningKey(kid, algorithm, "", privateKeyPEM)
+}
+
+func parseSigningKey(algorithm, secret string, privateKeyPEM []byte) (*SigningKey, error) {
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil || method == jwt.SigningMethodNone {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	switch m := method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if secret == "" {
+			return nil, fmt.Errorf("%w: empty secret for %s", ErrInvalidSigningKey, algorithm)
+		}
+		return &SigningKey{Method: m, signKey: []byte(secret), verifyKey: []byte(secret)}, nil
+
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+		}
+		return &SigningKey{Method: m, signKey: privateKey, verifyKey: &privateKey.PublicKey}, nil
+
+	case *jwt.SigningMethodECDSA:
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+		}
+		if privateKey.Curve.Params().BitSize != m.CurveBits {
+			return nil, fmt.Errorf(
+				"%w: curve %s does not match %s",
+				ErrInvalidSigningKey, privateKey.Curve.Params().Name, algorithm,
+			)
+		}
+		return &SigningKey{Method: m, signKey: privateKey, verifyKey: &privateKey.PublicKey}, nil
+
+	case *jwt.SigningMethodEd25519:
+		privateKey, err := jwt.ParseEdPrivateKeyFromPEM(privateKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSigningKey, err)
+		}
+		edKey, ok := privateKey.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: not an ed25519 key", ErrInvalidSigningKey)
+		}
+		return &SigningKey{Method: m, signKey: edKey, verifyKey: edKey.Public()}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+}
+
+// Sign signs the claims with the key and stamps its kid into the header.
+func (k *SigningKey) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method, claims)
+	if k.KID != "" {
+		token.Header["kid"] = k.KID
+	}
+	return token.SignedString(k.signKey)
+}
+
+// PublicJWK returns the public part of the key as a JWK. Symmetric keys have
+// no public part, so ok is false for them.
+func (k *SigningKey) PublicJWK() (jwk JSONWebKey, ok bool) {
+	jwk = JSONWebKey{Use: "sig", Alg: k.Method.Alg(), Kid: k.KID}
+
+	switch publicKey := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeBase64URL(publicKey.N.Bytes())
+		jwk.E = encodeBase64URL(big.NewInt(int64(publicKey.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = publicKey.Curve.Params().Name
+		jwk.X = encodeBase64URL(publicKey.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeBase64URL(publicKey.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeBase64URL(publicKey)
+	default:
+		return JSONWebKey{}, false
+	}
+
+	return jwk, true
+}
+
+// verificationKey returns the key used by jwt.Parse to check signatures.
+func (k *SigningKey) verificationKey() crypto.PublicKey {
+	return k.verifyKey
+}
+
+func isHMACAlgorithm(algorithm string) bool {
+	_, ok := jwt.GetSigningMethod(algorithm).(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+func encodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+// TokenTypeAccessToken is the only token type exchanged and issued (RFC 8693, section 3).
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+var ErrInvalidImpersonation = errors.New("invalid impersonation request")
+
+const (
+	defaultImpersonationTTL = 15 * time.Minute
+	maxImpersonationTTL     = time.Hour
+	maxActorLen             = 255
+)
+
+// audiencePattern keeps audiences printable and free of spaces.
+var audiencePattern = regexp.MustCompile(`^[!-~]{1,255}$`)
+
+// Actor is the party acting on behalf of the subject of a token, the "act"
+// claim of RFC 8693, section 4.1.
+type Actor struct {
+	// Subject is the client of a delegation or the admin of an impersonation
+	Subject string
+	// Impersonation marks an admin acting as the user
+	Impersonation bool
+	// Actor is the previous actor of a delegation chain
+	Actor *Actor
+}
+
+// Impersonated reports whether an admin impersonates the user anywhere in the
+// chain. It is false for tokens without an actor.
+func (a *Actor) Impersonated() bool {
+	for actor := a; actor != nil; actor = actor.Actor {
+		if actor.Impersonation {
+			return true
+		}
+	}
+	return false
+}
+
+// Claim is the actor as the "act" claim.
+func (a *Actor) Claim() map[string]any {
+	claim := map[string]any{"sub": a.Subject}
+	if a.Impersonation {
+		claim["imp"] = true
+	}
+	if a.Actor != nil {
+		claim["act"] = a.Actor.Claim()
+	}
+	return claim
+}
+
+func parseActor(value any) *Actor {
+	claim, ok := value.(map[string]any)
+	if !ok {
+		return nil
+	}
+	subject, ok := claim["sub"].(string)
+	if !ok {
+		return nil
+	}
+
+	actor := &Actor{Subject: subject, Actor: parseActor(claim["act"])}
+	actor.Impersonation, _ = claim["imp"].(bool)
+	return actor
+}
+
+// TokenExchangeRequest holds the parameters of the token exchange grant
+// (RFC 8693, section 2.1).
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	RequestedTokenType string
+	ActorToken         string
+	Scope              string
+	Audience           []string
+	// Binding constrains the new token to the keys of the client
+	Binding TokenBinding
+}
+
+// DelegatedToken is an access token issued to act on behalf of a user, by
+// token exchange or impersonation. It comes without a refresh token.
+type DelegatedToken struct {
+	AccessToken string
+	UserID      string
+	Scope       []string
+	ExpiresAt   time.Time
+}
+
+// Impersonation is an admin request to act as a user.
+type Impersonation struct {
+	// Actor names the admin, Reason says why, both are audited. The admin API
+	// authenticates the shared admin token, not a person, so Actor is whatever
+	// the caller asserts and not verified against any identity.
+	Actor  string
+	Reason string
+	// Scope defaults to every permission of the user
+	Scope []string
+	// TTL defaults to defaultImpersonationTTL
+	TTL time.Duration
+}
+
+// ImpersonationRecord is the audit record of an impersonation token.
+type ImpersonationRecord struct {
+	JTI       string
+	Actor     string
+	UserID    string
+	Reason    string
+	Scope     []string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// checkAudience rejects requested audiences that are not printable names or
+// URIs (RFC 8707, section 2).
+func checkAudience(audience []string) error {
+	for _, name := range audience {
+		if !audiencePattern.MatchString(name) {
+			return newOAuthError(OAuthErrorInvalidTarget, "audience is malformed")
+		}
+	}
+	return nil
+}
+
+// ExchangeToken is the token exchange grant: the client presents the access
+// token of a user meant for this service and gets a token to call another
+// service with on the user's behalf. The new token has at most the scope of
+// the subject token, is restricted to the required audience, expires no later
+// than the subject token and names the client in the "act" claim. A bound
+// subject token is exchanged only by the holder of its key, so a stolen bound
+// token can't be turned into an unbound one.
+func (s *AuthService) ExchangeToken(ctx context.Context, clientID string, req TokenExchangeRequest) (DelegatedToken, error) {
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidRequest, "subject_token and subject_token_type are required")
+	}
+	if req.SubjectTokenType != TokenTypeAccessToken {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidRequest, "subject_token_type must be "+TokenTypeAccessToken)
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidRequest, "only access tokens are issued")
+	}
+	if req.ActorToken != "" {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidRequest, "actor_token is not supported, the client is the actor")
+	}
+	if len(req.Audience) == 0 {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidRequest, "audience or resource is required")
+	}
+	if err := checkAudience(req.Audience); err != nil {
+		return DelegatedToken{}, err
+	}
+
+	subject, err := s.VerifyAccessTokenClaims(ctx, req.SubjectToken)
+	if errors.Is(err, ErrInvalidAudience) {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidGrant, "subject token is not meant for this service")
+	} else if err != nil {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidGrant, "subject token is invalid")
+	}
+	if subject.Service || subject.UserID == "" {
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidGrant, "subject token has no user")
+	}
+	if subject.DPoPJKT != "" && subject.DPoPJKT != req.Binding.DPoPJKT {
+		s.logger.Warn("Bound subject token exchanged without its DPoP key", "client_id", clientID, "subject_jti", subject.JTI)
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidGrant, "subject token is bound to another DPoP key")
+	}
+	if subject.CertThumbprint != "" && subject.CertThumbprint != req.Binding.CertThumbprint {
+		s.logger.Warn("Bound subject token exchanged without its certificate", "client_id", clientID, "subject_jti", subject.JTI)
+		return DelegatedToken{}, newOAuthError(OAuthErrorInvalidGrant, "subject token is bound to another client certificate")
+	}
+
+	scope := strings.Fields(req.Scope)
+	if len(scope) == 0 {
+		scope = subject.Permissions
+	}
+	for _, requested := range scope {
+		if !slices.Contains(subject.Permissions, requested) {
+			return DelegatedToken{}, newOAuthError(OAuthErrorInvalidScope, "scope "+requested+" is not granted by the subject token")
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.accessExpireTime)
+	if subject.ExpiresAt.Before(expiresAt) {
+		expiresAt = subject.ExpiresAt
+	}
+
+	actor := &Actor{Subject: clientID, Actor: subject.Actor}
+	accessPayload := jwt.MapClaims{
+		"sub":       subject.UserID,
+		"client_id": clientID,
+		"aud":       req.Audience,
+		"act":       actor.Claim(),
+		"jti":       uuid.New().String(),
+		"exp":       expiresAt.Unix(),
+		"iat":       now.Unix(),
+	}
+	if len(scope) > 0 {
+		accessPayload["scope"] = strings.Join(scope, " ")
+	}
+	if confirmation := req.Binding.confirmation(); confirmation != nil {
+		accessPayload["cnf"] = confirmation
+	}
+	if !subject.Authentication.Time.IsZero() {
+		accessPayload["auth_time"] = subject.Authentication.Time.Unix()
+	}
+	if len(subject.Authentication.Methods) > 0 {
+		accessPayload["amr"] = subject.Authentication.Methods
+	}
+
+	accessToken, err := s.signAccessToken(ctx, accessPayload)
+	if err != nil {
+		return DelegatedToken{}, err
+	}
+
+	s.logger.Info("Token exchanged",
+		"userID", subject.UserID,
+		"client_id", clientID,
+		"subject_jti", subject.JTI,
+		"audience", req.Audience,
+		"scope", scope,
+		"impersonated", actor.Impersonated(),
+	)
+	return DelegatedToken{AccessToken: accessToken, UserID: subject.UserID, Scope: scope, ExpiresAt: expiresAt}, nil
+}
+
+// Impersonate issues the admin a token of the user. The token names the
+// self-asserted actor in the "act" claim marked with "imp", and every token is
+// recorded with the reason, IP and user agent before it is returned.
+func (s *AuthService) Impersonate(
+	ctx context.Context, userID string, req Impersonation, ipAddress, userAgent string,
+) (DelegatedToken, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return DelegatedToken{}, ErrUserNotFound
+	}
+	req.Actor = strings.TrimSpace(req.Actor)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Actor == "" || len(req.Actor) > maxActorLen || req.Reason == "" {
+		return DelegatedToken{}, ErrInvalidImpersonation
+	}
+	if req.TTL == 0 {
+		req.TTL = defaultImpersonationTTL
+	}
+	if req.TTL < time.Minute || req.TTL > maxImpersonationTTL {
+		return DelegatedToken{}, ErrInvalidImpersonation
+	}
+
+	_, permissions, err := s.roles.UserGrants(ctx, userID)
+	if err != nil {
+		return DelegatedToken{}, err
+	}
+	scope := req.Scope
+	if scope == nil {
+		scope = permissions
+	}
+	for _, requested := range scope {
+		if !slices.Contains(permissions, requested) && !IsIdentityScope(requested) {
+			return DelegatedToken{}, ErrInvalidImpersonation
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(req.TTL)
+	jti := uuid.New().String()
+	actor := &Actor{Subject: req.Actor, Impersonation: true}
+	accessPayload := jwt.MapClaims{
+		"sub": userID,
+		"act": actor.Claim(),
+		"jti": jti,
+		"exp": expiresAt.Unix(),
+		"iat": now.Unix(),
+	}
+	if len(scope) > 0 {
+		accessPayload["scope"] = strings.Join(scope, " ")
+	}
+
+	accessToken, err := s.signAccessToken(ctx, accessPayload)
+	if err != nil {
+		return DelegatedToken{}, err
+	}
+
+	// No audit record, no token
+	err = s.repo.StoreImpersonation(ctx, repository.ImpersonationData{
+		JTI:       jti,
+		Actor:     req.Actor,
+		UserID:    userID,
+		Reason:    req.Reason,
+		Scope:     strings.Join(scope, " "),
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		ExpiresAt: expiresAt,
+	})
+	if errors.Is(err, repository.ErrReferenceNotFound) {
+		return DelegatedToken{}, ErrUserNotFound
+	} else if err != nil {
+		return DelegatedToken{}, err
+	}
+
+	s.logger.Warn("User impersonated",
+		"userID", userID,
+		"actor", req.Actor,
+		"reason", req.Reason,
+		"jti", jti,
+		"scope", scope,
+		"ip_address", ipAddress,
+	)
+	return DelegatedToken{AccessToken: accessToken, UserID: userID, Scope: scope, ExpiresAt: expiresAt}, nil
+}
+
+// ListImpersonations returns the audit records of the user, newest first.
+func (s *AuthService) ListImpersonations(ctx context.Context, userID string) ([]ImpersonationRecord, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	impersonationsData, err := s.repo.GetUserImpersonations(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	impersonations := make([]ImpersonationRecord, 0, len(impersonationsData))
+	for _, impersonationData := range impersonationsData {
+		impersonations = append(impersonations, ImpersonationRecord{
+			JTI:       impersonationData.JTI,
+			Actor:     impersonationData.Actor,
+			UserID:    impersonationData.UserID,
+			Reason:    impersonationData.Reason,
+			Scope:     strings.Fields(impersonationData.Scope),
+			IPAddress: impersonationData.IPAddress,
+			UserAgent: impersonationData.UserAgent,
+			CreatedAt: impersonationData.CreatedAt,
+			ExpiresAt: impersonationData.ExpiresAt,
+		})
+	}
+	return impersonations, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 appendix B test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B, the vectors have 8 digits and our codes are their last 6
+	for unix, want := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		if got := totpCode(rfc6238Secret, totpStep(time.Unix(unix, 0))); got != want {
+			t.Errorf("code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestMatchTOTPCode(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	for name, tc := range map[string]struct {
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		"current step":   {code: totpCode(rfc6238Secret, current), wantStep: current, wantOK: true},
+		"previous step":  {code: totpCode(rfc6238Secret, current-1), wantStep: current - 1, wantOK: true},
+		"next step":      {code: totpCode(rfc6238Secret, current+1), wantStep: current + 1, wantOK: true},
+		"two steps ago":  {code: totpCode(rfc6238Secret, current-2)},
+		"two steps on":   {code: totpCode(rfc6238Secret, current+2)},
+		"8 digit vector": {code: "14050471"},
+		"too short":      {code: "05047"},
+		"empty":          {code: ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			step, ok := matchTOTPCode(rfc6238Secret, tc.code, now)
+			if ok != tc.wantOK || step != tc.wantStep {
+				t.Errorf("matchTOTPCode(%q) = %d, %v, want %d, %v", tc.code, step, ok, tc.wantStep, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import "strings"
+
+const (
+	DeviceTypeDesktop = "desktop"
+	DeviceTypeMobile  = "mobile"
+	DeviceTypeTablet  = "tablet"
+	DeviceTypeBot     = "bot"
+	DeviceTypeUnknown = "unknown"
+
+	unknownUserAgentPart = "unknown"
+)
+
+// DeviceInfo is a human readable description of a User-Agent.
+type DeviceInfo struct {
+	Browser string
+	OS      string
+	Type    string
+}
+
+// userAgentMarker maps a User-Agent substring to a name. Order matters: Chromium
+// based browsers mention Chrome and Safari, so they are checked first.
+type userAgentMarker struct {
+	marker string
+	name   string
+}
+
+var browserMarkers = []userAgentMarker{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"PostmanRuntime/", "Postman"},
+}
+
+var osMarkers = []userAgentMarker{
+	{"Windows", "Windows"},
+	{"iPhone", "iOS"},
+	{"iPad", "iPadOS"},
+	{"Android", "Android"},
+	{"Mac OS X", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// ParseUserAgent recognizes the browser, OS and device type of common User-Agents.
+// Unrecognized parts are reported as unknown.
+func ParseUserAgent(userAgent string) DeviceInfo {
+	device := DeviceInfo{
+		Browser: findUserAgentMarker(userAgent, browserMarkers),
+		OS:      findUserAgentMarker(userAgent, osMarkers),
+		Type:    DeviceTypeUnknown,
+	}
+
+	lowerUserAgent := strings.ToLower(userAgent)
+	switch {
+	case userAgent == "":
+	case strings.Contains(lowerUserAgent, "bot") || strings.Contains(lowerUserAgent, "spider"):
+		device.Type = DeviceTypeBot
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet"):
+		device.Type = DeviceTypeTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone"):
+		device.Type = DeviceTypeMobile
+	case strings.Contains(userAgent, "Android"):
+		// Android tablets don't send the Mobile token
+		device.Type = DeviceTypeTablet
+	case device.OS != unknownUserAgentPart:
+		device.Type = DeviceTypeDesktop
+	}
+
+	return device
+}
+
+func findUserAgentMarker(userAgent string, markers []userAgentMarker) string {
+	for _, m := range markers {
+		if strings.Contains(userAgent, m.marker) {
+			return m.name
+		}
+	}
+	return unknownUserAgentPart
+}
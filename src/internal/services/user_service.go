@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrUserAlreadyExists  = errors.New("user already exists")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrWeakPassword       = errors.New("password is too weak")
+	ErrInvalidEmail       = errors.New("invalid email")
+	ErrInvalidUsername    = errors.New("invalid username")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+// maxPasswordLength bounds the work spent on hashing attacker supplied input.
+const maxPasswordLength = 256
+
+// usernamePattern forbids "@", so a login is never both a username and an email.
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,64}$`)
+
+type UserService struct {
+	repo              *repository.UserRepository
+	logger            *slog.Logger
+	hasher            *PasswordHasher
+	minPasswordLength int
+	// dummyHash is verified for unknown logins, so they take as long as known ones
+	dummyHash string
+	mailer    MailSender
+	// appURL is the base of the links sent by mail
+	appURL string
+}
+
+func NewUserService(
+	repo *repository.UserRepository,
+	logger *slog.Logger,
+	hasher *PasswordHasher,
+	minPasswordLength int,
+	mailer MailSender,
+	appURL string,
+) (*UserService, error) {
+	dummyHash, err := hasher.Hash(uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserService{
+		repo:              repo,
+		logger:            logger,
+		hasher:            hasher,
+		minPasswordLength: minPasswordLength,
+		dummyHash:         dummyHash,
+		mailer:            mailer,
+		appURL:            strings.TrimRight(appURL, "/"),
+	}, nil
+}
+
+// Register creates a user with a password and returns its id.
+func (s *UserService) Register(ctx context.Context, username, email, password string) (string, error) {
+	if !usernamePattern.MatchString(username) {
+		return "", ErrInvalidUsername
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+	if err := s.validatePassword(password); err != nil {
+		return "", err
+	}
+
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.logger.Error("Failed to hash password", "error", err)
+		return "", err
+	}
+
+	userID := uuid.New().String()
+	err = s.repo.CreateUser(ctx, userID, username, email, passwordHash)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return "", ErrUserAlreadyExists
+	} else if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("User registered", "userID", userID, "username", username)
+
+	if err = s.RequestEmailVerification(ctx, userID); err != nil {
+		// The user can ask for another mail
+		s.logger.Warn("Failed to send verification mail", "error", err, "userID", userID)
+	}
+	return userID, nil
+}
+
+// VerifyCredentials checks the password of the user with the username or email
+// and returns the user id.
+func (s *UserService) VerifyCredentials(ctx context.Context, login, password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", ErrInvalidCredentials
+	}
+
+	user, err := s.repo.GetUserByLogin(ctx, login)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	// Users created before passwords existed can't log in with one
+	if err == sql.ErrNoRows || !user.PasswordHash.Valid {
+		s.hasher.Verify(password, s.dummyHash)
+		s.logger.Info("Login failed, unknown user", "login", login)
+		return "", ErrInvalidCredentials
+	}
+
+	match, err := s.hasher.Verify(password, user.PasswordHash.String)
+	if err != nil {
+		s.logger.Error("Failed to verify password hash", "error", err, "userID", user.UserID)
+		return "", err
+	}
+	if !match {
+		s.logger.Info("Login failed, wrong password", "userID", user.UserID)
+		return "", ErrInvalidCredentials
+	}
+
+	if s.hasher.NeedsRehash(user.PasswordHash.String) {
+		s.rehashPassword(ctx, user.UserID, password)
+	}
+
+	return user.UserID, nil
+}
+
+// DisplayName returns the username, the email or, for users without them, the id.
+func (s *UserService) DisplayName(ctx context.Context, userID string) (string, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if user.Username.Valid {
+		return user.Username.String, nil
+	} else if user.Email.Valid {
+		return user.Email.String, nil
+	}
+	return user.UserID, nil
+}
+
+// UserProfile holds the identity claims of a user.
+type UserProfile struct {
+	UserID        string
+	Username      string
+	Email         string
+	EmailVerified bool
+}
+
+// Profile returns the identity of the user, ErrUserNotFound if there is none.
+func (s *UserService) Profile(ctx context.Context, userID string) (UserProfile, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err == sql.ErrNoRows {
+		return UserProfile{}, ErrUserNotFound
+	} else if err != nil {
+		return UserProfile{}, err
+	}
+
+	return UserProfile{
+		UserID:        user.UserID,
+		Username:      user.Username.String,
+		Email:         user.Email.String,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+	}, nil
+}
+
+// UserIDByEmail returns the id of the user with the email, ErrUserNotFound if
+// there is none. Usernames are not matched.
+func (s *UserService) UserIDByEmail(ctx context.Context, email string) (string, error) {
+	user, err := s.repo.GetUserByLogin(ctx, email)
+	if err == sql.ErrNoRows || (err == nil && !strings.EqualFold(user.Email.String, email)) {
+		return "", ErrUserNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return user.UserID, nil
+}
+
+// ResolveExternalUser returns the local user linked to the subject of the
+// external provider and creates it on the first login.
+func (s *UserService) ResolveExternalUser(ctx context.Context, provider, subject string) (string, error) {
+	userID, err := s.repo.GetUserIDByIdentity(ctx, provider, subject)
+	if err == nil {
+		return userID, nil
+	} else if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	userID = uuid.New().String()
+	err = s.repo.CreateUserWithIdentity(ctx, userID, provider, subject)
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		// Linked by a concurrent first login
+		return s.repo.GetUserIDByIdentity(ctx, provider, subject)
+	} else if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("User provisioned from external provider", "userID", userID, "provider", provider)
+	return userID, nil
+}
+
+func (s *UserService) validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < s.minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	return nil
+}
+
+// rehashPassword upgrades the hash to the current parameters. Failures are only
+// logged, the old hash keeps working.
+func (s *UserService) rehashPassword(ctx context.Context, userID, password string) {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.logger.Warn("Failed to rehash password", "error", err, "userID", userID)
+		return
+	}
+
+	if err = s.repo.UpdatePasswordHash(ctx, userID, passwordHash); err != nil {
+		s.logger.Warn("Failed to store rehashed password", "error", err, "userID", userID)
+		return
+	}
+	s.logger.Info("Password rehashed with current parameters", "userID", userID)
+}
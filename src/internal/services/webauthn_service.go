@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+var (
+	ErrInvalidWebAuthnChallenge = errors.New("invalid or expired webauthn challenge")
+	ErrWebAuthnVerification     = errors.New("webauthn verification failed")
+	ErrCredentialAlreadyExists  = errors.New("webauthn credential already registered")
+	ErrUnsupportedAttestation   = errors.New("unsupported attestation format")
+	ErrAuthenticatorCloned      = errors.New("authenticator sign counter did not increase")
+)
+
+const (
+	webAuthnCeremonyRegistration = "registration"
+	webAuthnCeremonyLogin        = "login"
+	webAuthnCeremonyTimeout      = 5 * time.Minute
+)
+
+// webAuthnAttestationFormats are the verified attestation statement formats.
+var webAuthnAttestationFormats = []protocol.AttestationFormat{
+	protocol.AttestationFormatNone,
+	protocol.AttestationFormatPacked,
+}
+
+// WebAuthnSettings describe the relying party.
+type WebAuthnSettings struct {
+	RPID          string
+	RPDisplayName string
+	RPOrigins     []string
+	// Attestation is the conveyance preference: none or direct
+	Attestation string
+}
+
+// webAuthnStore is the part of *repository.WebAuthnRepository the service uses.
+type webAuthnStore interface {
+	StoreWebAuthnCredential(ctx context.Context, credential repository.WebAuthnCredentialData) error
+	GetWebAuthnCredentials(ctx context.Context, userID string) ([]repository.WebAuthnCredentialData, error)
+	UpdateWebAuthnCredentialUse(
+		ctx context.Context, credentialID []byte, signCount uint32, backupState bool, usedAt time.Time,
+	) error
+	StoreWebAuthnSession(ctx context.Context, session repository.WebAuthnSessionData) error
+	ConsumeWebAuthnSession(ctx context.Context, challenge, ceremony string) (repository.WebAuthnSessionData, error)
+}
+
+// webAuthnUsers names the users passkeys are registered for.
+type webAuthnUsers interface {
+	DisplayName(ctx context.Context, userID string) (string, error)
+}
+
+// WebAuthnService runs the registration and assertion ceremonies of passkeys.
+// The challenge of a ceremony is kept in the database until the response comes
+// back, so any instance can finish it.
+type WebAuthnService struct {
+	repo     webAuthnStore
+	users    webAuthnUsers
+	logger   *slog.Logger
+	webAuthn *webauthn.WebAuthn
+}
+
+func NewWebAuthnService(
+	settings WebAuthnSettings,
+	repo *repository.WebAuthnRepository,
+	users *UserService,
+	logger *slog.Logger,
+) (*WebAuthnService, error) {
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:                  settings.RPID,
+		RPDisplayName:         settings.RPDisplayName,
+		RPOrigins:             settings.RPOrigins,
+		AttestationPreference: protocol.ConveyancePreference(settings.Attestation),
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnCeremonyTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnCeremonyTimeout},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnService{repo: repo, users: users, logger: logger, webAuthn: webAuthn}, nil
+}
+
+// BeginRegistration returns the options of navigator.credentials.create() for
+// a new passkey of the user.
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID string) (*protocol.CredentialCreation, error) {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := s.webAuthn.BeginRegistration(
+		user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		}),
+		webauthn.WithAttestationFormats(webAuthnAttestationFormats),
+	)
+	if err != nil {
+		s.logger.Error("Failed to begin WebAuthn registration", "error", err, "userID", userID)
+		return nil, err
+	}
+
+	if err = s.storeSession(ctx, webAuthnCeremonyRegistration, userID, session); err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+// FinishRegistration verifies the response of navigator.credentials.create()
+// and stores the credential.
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID string, response []byte) error {
+	parsedResponse, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		s.logger.Info("Invalid WebAuthn registration response", "error", err, "userID", userID)
+		return ErrWebAuthnVerification
+	}
+
+	session, sessionUserID, err := s.consumeSession(
+		ctx, webAuthnCeremonyRegistration, parsedResponse.Response.CollectedClientData.Challenge,
+	)
+	if err != nil {
+		return err
+	}
+	if sessionUserID != userID {
+		s.logger.Warn("WebAuthn registration finished by another user", "userID", userID, "session_user_id", sessionUserID)
+		return ErrInvalidWebAuthnChallenge
+	}
+
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	credential, err := s.webAuthn.CreateCredential(user, session, parsedResponse)
+	if err != nil {
+		s.logger.Info("WebAuthn registration failed", "error", err, "userID", userID)
+		return ErrWebAuthnVerification
+	}
+	if !isSupportedAttestation(credential.AttestationType) {
+		s.logger.Info("WebAuthn attestation format rejected", "format", credential.AttestationType, "userID", userID)
+		return ErrUnsupportedAttestation
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+
+	err = s.repo.StoreWebAuthnCredential(ctx, repository.WebAuthnCredentialData{
+		CredentialID:    credential.ID,
+		UserID:          userID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		Transports:      transports,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	})
+	if errors.Is(err, repository.ErrAlreadyExists) {
+		return ErrCredentialAlreadyExists
+	} else if err != nil {
+		return err
+	}
+
+	s.logger.Info("WebAuthn credential registered", "userID", userID, "attestation", credential.AttestationType)
+	return nil
+}
+
+// BeginLogin returns the options of navigator.credentials.get() for a
+// passwordless login, the authenticator picks the account.
+func (s *WebAuthnService) BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, error) {
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		s.logger.Error("Failed to begin WebAuthn login", "error", err)
+		return nil, err
+	}
+
+	if err = s.storeSession(ctx, webAuthnCeremonyLogin, "", session); err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishLogin verifies the response of navigator.credentials.get() and
+// returns the id of the user the passkey belongs to.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, response []byte) (string, error) {
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		s.logger.Info("Invalid WebAuthn login response", "error", err)
+		return "", ErrWebAuthnVerification
+	}
+
+	session, _, err := s.consumeSession(ctx, webAuthnCeremonyLogin, parsedResponse.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return "", err
+	}
+
+	var user *webAuthnUser
+	credential, err := s.webAuthn.ValidateDiscoverableLogin(
+		func(rawID, userHandle []byte) (webauthn.User, error) {
+			userUUID, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, err
+			}
+			user, err = s.loadUser(ctx, userUUID.String())
+			return user, err
+		},
+		session,
+		parsedResponse,
+	)
+	if err != nil {
+		s.logger.Info("WebAuthn login failed", "error", err)
+		return "", ErrWebAuthnVerification
+	}
+
+	if credential.Authenticator.CloneWarning {
+		s.logger.Warn("WebAuthn sign counter did not increase, authenticator may be cloned", "userID", user.id)
+		return "", ErrAuthenticatorCloned
+	}
+
+	err = s.repo.UpdateWebAuthnCredentialUse(
+		ctx, credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState, time.Now(),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.Info("WebAuthn login verified", "userID", user.id)
+	return user.id, nil
+}
+
+func (s *WebAuthnService) storeSession(
+	ctx context.Context, ceremony, userID string, session *webauthn.SessionData,
+) error {
+	sessionData, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.StoreWebAuthnSession(ctx, repository.WebAuthnSessionData{
+		Challenge:   session.Challenge,
+		Ceremony:    ceremony,
+		UserID:      sql.NullString{String: userID, Valid: userID != ""},
+		SessionData: sessionData,
+		ExpiresAt:   time.Now().Add(webAuthnCeremonyTimeout),
+	})
+}
+
+func (s *WebAuthnService) consumeSession(
+	ctx context.Context, ceremony, challenge string,
+) (webauthn.SessionData, string, error) {
+	sessionData, err := s.repo.ConsumeWebAuthnSession(ctx, challenge, ceremony)
+	if err == sql.ErrNoRows {
+		return webauthn.SessionData{}, "", ErrInvalidWebAuthnChallenge
+	} else if err != nil {
+		return webauthn.SessionData{}, "", err
+	}
+	if time.Now().After(sessionData.ExpiresAt) {
+		return webauthn.SessionData{}, "", ErrInvalidWebAuthnChallenge
+	}
+
+	var session webauthn.SessionData
+	if err = json.Unmarshal(sessionData.SessionData, &session); err != nil {
+		s.logger.Error("Failed to decode WebAuthn session", "error", err)
+		return webauthn.SessionData{}, "", err
+	}
+
+	return session, sessionData.UserID.String, nil
+}
+
+func (s *WebAuthnService) loadUser(ctx context.Context, userID string) (*webAuthnUser, error) {
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	displayName, err := s.users.DisplayName(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialsData, err := s.repo.GetWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &webAuthnUser{id: userID, handle: userUUID[:], name: displayName}
+	for _, credentialData := range credentialsData {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(credentialData.Transports))
+		for _, transport := range credentialData.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+
+		user.credentials = append(user.credentials, webauthn.Credential{
+			ID:              credentialData.CredentialID,
+			PublicKey:       credentialData.PublicKey,
+			AttestationType: credentialData.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: credentialData.BackupEligible,
+				BackupState:    credentialData.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    credentialData.AAGUID,
+				SignCount: credentialData.SignCount,
+			},
+		})
+	}
+
+	return user, nil
+}
+
+func isSupportedAttestation(format string) bool {
+	for _, supported := range webAuthnAttestationFormats {
+		if format == string(supported) {
+			return true
+		}
+	}
+	return false
+}
+
+// webAuthnUser adapts a local user to webauthn.User. The user handle is the
+// 16 bytes of the user id.
+type webAuthnUser struct {
+	id          string
+	handle      []byte
+	name        string
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.handle
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/nikuIin/base_go_auth/src/internal/repository"
+)
+
+const (
+	testRPID   = "example.test"
+	testOrigin = "https://example.test"
+)
+
+// memoryWebAuthnStore keeps credentials and ceremonies in memory.
+type memoryWebAuthnStore struct {
+	credentials []repository.WebAuthnCredentialData
+	sessions    map[string]repository.WebAuthnSessionData
+}
+
+func (m *memoryWebAuthnStore) StoreWebAuthnCredential(_ context.Context, credential repository.WebAuthnCredentialData) error {
+	for _, stored := range m.credentials {
+		if bytes.Equal(stored.CredentialID, credential.CredentialID) {
+			return repository.ErrAlreadyExists
+		}
+	}
+	m.credentials = append(m.credentials, credential)
+	return nil
+}
+
+func (m *memoryWebAuthnStore) GetWebAuthnCredentials(_ context.Context, userID string) ([]repository.WebAuthnCredentialData, error) {
+	var credentials []repository.WebAuthnCredentialData
+	for _, credential := range m.credentials {
+		if credential.UserID == userID {
+			credentials = append(credentials, credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *memoryWebAuthnStore) UpdateWebAuthnCredentialUse(
+	_ context.Context, credentialID []byte, signCount uint32, backupState bool, usedAt time.Time,
+) error {
+	for i := range m.credentials {
+		if bytes.Equal(m.credentials[i].CredentialID, credentialID) {
+			m.credentials[i].SignCount = signCount
+			m.credentials[i].BackupState = backupState
+			m.credentials[i].LastUsedAt = sql.NullTime{Time: usedAt, Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *memoryWebAuthnStore) StoreWebAuthnSession(_ context.Context, session repository.WebAuthnSessionData) error {
+	m.sessions[session.Ceremony+":"+session.Challenge] = session
+	return nil
+}
+
+func (m *memoryWebAuthnStore) ConsumeWebAuthnSession(
+	_ context.Context, challenge, ceremony string,
+) (repository.WebAuthnSessionData, error) {
+	session, ok := m.sessions[ceremony+":"+challenge]
+	if !ok {
+		return repository.WebAuthnSessionData{}, sql.ErrNoRows
+	}
+	delete(m.sessions, ceremony+":"+challenge)
+	return session, nil
+}
+
+type displayNames map[string]string
+
+func (d displayNames) DisplayName(_ context.Context, userID string) (string, error) {
+	return d[userID], nil
+}
+
+// softwareAuthenticator is a passkey held in memory: it answers ceremonies the
+// way a platform authenticator does, with an ES256 key.
+type softwareAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newSoftwareAuthenticator(t *testing.T) *softwareAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 32)
+	if _, err = rand.Read(credentialID); err != nil {
+		t.Fatal(err)
+	}
+	return &softwareAuthenticator{key: key, credentialID: credentialID}
+}
+
+// authenticatorData is rpIdHash, flags, the sign counter and the attested
+// credential data when attested is set (WebAuthn, section 6.1).
+func (a *softwareAuthenticator) authenticatorData(t *testing.T, attested bool) []byte {
+	t.Helper()
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	// User present and user verified
+	flags := byte(0x01 | 0x04)
+	if attested {
+		flags |= 0x40
+	}
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	size := (a.key.Curve.Params().BitSize + 7) / 8
+	publicKey, err := cbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, size)),
+		-3: a.key.Y.FillBytes(make([]byte, size)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+	data = append(data, a.credentialID...)
+	return append(data, publicKey...)
+}
+
+func (a *softwareAuthenticator) sign(t *testing.T, authenticatorData, clientDataJSON []byte) []byte {
+	t.Helper()
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(bytes.Clone(authenticatorData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+func clientDataJSON(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      testOrigin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// create answers navigator.credentials.create() with a "none" or self "packed"
+// attestation.
+func (a *softwareAuthenticator) create(t *testing.T, challenge, format string) []byte {
+	t.Helper()
+	clientData := clientDataJSON(t, "webauthn.create", challenge)
+	authenticatorData := a.authenticatorData(t, true)
+
+	statement := map[string]any{}
+	if format == "packed" {
+		statement = map[string]any{"alg": -7, "sig": a.sign(t, authenticatorData, clientData)}
+	}
+	attestationObject, err := cbor.Marshal(map[string]any{
+		"fmt":      format,
+		"attStmt":  statement,
+		"authData": authenticatorData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.response(t, map[string]any{
+		"clientDataJSON":    encodeBase64URL(clientData),
+		"attestationObject": encodeBase64URL(attestationObject),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get answers navigator.credentials.get() with an assertion of the user.
+func (a *softwareAuthenticator) get(t *testing.T, challenge string, userHandle []byte) []byte {
+	t.Helper()
+	a.signCount++
+	clientData := clientDataJSON(t, "webauthn.get", challenge)
+	authenticatorData := a.authenticatorData(t, false)
+
+	return a.response(t, map[string]any{
+		"clientDataJSON":    encodeBase64URL(clientData),
+		"authenticatorData": encodeBase64URL(authenticatorData),
+		"signature":         encodeBase64URL(a.sign(t, authenticatorData, clientData)),
+		"userHandle":        encodeBase64URL(userHandle),
+	})
+}
+
+func (a *softwareAuthenticator) response(t *testing.T, response map[string]any) []byte {
+	t.Helper()
+	credential, err := json.Marshal(map[string]any{
+		"id":       base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"rawId":    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return credential
+}
+
+func newTestWebAuthnService(t *testing.T, userID string) (*WebAuthnService, *memoryWebAuthnStore) {
+	t.Helper()
+	service, err := NewWebAuthnService(WebAuthnSettings{
+		RPID:          testRPID,
+		RPDisplayName: "Example",
+		RPOrigins:     []string{testOrigin},
+		Attestation:   "direct",
+	}, nil, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memoryWebAuthnStore{sessions: map[string]repository.WebAuthnSessionData{}}
+	service.repo = store
+	service.users = displayNames{userID: "john_doe"}
+	return service, store
+}
+
+func TestWebAuthnRegistrationAndLogin(t *testing.T) {
+	for _, format := range []string{"none", "packed"} {
+		t.Run(format, func(t *testing.T) {
+			ctx := context.Background()
+			userID := uuid.New().String()
+			service, store := newTestWebAuthnService(t, userID)
+			authenticator := newSoftwareAuthenticator(t)
+
+			creation, err := service.BeginRegistration(ctx, userID)
+			if err != nil {
+				t.Fatalf("BeginRegistration: %v", err)
+			}
+			err = service.FinishRegistration(ctx, userID, authenticator.create(t, creation.Response.Challenge.String(), format))
+			if err != nil {
+				t.Fatalf("FinishRegistration: %v", err)
+			}
+			if len(store.credentials) != 1 || store.credentials[0].AttestationType != format {
+				t.Fatalf("stored credentials = %+v, want one %s credential", store.credentials, format)
+			}
+
+			userHandle := uuid.MustParse(userID)
+			assertion, err := service.BeginLogin(ctx)
+			if err != nil {
+				t.Fatalf("BeginLogin: %v", err)
+			}
+			challenge := assertion.Response.Challenge.String()
+			response := authenticator.get(t, challenge, userHandle[:])
+			loggedInUserID, err := service.FinishLogin(ctx, response)
+			if err != nil {
+				t.Fatalf("FinishLogin: %v", err)
+			}
+			if loggedInUserID != userID {
+				t.Errorf("FinishLogin = %q, want %q", loggedInUserID, userID)
+			}
+			if store.credentials[0].SignCount != authenticator.signCount {
+				t.Errorf("sign count = %d, want %d", store.credentials[0].SignCount, authenticator.signCount)
+			}
+
+			// A challenge completes one ceremony
+			if _, err = service.FinishLogin(ctx, response); !errors.Is(err, ErrInvalidWebAuthnChallenge) {
+				t.Errorf("replayed FinishLogin err = %v, want ErrInvalidWebAuthnChallenge", err)
+			}
+		})
+	}
+}
+
+func TestWebAuthnRejectsInvalidAssertions(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	service, _ := newTestWebAuthnService(t, userID)
+	authenticator := newSoftwareAuthenticator(t)
+	userHandle := uuid.MustParse(userID)
+
+	creation, err := service.BeginRegistration(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = service.FinishRegistration(ctx, userID, authenticator.create(t, creation.Response.Challenge.String(), "none")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("registration of the same credential", func(t *testing.T) {
+		creation, err := service.BeginRegistration(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = service.FinishRegistration(ctx, userID, authenticator.create(t, creation.Response.Challenge.String(), "none"))
+		if err == nil {
+			t.Error("FinishRegistration accepted an excluded credential")
+		}
+	})
+
+	t.Run("unknown challenge", func(t *testing.T) {
+		_, err := service.FinishLogin(ctx, authenticator.get(t, encodeBase64URL([]byte("not issued")), userHandle[:]))
+		if !errors.Is(err, ErrInvalidWebAuthnChallenge) {
+			t.Errorf("err = %v, want ErrInvalidWebAuthnChallenge", err)
+		}
+	})
+
+	t.Run("key of another authenticator", func(t *testing.T) {
+		assertion, err := service.BeginLogin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		impostor := newSoftwareAuthenticator(t)
+		impostor.credentialID = authenticator.credentialID
+		_, err = service.FinishLogin(ctx, impostor.get(t, assertion.Response.Challenge.String(), userHandle[:]))
+		if !errors.Is(err, ErrWebAuthnVerification) {
+			t.Errorf("err = %v, want ErrWebAuthnVerification", err)
+		}
+	})
+
+	t.Run("sign counter going back", func(t *testing.T) {
+		assertion, err := service.BeginLogin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = service.FinishLogin(ctx, authenticator.get(t, assertion.Response.Challenge.String(), userHandle[:])); err != nil {
+			t.Fatal(err)
+		}
+
+		// A clone still counts from the old value
+		authenticator.signCount--
+		assertion, err = service.BeginLogin(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = service.FinishLogin(ctx, authenticator.get(t, assertion.Response.Challenge.String(), userHandle[:]))
+		if !errors.Is(err, ErrAuthenticatorCloned) {
+			t.Errorf("err = %v, want ErrAuthenticatorCloned", err)
+		}
+	})
+}
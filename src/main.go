@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"log/slog"
+	"net"
 	"os"
 	"time"
 
@@ -17,6 +21,7 @@ import (
 // @title           Go Base Auth API
 // @version         1.0
 // @description     This is a sample authentication service.
+// @securityDefinitions.basic  BasicAuth
 func main() {
 	// Setup logger first with a default level
 	logger := core.GetConfigureLogger(slog.LevelDebug)
@@ -39,29 +44,244 @@ func main() {
 		logger.Error("Could not initialize server config", "error", err)
 		os.Exit(1)
 	}
+	seedKey, err := services.NewSigningKey(
+		jwtConfig.KeyID, jwtConfig.Algorithm, jwtConfig.Secret, jwtConfig.PrivateKeyPEM,
+	)
+	if err != nil {
+		logger.Error("Could not load JWT signing key", "error", err, "algorithm", jwtConfig.Algorithm)
+		os.Exit(1)
+	}
+	accessExpireTime := time.Minute*time.Duration(jwtConfig.ExpiresAccessMinutes)
+	oauthConfig, err := core.InitializeOAuthConfig()
+	if err != nil {
+		logger.Error("Could not initialize OAuth config", "error", err)
+		os.Exit(1)
+	}
+	maxClientTokenTTL := time.Minute * time.Duration(oauthConfig.MaxClientTokenTTLMinutes)
+	// Access tokens are issued by the same authorization server as ID tokens
+	tokenSettings := services.TokenSettings{
+		Issuer:   oauthConfig.Issuer,
+		Audience: jwtConfig.Audience,
+	}
+	if tokenSettings.Audience == "" {
+		tokenSettings.Audience = tokenSettings.Issuer
+	}
+	signingKeyBox, err := services.NewSecretBox(jwtConfig.EncryptionKey)
+	if err != nil {
+		logger.Error("Could not initialize signing key secret box", "error", err)
+		os.Exit(1)
+	}
+	// Retired keys verify tokens until the longest living one expires
+	keyRing := services.NewKeyRing(tokenRepo, logger, signingKeyBox, seedKey, max(accessExpireTime, maxClientTokenTTL))
+	if err = keyRing.Load(context.Background()); err != nil {
+		logger.Error("Could not load signing key ring", "error", err)
+		os.Exit(1)
+	}
 	notificationWebhookConfig, err := core.InitializeLoginAttemptWebhookConfig()
 	if err != nil {
 		logger.Error("Could not initialize notification webhook config", "error", err)
 		os.Exit(1)
 	}
+	sessionConfig, err := core.InitializeSessionConfig()
+	if err != nil {
+		logger.Error("Could not initialize session config", "error", err)
+		os.Exit(1)
+	}
+	sessionLimit, err := services.NewSessionLimit(sessionConfig.MaxSessions, sessionConfig.EvictionPolicy)
+	if err != nil {
+		logger.Error("Could not initialize session limit", "error", err)
+		os.Exit(1)
+	}
+	passwordConfig, err := core.InitializePasswordConfig()
+	if err != nil {
+		logger.Error("Could not initialize password config", "error", err)
+		os.Exit(1)
+	}
+	passwordHasher := services.NewPasswordHasher(services.Argon2idParams{
+		MemoryKiB:   passwordConfig.Argon2MemoryKiB,
+		Iterations:  passwordConfig.Argon2Iterations,
+		Parallelism: passwordConfig.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	})
+	mailConfig, err := core.InitializeMailConfig()
+	if err != nil {
+		logger.Error("Could not initialize mail config", "error", err)
+		os.Exit(1)
+	}
+	var mailSender services.MailSender
+	switch mailConfig.Transport {
+	case "smtp":
+		mailSender = services.NewSMTPMailSender(services.SMTPSettings{
+			Host:     mailConfig.SMTPHost,
+			Port:     mailConfig.SMTPPort,
+			Username: mailConfig.SMTPUsername,
+			Password: mailConfig.SMTPPassword,
+			From:     mailConfig.From,
+			Timeout:  time.Second * 10,
+		})
+	case "file":
+		mailSender, err = services.NewFileMailSender(mailConfig.FileDir, mailConfig.From, logger)
+		if err != nil {
+			logger.Error("Could not initialize mail sender", "error", err)
+			os.Exit(1)
+		}
+	}
+	userService, err := services.NewUserService(
+		repository.NewUserRepository(database, logger),
+		logger,
+		passwordHasher,
+		passwordConfig.MinLength,
+		mailSender,
+		mailConfig.AppURL,
+	)
+	if err != nil {
+		logger.Error("Could not initialize user service", "error", err)
+		os.Exit(1)
+	}
+	authenticatorConfig, err := core.InitializeAuthenticatorConfig()
+	if err != nil {
+		logger.Error("Could not initialize authenticator config", "error", err)
+		os.Exit(1)
+	}
+	var authenticators []services.Authenticator
+	for _, name := range authenticatorConfig.Chain {
+		switch name {
+		case "local":
+			authenticators = append(authenticators, services.NewLocalAuthenticator(userService))
+		case "ldap":
+			ldapConfig := authenticatorConfig.LDAP
+			authenticators = append(authenticators, services.NewLDAPAuthenticator(services.LDAPSettings{
+				URL:              ldapConfig.URL,
+				StartTLS:         ldapConfig.StartTLS,
+				BindDN:           ldapConfig.BindDN,
+				BindPassword:     ldapConfig.BindPassword,
+				BaseDN:           ldapConfig.BaseDN,
+				UserFilter:       ldapConfig.UserFilter,
+				SubjectAttribute: ldapConfig.SubjectAttribute,
+				Timeout:          time.Second * time.Duration(ldapConfig.TimeoutSeconds),
+			}, userService, logger))
+		}
+	}
+	logger.Info("Authenticators", "chain", authenticatorConfig.Chain)
+	mfaConfig, err := core.InitializeMFAConfig()
+	if err != nil {
+		logger.Error("Could not initialize MFA config", "error", err)
+		os.Exit(1)
+	}
+	secretBox, err := services.NewSecretBox(mfaConfig.EncryptionKey)
+	if err != nil {
+		logger.Error("Could not initialize secret box", "error", err)
+		os.Exit(1)
+	}
+	mfaService := services.NewMFAService(
+		repository.NewMFARepository(database, logger), logger, secretBox, mfaConfig.TOTPIssuer,
+	)
+	roleService := services.NewRoleService(repository.NewRoleRepository(database, logger), logger)
 	// Create service
 	authService := services.NewAuthService(
 		*tokenRepo, // Dereference tokenRepo to match expected type
 		logger,
-		jwtConfig.Secret,
-		time.Minute*time.Duration(jwtConfig.ExpiresAccessMinutes),    // accessExpireTime
+		keyRing,
+		accessExpireTime,
 		time.Minute*time.Duration(jwtConfig.ExpiresRefreshMinutes),  // refreshExpireTime
 		notificationWebhookConfig.URL,
+		sessionLimit,
+		services.NewAuthenticatorChain(logger, authenticators...),
+		mfaService,
+		roleService,
+		tokenSettings,
+	)
+
+	webAuthnConfig, err := core.InitializeWebAuthnConfig()
+	if err != nil {
+		logger.Error("Could not initialize WebAuthn config", "error", err)
+		os.Exit(1)
+	}
+	webAuthnService, err := services.NewWebAuthnService(
+		services.WebAuthnSettings{
+			RPID:          webAuthnConfig.RPID,
+			RPDisplayName: webAuthnConfig.RPDisplayName,
+			RPOrigins:     webAuthnConfig.RPOrigins,
+			Attestation:   webAuthnConfig.Attestation,
+		},
+		repository.NewWebAuthnRepository(database, logger),
+		userService,
+		logger,
+	)
+	if err != nil {
+		logger.Error("Could not initialize WebAuthn service", "error", err)
+		os.Exit(1)
+	}
+
+	emailLoginConfig, err := core.InitializeEmailLoginConfig()
+	if err != nil {
+		logger.Error("Could not initialize email login config", "error", err)
+		os.Exit(1)
+	}
+	emailLoginService := services.NewEmailLoginService(
+		services.EmailLoginSettings{
+			CodeTTL:    time.Minute * time.Duration(emailLoginConfig.CodeTTLMinutes),
+			RateLimit:  emailLoginConfig.RateLimit,
+			RateWindow: time.Minute * time.Duration(emailLoginConfig.RateWindowMinutes),
+			AppURL:     mailConfig.AppURL,
+		},
+		repository.NewEmailLoginRepository(database, logger),
+		userService,
+		mailSender,
+		secretBox,
+		logger,
 	)
 
-	// Create handler
-	authHandler := v1.NewAuthHandler(authService)
 	serverConfig, err := core.InitializeServerConfig()
 	if err != nil {
 		logger.Error("Could not initialize server config", "error", err)
 		os.Exit(1)
 	}
 
+	oauthService := services.NewOAuthService(
+		services.OAuthSettings{
+			LoginURL:              oauthConfig.LoginURL,
+			Issuer:                oauthConfig.Issuer,
+			IDTokenTTL:            accessExpireTime,
+			MaxClientTokenTTL:     maxClientTokenTTL,
+			DeviceVerificationURL: oauthConfig.DeviceVerificationURL,
+			MutualTLS:             serverConfig.TLSClientCAPEM != nil,
+		},
+		repository.NewOAuthRepository(database, logger),
+		roleService,
+		userService,
+		keyRing,
+		logger,
+	)
+
+	apiKeyService := services.NewAPIKeyService(
+		repository.NewAPIKeyRepository(database, logger), roleService, oauthService, logger,
+	)
+
+	// Create handler
+	refreshCookieConfig, err := core.InitializeRefreshCookieConfig()
+	if err != nil {
+		logger.Error("Could not initialize refresh cookie config", "error", err)
+		os.Exit(1)
+	}
+
+	authHandler := v1.NewAuthHandler(
+		authService, userService, mfaService, webAuthnService, emailLoginService, roleService, oauthService,
+		apiKeyService, refreshCookieConfig,
+	)
+	adminConfig, err := core.InitializeAdminConfig()
+	if err != nil {
+		logger.Error("Could not initialize admin config", "error", err)
+		os.Exit(1)
+	}
+
+	introspectionConfig, err := core.InitializeIntrospectionConfig()
+	if err != nil {
+		logger.Error("Could not initialize introspection config", "error", err)
+		os.Exit(1)
+	}
+
 	app := fiber.New(fiber.Config{
 		CaseSensitive: true,
 		StrictRouting: true,
@@ -71,10 +291,40 @@ func main() {
 	})
 
 	// Setup V1 Routes
-	v1.SetupRoutes(app, authHandler, authService)
+	v1.SetupRoutes(app, authHandler, authService, apiKeyService, adminConfig, introspectionConfig)
+
+	if serverConfig.TLSCertPEM == nil {
+		logger.Info("Starting server", "port", serverConfig.Port)
+		err = app.Listen(":" + serverConfig.Port)
+	} else {
+		var certificate tls.Certificate
+		certificate, err = tls.X509KeyPair(serverConfig.TLSCertPEM, serverConfig.TLSKeyPEM)
+		if err != nil {
+			logger.Error("Could not load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		tlsConfig := &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}
 
-	logger.Info("Starting server", "port", serverConfig.Port)
-	err = app.Listen(":" + serverConfig.Port)
+		// Client certificates are optional, they authenticate OAuth clients and bind their tokens
+		if serverConfig.TLSClientCAPEM != nil {
+			clientCAs := x509.NewCertPool()
+			if !clientCAs.AppendCertsFromPEM(serverConfig.TLSClientCAPEM) {
+				logger.Error("Could not load TLS client CA bundle: no certificates found")
+				os.Exit(1)
+			}
+			tlsConfig.ClientCAs = clientCAs
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+
+		var listener net.Listener
+		listener, err = tls.Listen("tcp", ":"+serverConfig.Port, tlsConfig)
+		if err != nil {
+			logger.Error("Could not start server", "error", err)
+			os.Exit(1)
+		}
+		logger.Info("Starting server", "port", serverConfig.Port, "mutual_tls", tlsConfig.ClientCAs != nil)
+		err = app.Listener(listener)
+	}
 	if err != nil {
 		logger.Error("Could not start server", "error", err)
 		os.Exit(1)
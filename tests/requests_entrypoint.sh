@@ -1,19 +1,38 @@
-# Определяем тестовый USER_ID, который будет использоваться во всех запросах
-USER_ID="a1b2c3d4-e5f6-7890-1234-567890abcdef"
+# Определяем тестового пользователя, который будет использоваться во всех запросах
+USERNAME="user_$(date +%s)"
+EMAIL="${USERNAME}@example.com"
+PASSWORD="correct horse battery staple"
 
 # Имитируем User-Agent и IP-адрес для запросов.
 # X-Forwarded-For используется для передачи IP-адреса, который будет прочитан приложением Fiber.
 INITIAL_USER_AGENT="MyAwesomeClient/1.0"
 INITIAL_IP_ADDRESS="192.168.1.10"
 
-echo "--- Шаг 1: Генерация новой пары токенов ---"
-# POST /api/v1/auth/token
-# Генерируем access и refresh токены для USER_ID.
+echo "--- Шаг 0: Регистрация пользователя ---"
+# POST /api/v1/auth/register
+curl -s -X POST \
+  "http://localhost:8000/api/v1/auth/register" \
+  -H "Content-Type: application/json" \
+  -d "{
+        \"username\": \"${USERNAME}\",
+        \"email\": \"${EMAIL}\",
+        \"password\": \"${PASSWORD}\"
+      }"
+echo ""
+echo ""
+
+echo "--- Шаг 1: Вход и генерация новой пары токенов ---"
+# POST /api/v1/auth/login
+# Генерируем access и refresh токены по логину и паролю.
 RESPONSE=$(curl -s -X POST \
-  "http://localhost:8000/api/v1/auth/token?user_id=${USER_ID}" \
+  "http://localhost:8000/api/v1/auth/login" \
   -H "Content-Type: application/json" \
   -H "User-Agent: ${INITIAL_USER_AGENT}" \
-  -H "X-Forwarded-For: ${INITIAL_IP_ADDRESS}")
+  -H "X-Forwarded-For: ${INITIAL_IP_ADDRESS}" \
+  -d "{
+        \"login\": \"${USERNAME}\",
+        \"password\": \"${PASSWORD}\"
+      }")
 
 ACCESS_TOKEN=$(echo "${RESPONSE}" | jq -r .access_token)
 REFRESH_TOKEN=$(echo "${RESPONSE}" | jq -r .refresh_token)
@@ -127,10 +146,14 @@ echo "--- Шаг 6: Деавторизация пользователя (Logout)
 # нам нужно сначала сгенерировать новую пару токенов для того же пользователя.
 echo "  Генерируем новую пару токенов для деавторизации:"
 RESPONSE_FOR_LOGOUT=$(curl -s -X POST \
-  "http://localhost:8000/api/v1/auth/token?user_id=${USER_ID}" \
+  "http://localhost:8000/api/v1/auth/login" \
   -H "Content-Type: application/json" \
   -H "User-Agent: ${INITIAL_USER_AGENT}" \
-  -H "X-Forwarded-For: ${INITIAL_IP_ADDRESS}")
+  -H "X-Forwarded-For: ${INITIAL_IP_ADDRESS}" \
+  -d "{
+        \"login\": \"${EMAIL}\",
+        \"password\": \"${PASSWORD}\"
+      }")
 
 ACCESS_TOKEN_FOR_LOGOUT=$(echo "${RESPONSE_FOR_LOGOUT}" | jq -r .access_token)
 REFRESH_TOKEN_FOR_LOGOUT=$(echo "${RESPONSE_FOR_LOGOUT}" | jq -r .refresh_token)